@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// Apply methods
+const (
+	applyMethodNFT     = "nft"
+	applyMethodNetlink = "netlink"
+)
+
+// apply loads the generated files into the kernel with the configured
+// method, or on the -hosts over SSH. With -apply-history every applied
+// version is kept, and -rollback applies an earlier one instead.
+func (g *geoIPGenerator) apply() error {
+	if g.cfg.Rollback > 0 {
+		return classify(exitApply, g.rollback())
+	}
+	// The batch declares the sets with the features of the files
+	if err := g.resolveNFTFeatures(); err != nil {
+		return err
+	}
+	if err := g.applyFiles(); err != nil {
+		return classify(exitApply, err)
+	}
+
+	if g.cfg.ApplyHistory != "" {
+		if err := g.recordApply(); err != nil {
+			slog.Warn("Failed to record the applied version", "dir", g.cfg.ApplyHistory, "error", err)
+		}
+	}
+	return nil
+}
+
+func (g *geoIPGenerator) applyFiles() error {
+	if len(g.cfg.Hosts) > 0 {
+		return g.applyRemote()
+	}
+	if g.cfg.ApplyMethod == applyMethodNetlink {
+		return g.applyNetlink()
+	}
+	return g.applyNFT()
+}
+
+// applyNFT loads the generated files with `nft -f`. The current ruleset is
+// snapshotted first and restored when the load fails or the post-apply
+// probe does not pass.
+func (g *geoIPGenerator) applyNFT() error {
+	nft, err := exec.LookPath(g.cfg.NFTBinary)
+	if err != nil {
+		return fmt.Errorf("nft binary not found: %w", err)
+	}
+	if err := g.checkApplyFeatures(nft); err != nil {
+		return err
+	}
+
+	batch, err := g.buildApplyBatch()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(batch)
+
+	snapshot, err := snapshotRuleset(g.ctx, nft)
+	if err != nil {
+		return fmt.Errorf("snapshotting ruleset: %w", err)
+	}
+	defer os.Remove(snapshot)
+
+	if out, err := exec.CommandContext(g.ctx, nft, "-f", batch).CombinedOutput(); err != nil {
+		slog.Error("nft load failed", "output", strings.TrimSpace(string(out)))
+		// The batch is a single transaction, a failed load changed nothing
+		return fmt.Errorf("loading sets: %w", err)
+	}
+	slog.Info("Applied files", "files", g.cfg.ApplyFiles)
+
+	if g.cfg.ApplyProbe == "" {
+		return nil
+	}
+
+	if err := g.runProbe(); err != nil {
+		slog.Error("Probe failed, rolling back", "error", err)
+		if rbErr := restoreRuleset(nft, snapshot); rbErr != nil {
+			return fmt.Errorf("probe failed (%v) and rollback failed: %w", err, rbErr)
+		}
+		slog.Warn("Restored the previous ruleset")
+		return fmt.Errorf("post-apply probe: %w", err)
+	}
+
+	slog.Info("Post-apply probe passed")
+	return nil
+}
+
+// buildApplyBatch writes the apply batch for the local host to a temporary
+// file.
+func (g *geoIPGenerator) buildApplyBatch() (string, error) {
+	f, err := os.CreateTemp("", "geoip-apply-*.nft")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	err = g.renderApplyBatch(f, func(name string) (string, error) {
+		return filepath.Abs(filepath.Join(g.cfg.OutputDir, name))
+	})
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// renderApplyBatch writes an nft script that makes sure every set exists,
+// flushes it and then includes the generated files, or adds the elements
+// of the .json files of -format nft-json, so that the whole
+// replacement happens in one transaction. include maps an -apply-files
+// entry to the path nft reads it from. The IPv4 and IPv6 files use the
+// same set names, so only one family can be applied to the table.
+func (g *geoIPGenerator) renderApplyBatch(w io.Writer, include func(name string) (string, error)) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "add table %s\n", g.cfg.table())
+
+	var includes []string
+	for _, name := range g.cfg.ApplyFiles {
+		sets, err := readNFTSets(filepath.Join(g.cfg.OutputDir, name))
+		if err != nil {
+			return err
+		}
+
+		// Declared like in the files, nft rejects a set redeclared with
+		// other flags
+		opts := geonft.SetOptions{AutoMerge: g.features.autoMerge}
+		for _, set := range sortedCodes(sets) {
+			statements := geonft.SetStatements(nftFamily(sets[set][0]), opts)
+			fmt.Fprintf(&b, "add set %s %s { %s; }\n", g.cfg.table(), set, strings.Join(statements, "; "))
+			fmt.Fprintf(&b, "flush set %s %s\n", g.cfg.table(), set)
+		}
+
+		// nft cannot include the JSON of -format nft-json in a script,
+		// its elements are added by the batch itself
+		if filepath.Ext(name) == ".json" {
+			for _, set := range sortedCodes(sets) {
+				fmt.Fprintf(&b, "add element %s %s { ", g.cfg.table(), set)
+				for i, prefix := range sets[set] {
+					if i > 0 {
+						b.WriteString(", ")
+					}
+					b.WriteString(prefix.String())
+				}
+				b.WriteString(" }\n")
+			}
+			continue
+		}
+
+		path, err := include(name)
+		if err != nil {
+			return err
+		}
+		includes = append(includes, path)
+	}
+
+	for _, path := range includes {
+		// Bare sets are only valid inside a table block
+		if g.cfg.NoTable {
+			fmt.Fprintf(&b, "table %s {\n    include %q\n}\n", g.cfg.table(), path)
+			continue
+		}
+		fmt.Fprintf(&b, "include %q\n", path)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// readApplySets parses the sets of every file in -apply-files. A set
+// declared by more than one file is rejected, as loading it would let the
+// last file silently win.
+func (g *geoIPGenerator) readApplySets() (map[string][]netip.Prefix, error) {
+	sets := make(map[string][]netip.Prefix)
+	for _, name := range g.cfg.ApplyFiles {
+		fileSets, err := readNFTSets(filepath.Join(g.cfg.OutputDir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		for set, prefixes := range fileSets {
+			if _, ok := sets[set]; ok {
+				return nil, fmt.Errorf("set %s is declared by more than one of -apply-files", set)
+			}
+			sets[set] = prefixes
+		}
+	}
+	return sets, nil
+}
+
+// nftFamily returns the family of the set holding p, "ipv4" or "ipv6".
+func nftFamily(p netip.Prefix) string {
+	if p.Addr().Is4() {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// snapshotRuleset saves the current ruleset to a temporary file.
+func snapshotRuleset(ctx context.Context, nft string) (string, error) {
+	out, err := exec.CommandContext(ctx, nft, "list", "ruleset").Output()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp("", "geoip-snapshot-*.nft")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(out); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// restoreRuleset atomically replaces the ruleset with a snapshot. It is not
+// cancelled on shutdown, an interrupted apply still rolls back.
+func restoreRuleset(nft, snapshot string) error {
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "geoip-rollback-*.nft")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = fmt.Fprintf(f, "flush ruleset\n%s", data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if out, err := exec.Command(nft, "-f", f.Name()).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// runProbe runs the configured connectivity check through the shell.
+func (g *geoIPGenerator) runProbe() error {
+	ctx, cancel := context.WithTimeout(g.ctx, time.Duration(g.cfg.ApplyProbeTimeout))
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "sh", "-c", g.cfg.ApplyProbe).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sort"
+
+	"github.com/google/nftables"
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+	"github.com/mdlayher/netlink"
+)
+
+const (
+	// netlinkElementsPerMessage bounds the size of a single NEWSETELEM
+	// message, all messages are still committed as one transaction
+	netlinkElementsPerMessage = 4096
+	// netlinkSocketBuffer is large enough for a batch replacing every
+	// set of a full country database
+	netlinkSocketBuffer = 64 << 20
+)
+
+// netlinkTableFamilies maps the -table-family values to netlink families
+var netlinkTableFamilies = map[string]nftables.TableFamily{
+	"inet":   nftables.TableFamilyINet,
+	"ip":     nftables.TableFamilyIPv4,
+	"ip6":    nftables.TableFamilyIPv6,
+	"bridge": nftables.TableFamilyBridge,
+	"netdev": nftables.TableFamilyNetdev,
+}
+
+// netlinkConn is the part of nftables.Conn the apply uses.
+type netlinkConn interface {
+	AddTable(t *nftables.Table) *nftables.Table
+	DelTable(t *nftables.Table)
+	ListTablesOfFamily(family nftables.TableFamily) ([]*nftables.Table, error)
+	AddSet(s *nftables.Set, vals []nftables.SetElement) error
+	DelSet(s *nftables.Set)
+	FlushSet(s *nftables.Set)
+	GetSets(t *nftables.Table) ([]*nftables.Set, error)
+	GetSetElements(s *nftables.Set) ([]nftables.SetElement, error)
+	SetAddElements(s *nftables.Set, vals []nftables.SetElement) error
+	SetDeleteElements(s *nftables.Set, vals []nftables.SetElement) error
+	Flush() error
+}
+
+// netlinkSnapshot holds the state of the table before an apply, so that a
+// failed probe can put it back.
+type netlinkSnapshot struct {
+	tableExisted bool
+	// elements of the sets that existed, missing sets have no entry
+	elements map[string][]nftables.SetElement
+}
+
+// applyNetlink loads the generated files through netlink, without the nft
+// binary. The current elements of every set are read from the kernel and
+// only the ranges that changed are deleted and added, one transaction per
+// set, so existing rules referencing the sets keep working and a refresh
+// does not reload millions of unchanged elements.
+func (g *geoIPGenerator) applyNetlink() error {
+	sets, err := g.readApplySets()
+	if err != nil {
+		return err
+	}
+
+	conn, err := nftables.New(nftables.WithSockOptions(func(c *netlink.Conn) error {
+		if err := c.SetWriteBuffer(netlinkSocketBuffer); err != nil {
+			return err
+		}
+		return c.SetReadBuffer(netlinkSocketBuffer)
+	}))
+	if err != nil {
+		return fmt.Errorf("opening netlink connection: %w", err)
+	}
+
+	table := &nftables.Table{Family: netlinkTableFamilies[g.cfg.TableFamily], Name: g.cfg.Table}
+	return g.updateNetlinkSets(conn, table, sets)
+}
+
+// updateNetlinkSets brings the sets of table to the wanted elements. A
+// failed set rolls back the sets committed before it, a failed
+// -apply-probe all of them.
+func (g *geoIPGenerator) updateNetlinkSets(conn netlinkConn, table *nftables.Table, sets map[string][]netip.Prefix) error {
+	snapshot, err := snapshotNetlinkSets(conn, table, sets)
+	if err != nil {
+		return fmt.Errorf("snapshotting sets: %w", err)
+	}
+
+	applied := make(map[string][]netip.Prefix)
+	added, removed, unchanged := 0, 0, 0
+	for _, name := range sortedCodes(sets) {
+		set := netlinkSet(table, name, sets[name])
+
+		current, existed := snapshot.elements[name]
+		if !existed {
+			conn.AddTable(table)
+			if err := conn.AddSet(set, nil); err != nil {
+				return fmt.Errorf("adding set %s: %w", name, err)
+			}
+		}
+
+		zero := netip.IPv6Unspecified()
+		if set.KeyType == nftables.TypeIPAddr {
+			zero = netip.IPv4Unspecified()
+		}
+		delta := diffElements(current, mergeRanges(sets[name]), zero)
+		if delta.empty() {
+			unchanged++
+			continue
+		}
+
+		if err := queueElements(set, delta.remove, conn.SetDeleteElements); err != nil {
+			return fmt.Errorf("deleting elements from set %s: %w", name, err)
+		}
+		if err := queueElements(set, delta.add, conn.SetAddElements); err != nil {
+			return fmt.Errorf("adding elements to set %s: %w", name, err)
+		}
+
+		if err := conn.Flush(); err != nil {
+			// The failed transaction changed nothing
+			if len(applied) == 0 {
+				return fmt.Errorf("updating set %s: %w", name, err)
+			}
+			slog.Error("Updating set failed, rolling back", "set", name)
+			if rbErr := restoreNetlinkSets(conn, table, applied, snapshot); rbErr != nil {
+				return fmt.Errorf("updating set %s failed (%v) and rollback failed: %w", name, err, rbErr)
+			}
+			return fmt.Errorf("updating set %s: %w", name, err)
+		}
+		applied[name] = sets[name]
+		added += delta.added
+		removed += delta.removed
+	}
+	slog.Info("Applied files via netlink", "files", g.cfg.ApplyFiles, "ranges_added", added, "ranges_removed", removed,
+		"sets_unchanged", unchanged, "sets", len(sets))
+
+	if g.cfg.ApplyProbe == "" || len(applied) == 0 {
+		return nil
+	}
+
+	if err := g.runProbe(); err != nil {
+		slog.Error("Probe failed, rolling back", "error", err)
+		if rbErr := restoreNetlinkSets(conn, table, applied, snapshot); rbErr != nil {
+			return fmt.Errorf("probe failed (%v) and rollback failed: %w", err, rbErr)
+		}
+		slog.Warn("Restored the previous sets")
+		return fmt.Errorf("post-apply probe: %w", err)
+	}
+
+	slog.Info("Post-apply probe passed")
+	return nil
+}
+
+// snapshotNetlinkSets records which of the sets exist and their elements.
+func snapshotNetlinkSets(conn netlinkConn, table *nftables.Table, sets map[string][]netip.Prefix) (netlinkSnapshot, error) {
+	snapshot := netlinkSnapshot{elements: make(map[string][]nftables.SetElement)}
+
+	tables, err := conn.ListTablesOfFamily(table.Family)
+	if err != nil {
+		return snapshot, err
+	}
+	for _, t := range tables {
+		if t.Name == table.Name {
+			snapshot.tableExisted = true
+		}
+	}
+	if !snapshot.tableExisted {
+		return snapshot, nil
+	}
+
+	existing, err := conn.GetSets(table)
+	if err != nil {
+		return snapshot, err
+	}
+	for _, set := range existing {
+		if _, ok := sets[set.Name]; !ok {
+			continue
+		}
+
+		elements, err := conn.GetSetElements(set)
+		if err != nil {
+			return snapshot, fmt.Errorf("reading set %s: %w", set.Name, err)
+		}
+		snapshot.elements[set.Name] = elements
+	}
+	return snapshot, nil
+}
+
+// restoreNetlinkSets puts the snapshotted elements back in one transaction
+// and removes what the apply created.
+func restoreNetlinkSets(conn netlinkConn, table *nftables.Table, sets map[string][]netip.Prefix, snapshot netlinkSnapshot) error {
+	if !snapshot.tableExisted {
+		conn.DelTable(table)
+		return conn.Flush()
+	}
+
+	for _, name := range sortedCodes(sets) {
+		set := netlinkSet(table, name, sets[name])
+
+		elements, existed := snapshot.elements[name]
+		if !existed {
+			conn.DelSet(set)
+			continue
+		}
+
+		conn.FlushSet(set)
+		if err := queueElements(set, elements, conn.SetAddElements); err != nil {
+			return fmt.Errorf("restoring set %s: %w", name, err)
+		}
+	}
+	return conn.Flush()
+}
+
+// netlinkSet describes an interval set holding addresses of the family of
+// prefixes.
+func netlinkSet(table *nftables.Table, name string, prefixes []netip.Prefix) *nftables.Set {
+	keyType := nftables.TypeIP6Addr
+	if len(prefixes) > 0 && prefixes[0].Addr().Is4() {
+		keyType = nftables.TypeIPAddr
+	}
+
+	return &nftables.Set{
+		Table:    table,
+		Name:     name,
+		KeyType:  keyType,
+		Interval: true,
+	}
+}
+
+// queueElements passes the elements to op, an element operation of
+// nftables.Conn, in messages of bounded size.
+func queueElements(set *nftables.Set, elements []nftables.SetElement, op func(*nftables.Set, []nftables.SetElement) error) error {
+	for len(elements) > 0 {
+		n := min(len(elements), netlinkElementsPerMessage)
+		if err := op(set, elements[:n]); err != nil {
+			return err
+		}
+		elements = elements[n:]
+	}
+	return nil
+}
+
+// elementDelta is the change that turns the elements of a set in the
+// kernel into the wanted ranges.
+type elementDelta struct {
+	remove, add    []nftables.SetElement
+	removed, added int
+}
+
+func (d elementDelta) empty() bool {
+	return len(d.remove) == 0 && len(d.add) == 0
+}
+
+// diffElements compares the elements read from the kernel with the wanted
+// ranges of the family of zero. Ranges that differ in any way are removed
+// and re-added as a whole, as interval elements can only be deleted with
+// their exact start and end keys.
+func diffElements(current []nftables.SetElement, wanted []addrRange, zero netip.Addr) elementDelta {
+	var delta elementDelta
+
+	currentRanges := elementRanges(current)
+	have := make(map[addrRange]bool)
+	for _, r := range currentRanges {
+		have[r] = true
+	}
+
+	haveZeroEnd := false
+	for _, e := range current {
+		if addr, ok := netip.AddrFromSlice(e.Key); ok && e.IntervalEnd && addr.IsUnspecified() {
+			haveZeroEnd = true
+		}
+	}
+
+	want := make(map[addrRange]bool)
+	for _, r := range wanted {
+		want[r] = true
+		if !have[r] {
+			delta.add = append(delta.add, rangeElements(r)...)
+			delta.added++
+		}
+	}
+	for _, r := range currentRanges {
+		if !want[r] {
+			delta.remove = append(delta.remove, rangeElements(r)...)
+			delta.removed++
+		}
+	}
+
+	// The closing element below the first range is only wanted when the
+	// set does not start at the zero address
+	wantZeroEnd := len(wanted) > 0 && wanted[0].start != zero
+	if haveZeroEnd != wantZeroEnd {
+		element := nftables.SetElement{Key: zero.AsSlice(), IntervalEnd: true}
+		if wantZeroEnd {
+			delta.add = append([]nftables.SetElement{element}, delta.add...)
+		} else {
+			delta.remove = append(delta.remove, element)
+		}
+	}
+
+	return delta
+}
+
+// elementRanges converts the elements of an interval set, in any order,
+// back into ranges. A start without a matching end reaches the last
+// address of the family.
+func elementRanges(elements []nftables.SetElement) []addrRange {
+	type element struct {
+		addr netip.Addr
+		end  bool
+	}
+
+	sorted := make([]element, 0, len(elements))
+	for _, e := range elements {
+		if addr, ok := netip.AddrFromSlice(e.Key); ok {
+			sorted = append(sorted, element{addr: addr, end: e.IntervalEnd})
+		}
+	}
+	// An end sorts before a start at the same address, it closes the
+	// previous range
+	sort.Slice(sorted, func(i, j int) bool {
+		if c := sorted[i].addr.Compare(sorted[j].addr); c != 0 {
+			return c < 0
+		}
+		return sorted[i].end && !sorted[j].end
+	})
+
+	var ranges []addrRange
+	open := false
+	for _, e := range sorted {
+		if open {
+			ranges[len(ranges)-1].end = e.addr.Prev()
+			open = false
+		}
+		if !e.end {
+			ranges = append(ranges, addrRange{start: e.addr})
+			open = true
+		}
+	}
+	if open {
+		start := ranges[len(ranges)-1].start
+		ranges[len(ranges)-1].end = geonft.PrefixLast(netip.PrefixFrom(start, 0))
+	}
+	return ranges
+}
+
+// rangeElements returns the start and end elements of an interval. A range
+// reaching the last address of the family has no end element.
+func rangeElements(r addrRange) []nftables.SetElement {
+	elements := []nftables.SetElement{{Key: r.start.AsSlice()}}
+	if next := r.end.Next(); next.IsValid() {
+		elements = append(elements, nftables.SetElement{Key: next.AsSlice(), IntervalEnd: true})
+	}
+	return elements
+}
+
+// addrRange is an inclusive range of addresses.
+type addrRange struct {
+	start, end netip.Addr
+}
+
+// mergeRanges converts prefixes into sorted ranges, joining overlapping and
+// adjacent ones.
+func mergeRanges(prefixes []netip.Prefix) []addrRange {
+	var ranges []addrRange
+	for _, p := range geonft.MergePrefixes(prefixes) {
+		last := geonft.PrefixLast(p)
+		if n := len(ranges); n > 0 && ranges[n-1].end.Next() == p.Addr() {
+			ranges[n-1].end = last
+			continue
+		}
+		ranges = append(ranges, addrRange{start: p.Addr(), end: last})
+	}
+	return ranges
+}
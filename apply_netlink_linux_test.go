@@ -0,0 +1,441 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/google/nftables"
+)
+
+func TestDiffElements(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    []string
+		wanted     []string
+		zero       netip.Addr
+		wantAdd    []string
+		wantRemove []string
+	}{
+		{
+			name:    "empty set",
+			wanted:  []string{"10.0.0.0/8"},
+			zero:    netip.IPv4Unspecified(),
+			wantAdd: []string{"0.0.0.0 end", "10.0.0.0", "11.0.0.0 end"},
+		},
+		{
+			name:    "unchanged",
+			current: []string{"0.0.0.0 end", "10.0.0.0", "11.0.0.0 end"},
+			wanted:  []string{"10.0.0.0/8"},
+			zero:    netip.IPv4Unspecified(),
+		},
+		{
+			name:       "range grown",
+			current:    []string{"0.0.0.0 end", "10.0.0.0", "10.128.0.0 end"},
+			wanted:     []string{"10.0.0.0/8"},
+			zero:       netip.IPv4Unspecified(),
+			wantAdd:    []string{"10.0.0.0", "11.0.0.0 end"},
+			wantRemove: []string{"10.0.0.0", "10.128.0.0 end"},
+		},
+		{
+			name:       "range removed",
+			current:    []string{"0.0.0.0 end", "10.0.0.0", "11.0.0.0 end", "192.0.2.0", "192.0.3.0 end"},
+			wanted:     []string{"10.0.0.0/8"},
+			zero:       netip.IPv4Unspecified(),
+			wantRemove: []string{"192.0.2.0", "192.0.3.0 end"},
+		},
+		{
+			name:       "elements in any order",
+			current:    []string{"192.0.3.0 end", "11.0.0.0 end", "192.0.2.0", "0.0.0.0 end", "10.0.0.0"},
+			wanted:     []string{"10.0.0.0/8", "198.51.100.0/24"},
+			zero:       netip.IPv4Unspecified(),
+			wantAdd:    []string{"198.51.100.0", "198.51.101.0 end"},
+			wantRemove: []string{"192.0.2.0", "192.0.3.0 end"},
+		},
+		{
+			name:       "starting at zero",
+			current:    []string{"0.0.0.0 end", "10.0.0.0", "11.0.0.0 end"},
+			wanted:     []string{"0.0.0.0/8"},
+			zero:       netip.IPv4Unspecified(),
+			wantAdd:    []string{"0.0.0.0", "1.0.0.0 end"},
+			wantRemove: []string{"10.0.0.0", "11.0.0.0 end", "0.0.0.0 end"},
+		},
+		{
+			name:       "no longer starting at zero",
+			current:    []string{"0.0.0.0", "1.0.0.0 end"},
+			wanted:     []string{"10.0.0.0/8"},
+			zero:       netip.IPv4Unspecified(),
+			wantAdd:    []string{"0.0.0.0 end", "10.0.0.0", "11.0.0.0 end"},
+			wantRemove: []string{"0.0.0.0", "1.0.0.0 end"},
+		},
+		{
+			name:    "reaching the last address",
+			wanted:  []string{"224.0.0.0/3"},
+			zero:    netip.IPv4Unspecified(),
+			wantAdd: []string{"0.0.0.0 end", "224.0.0.0"},
+		},
+		{
+			name:       "emptied",
+			current:    []string{"0.0.0.0 end", "10.0.0.0", "11.0.0.0 end"},
+			zero:       netip.IPv4Unspecified(),
+			wantRemove: []string{"10.0.0.0", "11.0.0.0 end", "0.0.0.0 end"},
+		},
+		{
+			name:       "ipv6",
+			current:    []string{":: end", "2001:db8::", "2001:db9:: end"},
+			wanted:     []string{"2001:db8::/32", "2001:db8:1::/48", "2001:db9::/32"},
+			zero:       netip.IPv6Unspecified(),
+			wantAdd:    []string{"2001:db8::", "2001:dba:: end"},
+			wantRemove: []string{"2001:db8::", "2001:db9:: end"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := diffElements(parseElements(t, tt.current), mergeRanges(parsePrefixes(t, tt.wanted)), tt.zero)
+			if got := formatElements(delta.add); !slices.Equal(got, tt.wantAdd) {
+				t.Errorf("add = %q, want %q", got, tt.wantAdd)
+			}
+			if got := formatElements(delta.remove); !slices.Equal(got, tt.wantRemove) {
+				t.Errorf("remove = %q, want %q", got, tt.wantRemove)
+			}
+		})
+	}
+}
+
+func TestUpdateNetlinkSets(t *testing.T) {
+	old := map[string][]netip.Prefix{
+		"a": {netip.MustParsePrefix("192.0.2.0/24")},
+		"b": {netip.MustParsePrefix("198.51.100.0/24")},
+	}
+	wanted := map[string][]netip.Prefix{
+		"a": {netip.MustParsePrefix("10.0.0.0/8")},
+		"b": {netip.MustParsePrefix("172.16.0.0/12")},
+	}
+
+	tests := []struct {
+		name string
+		// Sets existing before the apply, no table when nil
+		existing map[string][]netip.Prefix
+		// Number of the flush that fails, none when 0
+		failFlush int
+		probe     string
+		// Sets after the apply, no table when nil
+		want    map[string][]netip.Prefix
+		wantErr string
+	}{
+		{
+			name:     "new table",
+			existing: nil,
+			want:     wanted,
+		},
+		{
+			name:     "changed sets",
+			existing: old,
+			want:     wanted,
+		},
+		{
+			name:      "first set of a new table fails",
+			existing:  nil,
+			failFlush: 1,
+			want:      nil,
+			wantErr:   "updating set a",
+		},
+		{
+			name:      "second set of a new table fails",
+			existing:  nil,
+			failFlush: 2,
+			want:      nil,
+			wantErr:   "updating set b",
+		},
+		{
+			name:      "second set fails",
+			existing:  old,
+			failFlush: 2,
+			want:      old,
+			wantErr:   "updating set b",
+		},
+		{
+			name:      "new set fails",
+			existing:  map[string][]netip.Prefix{"a": old["a"]},
+			failFlush: 2,
+			want:      map[string][]netip.Prefix{"a": old["a"]},
+			wantErr:   "updating set b",
+		},
+		{
+			name:     "probe fails",
+			existing: map[string][]netip.Prefix{"a": old["a"]},
+			probe:    "exit 1",
+			want:     map[string][]netip.Prefix{"a": old["a"]},
+			wantErr:  "post-apply probe",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseFlags(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.ApplyProbe = tt.probe
+			g := newGeoIPGenerator(t.Context(), cfg)
+
+			table := &nftables.Table{Family: nftables.TableFamilyINet, Name: "geoip"}
+			conn := newFakeNetlink(t, table, tt.existing)
+			conn.failFlush = tt.failFlush
+
+			err = g.updateNetlinkSets(conn, table, wanted)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("updateNetlinkSets() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr) || strings.Contains(err.Error(), "rollback failed")) {
+				t.Fatalf("updateNetlinkSets() error = %v, want %q", err, tt.wantErr)
+			}
+
+			if got := conn.ranges(); !reflect.DeepEqual(got, rangesOf(tt.want)) {
+				t.Errorf("sets = %v, want %v", got, rangesOf(tt.want))
+			}
+		})
+	}
+}
+
+// fakeNetlink keeps one table in memory and applies the queued changes on
+// Flush as one transaction, failing like the kernel on missing objects.
+type fakeNetlink struct {
+	table *nftables.Table
+	// Committed state, sets is nil without the table
+	sets map[string][]nftables.SetElement
+	// Changes queued since the last Flush
+	queued []func(sets *map[string][]nftables.SetElement) error
+	// Number of the flush that fails, none when 0
+	failFlush int
+	flushes   int
+}
+
+func newFakeNetlink(t *testing.T, table *nftables.Table, existing map[string][]netip.Prefix) *fakeNetlink {
+	t.Helper()
+
+	f := &fakeNetlink{table: table}
+	if existing == nil {
+		return f
+	}
+	f.sets = make(map[string][]nftables.SetElement)
+	for name, prefixes := range existing {
+		zero := netip.IPv4Unspecified()
+		if prefixes[0].Addr().Is6() {
+			zero = netip.IPv6Unspecified()
+		}
+		f.sets[name] = diffElements(nil, mergeRanges(prefixes), zero).add
+	}
+	return f
+}
+
+// ranges returns the committed sets as ranges, nil without the table.
+func (f *fakeNetlink) ranges() map[string][]addrRange {
+	if f.sets == nil {
+		return nil
+	}
+	out := make(map[string][]addrRange, len(f.sets))
+	for name, elements := range f.sets {
+		out[name] = elementRanges(elements)
+	}
+	return out
+}
+
+func (f *fakeNetlink) queue(change func(sets *map[string][]nftables.SetElement) error) {
+	f.queued = append(f.queued, change)
+}
+
+// fakeSet returns the elements of the named set or ENOENT.
+func fakeSet(sets map[string][]nftables.SetElement, name string) ([]nftables.SetElement, error) {
+	if sets == nil {
+		return nil, fmt.Errorf("table: %w", syscall.ENOENT)
+	}
+	elements, ok := sets[name]
+	if !ok {
+		return nil, fmt.Errorf("set %s: %w", name, syscall.ENOENT)
+	}
+	return elements, nil
+}
+
+func (f *fakeNetlink) AddTable(t *nftables.Table) *nftables.Table {
+	f.queue(func(sets *map[string][]nftables.SetElement) error {
+		if *sets == nil {
+			*sets = make(map[string][]nftables.SetElement)
+		}
+		return nil
+	})
+	return t
+}
+
+func (f *fakeNetlink) DelTable(*nftables.Table) {
+	f.queue(func(sets *map[string][]nftables.SetElement) error {
+		if *sets == nil {
+			return fmt.Errorf("table: %w", syscall.ENOENT)
+		}
+		*sets = nil
+		return nil
+	})
+}
+
+func (f *fakeNetlink) ListTablesOfFamily(nftables.TableFamily) ([]*nftables.Table, error) {
+	if f.sets == nil {
+		return nil, nil
+	}
+	return []*nftables.Table{f.table}, nil
+}
+
+func (f *fakeNetlink) AddSet(s *nftables.Set, vals []nftables.SetElement) error {
+	f.queue(func(sets *map[string][]nftables.SetElement) error {
+		if *sets == nil {
+			return fmt.Errorf("table: %w", syscall.ENOENT)
+		}
+		if _, ok := (*sets)[s.Name]; !ok {
+			(*sets)[s.Name] = slices.Clone(vals)
+		}
+		return nil
+	})
+	return nil
+}
+
+func (f *fakeNetlink) DelSet(s *nftables.Set) {
+	f.queue(func(sets *map[string][]nftables.SetElement) error {
+		if _, err := fakeSet(*sets, s.Name); err != nil {
+			return err
+		}
+		delete(*sets, s.Name)
+		return nil
+	})
+}
+
+func (f *fakeNetlink) FlushSet(s *nftables.Set) {
+	f.queue(func(sets *map[string][]nftables.SetElement) error {
+		if _, err := fakeSet(*sets, s.Name); err != nil {
+			return err
+		}
+		(*sets)[s.Name] = []nftables.SetElement{}
+		return nil
+	})
+}
+
+func (f *fakeNetlink) GetSets(*nftables.Table) ([]*nftables.Set, error) {
+	var out []*nftables.Set
+	for name := range f.sets {
+		out = append(out, &nftables.Set{Table: f.table, Name: name})
+	}
+	return out, nil
+}
+
+func (f *fakeNetlink) GetSetElements(s *nftables.Set) ([]nftables.SetElement, error) {
+	elements, err := fakeSet(f.sets, s.Name)
+	return slices.Clone(elements), err
+}
+
+func (f *fakeNetlink) SetAddElements(s *nftables.Set, vals []nftables.SetElement) error {
+	f.queue(func(sets *map[string][]nftables.SetElement) error {
+		elements, err := fakeSet(*sets, s.Name)
+		if err != nil {
+			return err
+		}
+		(*sets)[s.Name] = append(elements, vals...)
+		return nil
+	})
+	return nil
+}
+
+func (f *fakeNetlink) SetDeleteElements(s *nftables.Set, vals []nftables.SetElement) error {
+	f.queue(func(sets *map[string][]nftables.SetElement) error {
+		elements, err := fakeSet(*sets, s.Name)
+		if err != nil {
+			return err
+		}
+		for _, v := range vals {
+			i := slices.IndexFunc(elements, func(e nftables.SetElement) bool {
+				return slices.Equal(e.Key, v.Key) && e.IntervalEnd == v.IntervalEnd
+			})
+			if i < 0 {
+				return fmt.Errorf("element %v: %w", v.Key, syscall.ENOENT)
+			}
+			elements = slices.Delete(elements, i, i+1)
+		}
+		(*sets)[s.Name] = elements
+		return nil
+	})
+	return nil
+}
+
+func (f *fakeNetlink) Flush() error {
+	queued := f.queued
+	f.queued = nil
+	f.flushes++
+	if f.flushes == f.failFlush {
+		return errors.New("injected failure")
+	}
+
+	var sets map[string][]nftables.SetElement
+	if f.sets != nil {
+		sets = make(map[string][]nftables.SetElement, len(f.sets))
+		for name, elements := range f.sets {
+			sets[name] = slices.Clone(elements)
+		}
+	}
+	for _, change := range queued {
+		if err := change(&sets); err != nil {
+			return err
+		}
+	}
+	f.sets = sets
+	return nil
+}
+
+func rangesOf(sets map[string][]netip.Prefix) map[string][]addrRange {
+	if sets == nil {
+		return nil
+	}
+	out := make(map[string][]addrRange, len(sets))
+	for name, prefixes := range sets {
+		out[name] = mergeRanges(prefixes)
+	}
+	return out
+}
+
+// parseElements reads elements written as an address, followed by " end"
+// for the end of an interval.
+func parseElements(t *testing.T, elements []string) []nftables.SetElement {
+	t.Helper()
+
+	var out []nftables.SetElement
+	for _, s := range elements {
+		addr, end := strings.CutSuffix(s, " end")
+		out = append(out, nftables.SetElement{Key: netip.MustParseAddr(addr).AsSlice(), IntervalEnd: end})
+	}
+	return out
+}
+
+func formatElements(elements []nftables.SetElement) []string {
+	var out []string
+	for _, e := range elements {
+		addr, _ := netip.AddrFromSlice(e.Key)
+		s := addr.String()
+		if e.IntervalEnd {
+			s += " end"
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func parsePrefixes(t *testing.T, prefixes []string) []netip.Prefix {
+	t.Helper()
+
+	var out []netip.Prefix
+	for _, s := range prefixes {
+		out = append(out, netip.MustParsePrefix(s))
+	}
+	return out
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// applyNetlink is only available on Linux.
+func (g *geoIPGenerator) applyNetlink() error {
+	return fmt.Errorf("-apply-method %s is only supported on Linux", applyMethodNetlink)
+}
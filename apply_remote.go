@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	remoteBatchName    = "apply.nft"
+	remoteSnapshotName = "snapshot.nft"
+)
+
+// applyRemote copies the apply files to every host over SSH and loads them
+// there with nft, with the same snapshot and probe handling as a local
+// apply. The probe runs on the remote host. With -canary the first host is
+// applied alone and a failure stops the rollout, otherwise every host is
+// attempted and the failures are reported at the end.
+func (g *geoIPGenerator) applyRemote() error {
+	batch, err := g.buildRemoteBatch()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(batch)
+
+	hosts := g.cfg.Hosts
+	if g.cfg.Canary {
+		slog.Info("Applying to canary first", "host", hosts[0])
+		if err := g.applyHost(hosts[0], batch); err != nil {
+			slog.Error("Apply failed", "host", hosts[0], "error", err)
+			return fmt.Errorf("canary %s failed, %d hosts left untouched: %w", hosts[0], len(hosts)-1, err)
+		}
+		slog.Info("Applied", "host", hosts[0])
+		hosts = hosts[1:]
+	}
+
+	var failed []string
+	for _, host := range hosts {
+		if err := g.applyHost(host, batch); err != nil {
+			slog.Error("Apply failed", "host", host, "error", err)
+			failed = append(failed, host)
+			continue
+		}
+		slog.Info("Applied", "host", host)
+	}
+
+	slog.Info("Applied to hosts", "succeeded", len(g.cfg.Hosts)-len(failed), "total", len(g.cfg.Hosts))
+	if len(failed) > 0 {
+		return fmt.Errorf("apply failed on %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// buildRemoteBatch writes the apply batch with includes pointing into
+// -remote-dir.
+func (g *geoIPGenerator) buildRemoteBatch() (string, error) {
+	seen := make(map[string]string)
+	for _, name := range g.cfg.ApplyFiles {
+		base := filepath.Base(name)
+		if other, ok := seen[base]; ok {
+			return "", fmt.Errorf("-apply-files %s and %s have the same file name", other, name)
+		}
+		seen[base] = name
+	}
+
+	f, err := os.CreateTemp("", "geoip-apply-*.nft")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	err = g.renderApplyBatch(f, func(name string) (string, error) {
+		return path.Join(g.cfg.RemoteDir, filepath.Base(name)), nil
+	})
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// applyHost copies the files to one host, loads them and runs the probe,
+// restoring the snapshot taken before the load when the probe fails.
+func (g *geoIPGenerator) applyHost(host, batch string) error {
+	dir := shellQuote(g.cfg.RemoteDir)
+	nft := shellQuote(g.cfg.NFTBinary)
+
+	if err := runSSH(g.ctx, host, "mkdir -p "+dir); err != nil {
+		return fmt.Errorf("creating %s: %w", g.cfg.RemoteDir, err)
+	}
+
+	args := []string{"-q", "-o", "BatchMode=yes"}
+	for _, name := range g.cfg.ApplyFiles {
+		args = append(args, filepath.Join(g.cfg.OutputDir, name))
+	}
+	args = append(args, batch, host+":"+g.cfg.RemoteDir+"/")
+	if out, err := exec.CommandContext(g.ctx, "scp", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("copying files: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	// scp keeps the temporary name of the batch, the remote script renames
+	// it so that repeated runs overwrite the same file
+	load := fmt.Sprintf("cd %s && mv %s %s && %s list ruleset > %s && %s -f %s",
+		dir, shellQuote(filepath.Base(batch)), remoteBatchName, nft, remoteSnapshotName, nft, remoteBatchName)
+	if err := runSSH(g.ctx, host, load); err != nil {
+		// The batch is a single transaction, a failed load changed nothing
+		return fmt.Errorf("loading sets: %w", err)
+	}
+
+	if g.cfg.ApplyProbe == "" {
+		return nil
+	}
+
+	timeout := max(1, int(time.Duration(g.cfg.ApplyProbeTimeout).Seconds()))
+	probe := fmt.Sprintf("timeout %d sh -c %s", timeout, shellQuote(g.cfg.ApplyProbe))
+	if err := runSSH(g.ctx, host, probe); err != nil {
+		restore := fmt.Sprintf("cd %s && { echo 'flush ruleset'; cat %s; } | %s -f -", dir, remoteSnapshotName, nft)
+		// An interrupted apply still rolls back
+		if rbErr := runSSH(context.WithoutCancel(g.ctx), host, restore); rbErr != nil {
+			return fmt.Errorf("probe failed (%v) and rollback failed: %w", err, rbErr)
+		}
+		return fmt.Errorf("post-apply probe failed, previous ruleset restored: %w", err)
+	}
+	return nil
+}
+
+// runSSH runs a shell command on host without prompting for credentials.
+func runSSH(ctx context.Context, host, command string) error {
+	out, err := exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", host, command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
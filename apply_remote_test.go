@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", `''`},
+		{"/var/lib/geoip", `'/var/lib/geoip'`},
+		{"dir with spaces", `'dir with spaces'`},
+		{"it's", `'it'\''s'`},
+		{"''", `''\'''\'''`},
+		{"$HOME `id` $(id) \\ \" ; | & * ?", `'$HOME ` + "`id`" + ` $(id) \ " ; | & * ?'`},
+		{"line\nbreak", "'line\nbreak'"},
+	}
+	sh, lookErr := exec.LookPath("sh")
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := shellQuote(tt.in)
+			if got != tt.want {
+				t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+
+			// The shell reads the quoted word back as the original string
+			if lookErr != nil {
+				t.Skip("no sh")
+			}
+			out, err := exec.Command(sh, "-c", "printf %s "+got).Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.in {
+				t.Errorf("sh read %q back as %q", got, out)
+			}
+		})
+	}
+}
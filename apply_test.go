@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderApplyBatch(t *testing.T) {
+	const nftFile = `table inet geoip {
+    set AU {
+        type ipv4_addr
+        flags interval
+        elements = { 1.0.0.0/24 }
+    }
+    set DE {
+        type ipv4_addr
+        flags interval
+        elements = { 5.0.0.0/16, 192.0.2.0/24 }
+    }
+}
+`
+	const nftIPv6File = `table inet geoip {
+    set DE {
+        type ipv6_addr
+        flags interval
+        elements = { 2001:db8::/32 }
+    }
+}
+`
+	const jsonFile = `{"nftables": [
+{"metainfo": {"json_schema_version": 1}},
+{"table": {"family": "inet", "name": "geoip"}},
+{"set": {"family": "inet", "table": "geoip", "name": "DE", "type": "ipv4_addr", "flags": ["interval"], "elem": [{"prefix": {"addr": "5.0.0.0", "len": 16}}, {"prefix": {"addr": "192.0.2.0", "len": 24}}]}},
+{"set": {"family": "inet", "table": "geoip", "name": "AU", "type": "ipv4_addr", "flags": ["interval"], "elem": [{"prefix": {"addr": "1.0.0.0", "len": 24}}]}}
+]}
+`
+
+	tests := []struct {
+		name  string
+		args  []string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "nft",
+			args:  []string{"-apply-files", "geoip_ipv4.nft"},
+			files: map[string]string{"geoip_ipv4.nft": nftFile},
+			want: `add table inet geoip
+add set inet geoip AU { type ipv4_addr; flags interval; }
+flush set inet geoip AU
+add set inet geoip DE { type ipv4_addr; flags interval; }
+flush set inet geoip DE
+include "/remote/geoip_ipv4.nft"
+`,
+		},
+		{
+			name:  "ipv6",
+			args:  []string{"-apply-files", "geoip_ipv6.nft", "-table-family", "ip6", "-table", "filter"},
+			files: map[string]string{"geoip_ipv6.nft": nftIPv6File},
+			want: `add table ip6 filter
+add set ip6 filter DE { type ipv6_addr; flags interval; }
+flush set ip6 filter DE
+include "/remote/geoip_ipv6.nft"
+`,
+		},
+		{
+			name:  "no table",
+			args:  []string{"-apply-files", "geoip_ipv4.nft", "-no-table"},
+			files: map[string]string{"geoip_ipv4.nft": nftFile},
+			want: `add table inet geoip
+add set inet geoip AU { type ipv4_addr; flags interval; }
+flush set inet geoip AU
+add set inet geoip DE { type ipv4_addr; flags interval; }
+flush set inet geoip DE
+table inet geoip {
+    include "/remote/geoip_ipv4.nft"
+}
+`,
+		},
+		{
+			name:  "auto-merge",
+			args:  []string{"-apply-files", "geoip_ipv6.nft", "-target-nft-version", "0.9.0"},
+			files: map[string]string{"geoip_ipv6.nft": nftIPv6File},
+			want: `add table inet geoip
+add set inet geoip DE { type ipv6_addr; flags interval; auto-merge; }
+flush set inet geoip DE
+include "/remote/geoip_ipv6.nft"
+`,
+		},
+		{
+			name:  "nft-json",
+			args:  []string{"-apply-files", "geoip_ipv4.json", "-format", "nft-json"},
+			files: map[string]string{"geoip_ipv4.json": jsonFile},
+			want: `add table inet geoip
+add set inet geoip AU { type ipv4_addr; flags interval; }
+flush set inet geoip AU
+add set inet geoip DE { type ipv4_addr; flags interval; }
+flush set inet geoip DE
+add element inet geoip AU { 1.0.0.0/24 }
+add element inet geoip DE { 5.0.0.0/16, 192.0.2.0/24 }
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg, err := parseFlags(append([]string{"-output-dir", dir}, tt.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			g := newGeoIPGenerator(t.Context(), cfg)
+			if err := g.resolveNFTFeatures(); err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			err = g.renderApplyBatch(&b, func(name string) (string, error) {
+				return "/remote/" + name, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("batch differs\ngot:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// historySnapshotFile describes a snapshot in its directory
+	historySnapshotFile = "snapshot.json"
+	// historyCurrentFile names the snapshot that is applied right now
+	historyCurrentFile = "current"
+	// historyTimeFormat names the snapshot directories, sorting by name
+	// sorts them by time
+	historyTimeFormat = "20060102T150405.000Z"
+)
+
+// historySnapshot is the snapshot.json of an applied version.
+type historySnapshot struct {
+	Applied time.Time `json:"applied"`
+	Files   []string  `json:"files"`
+}
+
+// recordApply copies the applied files to a new snapshot in -apply-history,
+// marks it as current and removes the snapshots beyond -apply-history-keep.
+func (g *geoIPGenerator) recordApply() error {
+	// Copy into a hidden directory first, so an interrupted copy never
+	// shows up as a snapshot
+	now := time.Now().UTC()
+	name := now.Format(historyTimeFormat)
+	tmp := filepath.Join(g.cfg.ApplyHistory, fmt.Sprintf(".snapshot-%s-%d", name, os.Getpid()))
+	if err := g.makeOutputDir(tmp); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, file := range g.cfg.ApplyFiles {
+		if err := g.copyOutput(filepath.Join(g.cfg.OutputDir, file), filepath.Join(tmp, file)); err != nil {
+			return err
+		}
+	}
+
+	snapshot := historySnapshot{Applied: now, Files: g.cfg.ApplyFiles}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := g.writeOutputData(filepath.Join(tmp, historySnapshotFile), append(data, '\n')); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(g.cfg.ApplyHistory, name)); err != nil {
+		return err
+	}
+	if err := g.setCurrentSnapshot(name); err != nil {
+		return err
+	}
+	slog.Info("Recorded applied version", "snapshot", name)
+
+	return g.pruneHistory(name)
+}
+
+// rollback applies the snapshot -rollback versions before the current one.
+// The history itself is kept, so a later rollback or apply moves on from
+// the restored version.
+func (g *geoIPGenerator) rollback() error {
+	snapshots, err := listSnapshots(g.cfg.ApplyHistory)
+	if err != nil {
+		return err
+	}
+	current, err := g.currentSnapshot()
+	if err != nil {
+		return err
+	}
+
+	i := slices.Index(snapshots, current)
+	if i < 0 {
+		return fmt.Errorf("current version %q is not in %s", current, g.cfg.ApplyHistory)
+	}
+	if int(g.cfg.Rollback) > i {
+		return fmt.Errorf("cannot go back %d versions, %s holds %d before the current one",
+			g.cfg.Rollback, g.cfg.ApplyHistory, i)
+	}
+	name := snapshots[i-int(g.cfg.Rollback)]
+
+	dir := filepath.Join(g.cfg.ApplyHistory, name)
+	snapshot, err := readSnapshot(dir)
+	if err != nil {
+		return err
+	}
+
+	// Apply the snapshot as if it were the output directory
+	restore := *g
+	restore.cfg.OutputDir, restore.cfg.ApplyFiles = dir, snapshot.Files
+	if err := restore.applyFiles(); err != nil {
+		return err
+	}
+	if err := g.setCurrentSnapshot(name); err != nil {
+		return err
+	}
+
+	slog.Info("Rolled back", "snapshot", name, "applied", snapshot.Applied, "previous", current)
+	return nil
+}
+
+// listSnapshots returns the snapshot names of dir, oldest first.
+func listSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if _, err := time.Parse(historyTimeFormat, entry.Name()); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func readSnapshot(dir string) (*historySnapshot, error) {
+	data, err := os.ReadFile(filepath.Join(dir, historySnapshotFile))
+	if err != nil {
+		return nil, err
+	}
+	var snapshot historySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", filepath.Join(dir, historySnapshotFile), err)
+	}
+	if len(snapshot.Files) == 0 {
+		return nil, fmt.Errorf("snapshot %s lists no files", dir)
+	}
+	return &snapshot, nil
+}
+
+// currentSnapshot returns the name of the applied snapshot. Without a
+// marker the newest snapshot is taken.
+func (g *geoIPGenerator) currentSnapshot() (string, error) {
+	data, err := os.ReadFile(filepath.Join(g.cfg.ApplyHistory, historyCurrentFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		snapshots, err := listSnapshots(g.cfg.ApplyHistory)
+		if err != nil {
+			return "", err
+		}
+		if len(snapshots) == 0 {
+			return "", fmt.Errorf("%s holds no applied versions", g.cfg.ApplyHistory)
+		}
+		return snapshots[len(snapshots)-1], nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (g *geoIPGenerator) setCurrentSnapshot(name string) error {
+	return g.writeOutputData(filepath.Join(g.cfg.ApplyHistory, historyCurrentFile), []byte(name+"\n"))
+}
+
+// pruneHistory removes the oldest snapshots beyond -apply-history-keep,
+// never the current one.
+func (g *geoIPGenerator) pruneHistory(current string) error {
+	snapshots, err := listSnapshots(g.cfg.ApplyHistory)
+	if err != nil {
+		return err
+	}
+
+	excess := len(snapshots) - g.cfg.ApplyHistoryKeep
+	for _, name := range snapshots {
+		if excess <= 0 {
+			break
+		}
+		if name == current {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(g.cfg.ApplyHistory, name)); err != nil {
+			return err
+		}
+		excess--
+		slog.Debug("Removed old snapshot", "snapshot", name)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log/slog"
+	"net/netip"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// Special-purpose ranges from the IANA IPv4 and IPv6 Special-Purpose Address
+// Registries plus multicast and the reserved class E space. Transition
+// ranges that are globally reachable (6to4, Teredo, NAT64) are not included.
+var reservedIPv4 = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network", RFC 791
+	netip.MustParsePrefix("10.0.0.0/8"),      // Private-Use, RFC 1918
+	netip.MustParsePrefix("100.64.0.0/10"),   // Shared Address Space, RFC 6598
+	netip.MustParsePrefix("127.0.0.0/8"),     // Loopback, RFC 1122
+	netip.MustParsePrefix("169.254.0.0/16"),  // Link Local, RFC 3927
+	netip.MustParsePrefix("172.16.0.0/12"),   // Private-Use, RFC 1918
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF Protocol Assignments, RFC 6890
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation (TEST-NET-1), RFC 5737
+	netip.MustParsePrefix("192.88.99.0/24"),  // Deprecated 6to4 Relay Anycast, RFC 7526
+	netip.MustParsePrefix("192.168.0.0/16"),  // Private-Use, RFC 1918
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking, RFC 2544
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation (TEST-NET-2), RFC 5737
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation (TEST-NET-3), RFC 5737
+	netip.MustParsePrefix("224.0.0.0/4"),     // Multicast, RFC 5771
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved and Limited Broadcast, RFC 1112, RFC 919
+}
+
+var reservedIPv6 = []netip.Prefix{
+	netip.MustParsePrefix("::/128"),         // Unspecified Address, RFC 4291
+	netip.MustParsePrefix("::1/128"),        // Loopback Address, RFC 4291
+	netip.MustParsePrefix("::ffff:0:0/96"),  // IPv4-mapped Address, RFC 4291
+	netip.MustParsePrefix("64:ff9b:1::/48"), // IPv4-IPv6 Translation, RFC 8215
+	netip.MustParsePrefix("100::/64"),       // Discard-Only Address Block, RFC 6666
+	netip.MustParsePrefix("2001:2::/48"),    // Benchmarking, RFC 5180
+	netip.MustParsePrefix("2001:10::/28"),   // Deprecated ORCHID, RFC 4843
+	netip.MustParsePrefix("2001:db8::/32"),  // Documentation, RFC 3849
+	netip.MustParsePrefix("3fff::/20"),      // Documentation, RFC 9637
+	netip.MustParsePrefix("5f00::/16"),      // Segment Routing SIDs, RFC 9602
+	netip.MustParsePrefix("fc00::/7"),       // Unique-Local, RFC 4193
+	netip.MustParsePrefix("fe80::/10"),      // Link-Local Unicast, RFC 4291
+	netip.MustParsePrefix("fec0::/10"),      // Deprecated Site-Local, RFC 3879
+	netip.MustParsePrefix("ff00::/8"),       // Multicast, RFC 4291
+}
+
+// stripReserved removes special-purpose ranges from every set.
+func (g *geoIPGenerator) stripReserved() {
+	before := countPrefixes(g.ipv4) + countPrefixes(g.ipv6)
+
+	g.ipv4.Subtract(geonft.MergePrefixes(reservedIPv4))
+	g.ipv6.Subtract(geonft.MergePrefixes(reservedIPv6))
+
+	after := countPrefixes(g.ipv4) + countPrefixes(g.ipv6)
+	slog.Info("Stripped reserved ranges", "prefixes_before", before, "prefixes_after", after)
+}
+
+// addBogonSet adds the special-purpose ranges as a standalone set.
+func (g *geoIPGenerator) addBogonSet(name string) {
+	g.ipv4[name] = geonft.PackPrefixes(geonft.MergePrefixes(reservedIPv4))
+	g.ipv6[name] = geonft.PackPrefixes(geonft.MergePrefixes(reservedIPv6))
+}
+
+func countPrefixes(countryMap geonft.Sets) int {
+	total := 0
+	for _, prefixes := range countryMap {
+		total += prefixes.Len()
+	}
+	return total
+}
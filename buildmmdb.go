@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/inserter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// buildDatabaseType is stored in the metadata of build-mmdb databases. The
+// records follow the GeoLite2 layout, so the schema is detected like for
+// a GeoLite2 database.
+const buildDatabaseType = "GeoLite2-Country"
+
+// buildMMDB writes a country database to -build-output from the
+// -build-inputs, so that corrected or curated sets can be fed back into
+// the toolchain. More specific networks win over broader ones and later
+// inputs win over earlier ones for identical prefixes, like geofeeds.
+func (g *geoIPGenerator) buildMMDB() error {
+	var entries []geofeedEntry
+	for _, source := range g.cfg.BuildInputs {
+		list, err := g.loadBuildInput(source)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", source, err)
+		}
+		entries = append(entries, list...)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no networks in %s", strings.Join(g.cfg.BuildInputs, ", "))
+	}
+	slices.SortStableFunc(entries, func(a, b geofeedEntry) int {
+		return a.prefix.Bits() - b.prefix.Bits()
+	})
+
+	tree, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            buildDatabaseType,
+		Description:             map[string]string{"en": "Country database built by maxminddb-to-nft"},
+		Languages:               []string{"en"},
+		IncludeReservedNetworks: true,
+		// Aliasing maps ::ffff:0:0/96, 2001::/32 and 2002::/16 onto the
+		// IPv4 space, which rejects the 6to4 prefixes of -transition-ranges
+		// derive
+		DisableIPv4Aliasing: true,
+	})
+	if err != nil {
+		return fmt.Errorf("creating database: %w", err)
+	}
+
+	records := make(map[string]mmdbtype.Map)
+	codes := make(map[string]bool)
+	for _, e := range entries {
+		ipNet := &net.IPNet{IP: e.prefix.Addr().AsSlice(), Mask: net.CIDRMask(e.prefix.Bits(), e.prefix.Addr().BitLen())}
+		if e.code == "" {
+			// An unattributed geofeed entry removes the broader assignment
+			err = tree.InsertFunc(ipNet, inserter.Remove)
+		} else {
+			if records[e.code] == nil {
+				records[e.code] = countryRecord(e.code)
+			}
+			codes[e.code] = true
+			err = tree.Insert(ipNet, records[e.code])
+		}
+		if err != nil {
+			return fmt.Errorf("inserting %s: %w", e.prefix, err)
+		}
+	}
+
+	err = g.writeOutput(g.cfg.BuildOutput, func(w io.Writer) error {
+		_, err := tree.WriteTo(w)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Built database", "path", g.cfg.BuildOutput, "networks", len(entries), "countries", len(codes))
+	return nil
+}
+
+// countryRecord returns the GeoLite2 record of code, with the names and
+// continent where the code is known.
+func countryRecord(code string) mmdbtype.Map {
+	country := mmdbtype.Map{"iso_code": mmdbtype.String(code)}
+	record := mmdbtype.Map{"country": country, "registered_country": country}
+	info, ok := lookupCountry(code)
+	if !ok {
+		return record
+	}
+	country["names"] = mmdbtype.Map{"en": mmdbtype.String(info.Name)}
+	if info.Continent != "" {
+		record["continent"] = mmdbtype.Map{
+			"code":  mmdbtype.String(info.Continent),
+			"names": mmdbtype.Map{"en": mmdbtype.String(continentNames[info.Continent])},
+		}
+	}
+	return record
+}
+
+// buildListExtensions are read as prefix lists when walking a directory,
+// which skips signatures and checksums next to them
+var buildListExtensions = map[string]bool{"": true, ".txt": true, ".zone": true, ".netset": true, ".list": true}
+
+// loadBuildInput reads the assignments of one input: an nft file with sets
+// named by country, an RFC 8805 geofeed ending in .csv or served over
+// http(s), or a list of prefixes named after its country, like US.txt or
+// us-aggregated.zone. Directories are walked for such files.
+func (g *geoIPGenerator) loadBuildInput(source string) ([]geofeedEntry, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return g.loadGeofeed(g.ctx, source)
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return g.loadBuildFile(source, true)
+	}
+
+	var entries []geofeedEntry
+	err = filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		list, err := g.loadBuildFile(path, false)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, list...)
+		return nil
+	})
+	return entries, err
+}
+
+// loadBuildFile reads a file of loadBuildInput. Files in a directory that
+// are neither nft files, geofeeds nor lists named after a country are
+// skipped, explicit ones are an error.
+func (g *geoIPGenerator) loadBuildFile(path string, explicit bool) ([]geofeedEntry, error) {
+	switch filepath.Ext(path) {
+	case ".nft":
+		return g.loadBuildNFT(path)
+	case ".csv":
+		return g.loadGeofeed(g.ctx, path)
+	}
+
+	if !explicit && !buildListExtensions[filepath.Ext(path)] {
+		slog.Debug("Skipped file that is not a prefix list", "path", path)
+		return nil, nil
+	}
+	name := filepath.Base(path)
+	if i := strings.IndexAny(name, ".-_"); i >= 0 {
+		name = name[:i]
+	}
+	code := strings.ToUpper(name)
+	if !geonft.ValidCountryCode(code) {
+		if explicit {
+			return nil, fmt.Errorf("file name does not start with a country code")
+		}
+		slog.Debug("Skipped file not named after a country", "path", path)
+		return nil, nil
+	}
+	if !g.validator.accepts(code) {
+		slog.Warn("Skipped list with rejected country code", "path", path, "code", code)
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []geofeedEntry
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		prefix, err := parseGeofeedPrefix(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, geofeedEntry{prefix: prefix, code: code})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// loadBuildNFT reads the country sets of an nft file. Other sets, like
+// the bogon set or those of -dimensions, are skipped.
+func (g *geoIPGenerator) loadBuildNFT(path string) ([]geofeedEntry, error) {
+	sets, err := readNFTSets(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var entries []geofeedEntry
+	for _, name := range names {
+		if !g.validator.accepts(name) {
+			slog.Debug("Skipped set not named by country", "path", path, "set", name)
+			continue
+		}
+		for _, p := range sets[name] {
+			entries = append(entries, geofeedEntry{prefix: geonft.UnmapPrefix(p.Masked()), code: name})
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kkrow/maxminddb-to-nft/internal/mmdbfixture"
+)
+
+// TestBuildMMDBRoundTrip builds a database from the output of
+// -transition-ranges derive, whose IPv6 sets hold 6to4 prefixes, and
+// checks that generating from it writes the same sets again.
+func TestBuildMMDBRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "fixture.mmdb")
+	built := filepath.Join(dir, "built.mmdb")
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	writeFixture(t, input, mmdbfixture.Options{})
+
+	generate(t, "-input", input, "-output-dir", first, "-transition-ranges", "derive")
+
+	cfg, err := parseFlags([]string{"-build-inputs", first, "-build-output", built})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newGeoIPGenerator(t.Context(), cfg).buildMMDB(); err != nil {
+		t.Fatal(err)
+	}
+
+	generate(t, "-input", built, "-output-dir", second)
+
+	for _, name := range []string{"geoip_ipv4.nft", "geoip_ipv6.nft"} {
+		want, err := os.ReadFile(filepath.Join(first, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(second, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s differs after the round trip\ngot:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+}
+
+func generate(t *testing.T, args ...string) {
+	t.Helper()
+
+	cfg, err := parseFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newGeoIPGenerator(t.Context(), cfg).run(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// check re-derives the expected sets from the database and compares them
+// with the files in the output directory. Files are reported as missing,
+// divergent (content differs) or stale (no longer produced).
+func (g *geoIPGenerator) check() error {
+	if err := g.resolveNFTFeatures(); err != nil {
+		return err
+	}
+	if err := g.prepare(); err != nil {
+		return err
+	}
+
+	expected := make(map[string]bool)
+	var missing, divergent, stale []string
+
+	for _, a := range g.artifacts() {
+		expected[a.path] = true
+
+		var want bytes.Buffer
+		if err := a.render(&want); err != nil {
+			return fmt.Errorf("rendering %s: %w", a.path, err)
+		}
+
+		have, err := os.ReadFile(filepath.Join(g.cfg.OutputDir, a.path))
+		if errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, a.path)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", a.path, err)
+		}
+
+		if !bytes.Equal(have, want.Bytes()) {
+			divergent = append(divergent, a.path)
+		}
+	}
+
+	// Files of sets that no longer exist
+	countryDir := filepath.Join(g.cfg.OutputDir, "by_country")
+	err := filepath.WalkDir(countryDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != g.cfg.setFileExt() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(g.cfg.OutputDir, path)
+		if err != nil {
+			return err
+		}
+		if !expected[rel] {
+			stale = append(stale, rel)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("scanning %s: %w", countryDir, err)
+	}
+
+	for _, path := range missing {
+		slog.Error("Missing file", "path", path)
+	}
+	for _, path := range divergent {
+		slog.Error("Divergent file", "path", path)
+	}
+	for _, path := range stale {
+		slog.Error("Stale file", "path", path)
+	}
+
+	if problems := len(missing) + len(divergent) + len(stale); problems > 0 {
+		return withExitCode(exitVerification, "%d of %d files do not match the database (%d missing, %d divergent, %d stale)",
+			problems, len(expected), len(missing), len(divergent), len(stale))
+	}
+
+	slog.Info("All files match the database", "files", len(expected))
+	return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/netip"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+	"golang.org/x/sync/errgroup"
+)
+
+// attributedRange is a run of addresses assigned to one set.
+type attributedRange struct {
+	first, last netip.Addr
+	code        string
+}
+
+// attributionSegment is a run of addresses with the set of each source,
+// empty where a source assigns none.
+type attributionSegment struct {
+	first, last netip.Addr
+	a, b        string
+}
+
+// agreement counts the addresses of one set by source attribution.
+type agreement struct {
+	both, onlyA, onlyB *big.Int
+}
+
+// compare builds the sets from -input and -compare-input and reports per
+// set how much of the address space both sources attribute the same way.
+// Geofeeds and the bogon set are left out, they would hide the
+// differences of the sources.
+func (g *geoIPGenerator) compare() error {
+	cfgA := g.cfg
+	cfgA.Geofeeds, cfgA.BogonSet = nil, ""
+	cfgB := cfgA
+	cfgB.Input, cfgB.Schema = g.cfg.CompareInput, geonft.SchemaAuto
+
+	a, b := newGeoIPGenerator(g.ctx, cfgA), newGeoIPGenerator(g.ctx, cfgB)
+
+	// Both databases are fetched together, sharing -source-concurrency
+	group, ctx := errgroup.WithContext(g.ctx)
+	group.SetLimit(g.cfg.SourceConcurrency)
+	srcA, srcB := a.goFetchSources(ctx, group), b.goFetchSources(ctx, group)
+	if err := group.Wait(); err != nil {
+		srcA.close()
+		srcB.close()
+		return err
+	}
+
+	if err := a.prepareSources(*srcA); err != nil {
+		srcB.close()
+		return fmt.Errorf("first source: %w", err)
+	}
+	if err := b.prepareSources(*srcB); err != nil {
+		return fmt.Errorf("second source: %w", err)
+	}
+
+	families := []struct {
+		name     string
+		a, b     geonft.Sets
+		segments []attributionSegment
+	}{{name: "ipv4", a: a.ipv4, b: b.ipv4}, {name: "ipv6", a: a.ipv6, b: b.ipv6}}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, family := range families {
+		families[i].segments = compareRanges(attributedRanges(family.a), attributedRanges(family.b))
+		printAgreement(w, family.name, families[i].segments)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if g.cfg.CompareReport == "" {
+		return nil
+	}
+	err := g.writeOutput(g.cfg.CompareReport, func(w io.Writer) error {
+		report := csv.NewWriter(w)
+		report.Write([]string{"family", "network", "first_source", "second_source"})
+		for _, family := range families {
+			for _, s := range family.segments {
+				if s.a == s.b {
+					continue
+				}
+				for _, p := range geonft.RangePrefixes(s.first, s.last) {
+					report.Write([]string{family.name, p.String(), s.a, s.b})
+				}
+			}
+		}
+		report.Flush()
+		return report.Error()
+	})
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", g.cfg.CompareReport, err)
+	}
+	slog.Info("Generated file", "path", g.cfg.CompareReport)
+	return nil
+}
+
+// attributedRanges flattens the sets into ranges sorted by address.
+func attributedRanges(countryMap geonft.Sets) []attributedRange {
+	var ranges []attributedRange
+	for code, prefixes := range countryMap {
+		for p := range prefixes.All() {
+			ranges = append(ranges, attributedRange{p.Addr(), geonft.PrefixLast(p), code})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].first.Less(ranges[j].first)
+	})
+	return ranges
+}
+
+// compareRanges walks both sorted range lists at once and returns the
+// segments covered by at least one of them, adjacent segments with the
+// same attribution merged. A range overlapping an earlier one of the same
+// source is cut to its uncovered part.
+func compareRanges(a, b []attributedRange) []attributionSegment {
+	var segments []attributionSegment
+	var pos netip.Addr
+	i, j := 0, 0
+	for {
+		// Drop ranges entirely before the current position
+		for pos.IsValid() && i < len(a) && a[i].last.Less(pos) {
+			i++
+		}
+		for pos.IsValid() && j < len(b) && b[j].last.Less(pos) {
+			j++
+		}
+		if i == len(a) && j == len(b) {
+			return segments
+		}
+
+		// Jump over addresses neither source assigns
+		covers := func(r []attributedRange, k int) bool {
+			return pos.IsValid() && k < len(r) && !pos.Less(r[k].first)
+		}
+		if !covers(a, i) && !covers(b, j) {
+			switch {
+			case i == len(a):
+				pos = b[j].first
+			case j == len(b) || a[i].first.Less(b[j].first):
+				pos = a[i].first
+			default:
+				pos = b[j].first
+			}
+		}
+
+		seg := attributionSegment{first: pos}
+		var ends []netip.Addr
+		if i < len(a) {
+			if !pos.Less(a[i].first) {
+				seg.a = a[i].code
+				ends = append(ends, a[i].last)
+			} else {
+				ends = append(ends, a[i].first.Prev())
+			}
+		}
+		if j < len(b) {
+			if !pos.Less(b[j].first) {
+				seg.b = b[j].code
+				ends = append(ends, b[j].last)
+			} else {
+				ends = append(ends, b[j].first.Prev())
+			}
+		}
+		seg.last = ends[0]
+		for _, end := range ends[1:] {
+			if end.Less(seg.last) {
+				seg.last = end
+			}
+		}
+
+		if n := len(segments); n > 0 && segments[n-1].a == seg.a && segments[n-1].b == seg.b &&
+			segments[n-1].last.Next() == seg.first {
+			segments[n-1].last = seg.last
+		} else {
+			segments = append(segments, seg)
+		}
+
+		pos = seg.last.Next()
+		if !pos.IsValid() {
+			return segments
+		}
+	}
+}
+
+// printAgreement prints one row per set with the share of its addresses,
+// in either source, that both sources attribute to it.
+func printAgreement(w *tabwriter.Writer, family string, segments []attributionSegment) {
+	sets := make(map[string]*agreement)
+	get := func(code string) *agreement {
+		if sets[code] == nil {
+			sets[code] = &agreement{new(big.Int), new(big.Int), new(big.Int)}
+		}
+		return sets[code]
+	}
+
+	same, union := new(big.Int), new(big.Int)
+	for _, s := range segments {
+		size := geonft.RangeSize(s.first, s.last)
+		union.Add(union, size)
+		switch {
+		case s.a == s.b:
+			same.Add(same, size)
+			get(s.a).both.Add(get(s.a).both, size)
+			continue
+		case s.a != "":
+			get(s.a).onlyA.Add(get(s.a).onlyA, size)
+		}
+		if s.b != "" {
+			get(s.b).onlyB.Add(get(s.b).onlyB, size)
+		}
+	}
+
+	codes := make([]string, 0, len(sets))
+	inA := make(map[string]*big.Int, len(sets))
+	for code, c := range sets {
+		codes = append(codes, code)
+		inA[code] = new(big.Int).Add(c.both, c.onlyA)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if c := inA[codes[i]].Cmp(inA[codes[j]]); c != 0 {
+			return c > 0
+		}
+		return codes[i] < codes[j]
+	})
+
+	fmt.Fprintf(w, "%s: %.2f%% of %s addresses attributed the same\n", family, percentage(same, union), union)
+	fmt.Fprintln(w, "SET\tNAME\tAGREEMENT %\tFIRST SOURCE\tSECOND SOURCE")
+	for _, code := range codes {
+		c := sets[code]
+		name := ""
+		if info, ok := lookupCountry(code); ok {
+			name = info.Name
+		}
+		total := new(big.Int).Add(c.both, c.onlyA)
+		total.Add(total, c.onlyB)
+		fmt.Fprintf(w, "%s\t%s\t%.2f\t%s\t%s\n", code, name, percentage(c.both, total),
+			inA[code], new(big.Int).Add(c.both, c.onlyB))
+	}
+	fmt.Fprintln(w)
+}
+
+func percentage(part, whole *big.Int) float64 {
+	if whole.Sign() == 0 {
+		return 100
+	}
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(part), new(big.Float).SetInt(whole)).Float64()
+	return ratio * 100
+}
@@ -0,0 +1,1066 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+type config struct {
+	ConfigFile          string   `json:"-"`
+	Input               string   `json:"input"`
+	OutputDir           string   `json:"output_dir"`
+	FileMode            fileMode `json:"file_mode"`
+	DirMode             fileMode `json:"dir_mode"`
+	Umask               fileMode `json:"umask"`
+	Owner               string   `json:"owner"`
+	RepresentedCountry  string   `json:"represented_country"`
+	Schema              string   `json:"schema"`
+	LookupPath          string   `json:"lookup_path"`
+	CodeValidation      string   `json:"code_validation"`
+	AllowCodes          []string `json:"allow_codes"`
+	UnknownSet          string   `json:"unknown_set"`
+	Geofeeds            []string `json:"geofeeds"`
+	StripReserved       bool     `json:"strip_reserved"`
+	BogonSet            string   `json:"bogon_set"`
+	NamesFormats        []string `json:"names_formats"`
+	SetNaming           string   `json:"set_naming"`
+	NFTComments         bool     `json:"nft_comments"`
+	Table               string   `json:"table"`
+	TableFamily         string   `json:"table_family"`
+	NoTable             bool     `json:"no_table"`
+	Format              string   `json:"format"`
+	Locales             []string `json:"locales"`
+	TransitionRanges    string   `json:"transition_ranges"`
+	MinPrefixIPv4       int      `json:"min_prefix_ipv4"`
+	MinPrefixIPv6       int      `json:"min_prefix_ipv6"`
+	Strict              bool     `json:"strict"`
+	MaxDecodeErrors     int      `json:"max_decode_errors"`
+	SkipReport          string   `json:"skip_report"`
+	ExpectDatabaseType  string   `json:"expect_database_type"`
+	MaxAge              duration `json:"max_age"`
+	WarnAge             duration `json:"warn_age"`
+	NFTCheck            bool     `json:"nft_check"`
+	NFTBinary           string   `json:"nft_binary"`
+	TargetNFTVersion    string   `json:"target_nft_version"`
+	Samples             int      `json:"samples"`
+	Seed                uint64   `json:"seed"`
+	StateFile           string   `json:"state_file"`
+	DiffFile            string   `json:"diff_file"`
+	MaxChangePercent    float64  `json:"max_change_percent"`
+	Force               bool     `json:"force"`
+	ApplyMethod         string   `json:"apply_method"`
+	ApplyFiles          []string `json:"apply_files"`
+	ApplyProbe          string   `json:"apply_probe"`
+	ApplyProbeTimeout   duration `json:"apply_probe_timeout"`
+	ApplyHistory        string   `json:"apply_history"`
+	ApplyHistoryKeep    int      `json:"apply_history_keep"`
+	Rollback            rollback `json:"-"`
+	Hosts               []string `json:"hosts"`
+	Canary              bool     `json:"canary"`
+	RemoteDir           string   `json:"remote_dir"`
+	Publish             []string `json:"publish"`
+	PublishDelete       bool     `json:"publish_delete"`
+	PublishDryRun       bool     `json:"publish_dry_run"`
+	PublishCacheControl string   `json:"publish_cache_control"`
+	GitRepo             string   `json:"git_repo"`
+	GitBranch           string   `json:"git_branch"`
+	GitPath             string   `json:"git_path"`
+	GitMessage          string   `json:"git_message"`
+	Listen              string   `json:"listen"`
+	TLSCert             string   `json:"tls_cert"`
+	TLSKey              string   `json:"tls_key"`
+	ACMEDomains         []string `json:"acme_domains"`
+	ACMECache           string   `json:"acme_cache"`
+	ACMEEmail           string   `json:"acme_email"`
+	AuthTokens          []string `json:"auth_tokens"`
+	AuthUsers           []string `json:"auth_users"`
+	ServeRateLimit      string   `json:"serve_rate_limit"`
+	RefreshInterval     duration `json:"refresh_interval"`
+	Schedule            string   `json:"schedule"`
+	Timezone            string   `json:"timezone"`
+	Jitter              duration `json:"jitter"`
+	DaemonApply         bool     `json:"daemon_apply"`
+	Watch               bool     `json:"watch"`
+	WatchDelay          duration `json:"watch_delay"`
+	ASNInput            string   `json:"asn_input"`
+	GRPCListen          string   `json:"grpc_listen"`
+	HealthListen        string   `json:"health_listen"`
+	StaleAfter          duration `json:"stale_after"`
+	TextfileDir         string   `json:"textfile_dir"`
+	Webhooks            []string `json:"webhooks"`
+	WebhookFormat       string   `json:"webhook_format"`
+	LogLevel            string   `json:"log_level"`
+	LogFormat           string   `json:"log_format"`
+	LogOutput           string   `json:"log_output"`
+	JSON                bool     `json:"json"`
+	SummaryFile         string   `json:"summary_file"`
+	Stats               bool     `json:"stats"`
+	HTMLIndex           bool     `json:"html_index"`
+	StatsInput          string   `json:"stats_input"`
+	StatsFamily         string   `json:"stats_family"`
+	StatsSort           string   `json:"stats_sort"`
+	Top                 int      `json:"top"`
+	FewerThan           int      `json:"fewer_than"`
+	CompareInput        string   `json:"compare_input"`
+	CompareReport       string   `json:"compare_report"`
+	BuildInputs         []string `json:"build_inputs"`
+	BuildOutput         string   `json:"build_output"`
+	Sign                string   `json:"sign"`
+	SignKey             string   `json:"sign_key"`
+	Workers             int      `json:"workers"`
+	SourceConcurrency   int      `json:"source_concurrency"`
+	SourceFailure       string   `json:"source_failure"`
+	Stream              bool     `json:"stream"`
+	Families            []string `json:"families"`
+	Within              []string `json:"within"`
+	Filter              string   `json:"filter"`
+	Dimensions          []string `json:"dimensions"`
+	RateLimits          []string `json:"rate_limits"`
+	RateLimitHook       string   `json:"rate_limit_hook"`
+	Fwmarks             []string `json:"fwmarks"`
+	FwmarkRoutes        []string `json:"fwmark_routes"`
+	FwmarkTable         int      `json:"fwmark_table"`
+	Pprof               string   `json:"pprof"`
+	CPUProfile          string   `json:"cpu_profile"`
+	Trace               string   `json:"trace"`
+	MaxMemory           byteSize `json:"max_memory"`
+	Incremental         bool     `json:"incremental"`
+}
+
+// stringList is a comma separated flag value
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// duration is a time.Duration that also accepts a day suffix like "14d",
+// both as a flag and as a JSON string.
+type duration time.Duration
+
+func (d duration) String() string {
+	td := time.Duration(d)
+	if td > 0 && td%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(td/(24*time.Hour))) + "d"
+	}
+	return td.String()
+}
+
+func (d *duration) Set(value string) error {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*d = duration(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+
+	td, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = duration(td)
+	return nil
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"14d\" or \"12h\"")
+	}
+	return d.Set(s)
+}
+
+// byteSize is a number of bytes with an optional binary unit like "512M"
+// or "1GiB", both as a flag and as a JSON string.
+type byteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}}
+
+func (b byteSize) String() string {
+	for _, unit := range byteUnits {
+		if b > 0 && int64(b)%unit.size == 0 {
+			return strconv.FormatInt(int64(b)/unit.size, 10) + unit.suffix + "iB"
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+func (b *byteSize) Set(value string) error {
+	number, multiplier := strings.TrimSpace(value), int64(1)
+	number = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(number), "B"), "I")
+	for _, unit := range byteUnits {
+		if n, ok := strings.CutSuffix(number, unit.suffix); ok {
+			number, multiplier = n, unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*b = byteSize(n * multiplier)
+	return nil
+}
+
+func (b *byteSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("size must be a string like \"512MiB\"")
+	}
+	return b.Set(s)
+}
+
+// fileMode is an octal permission mode like 0640, both as a flag and as a
+// JSON string. The zero value is unset.
+type fileMode struct {
+	mode os.FileMode
+	set  bool
+}
+
+func (m fileMode) String() string {
+	if !m.set {
+		return ""
+	}
+	return fmt.Sprintf("%04o", uint32(m.mode))
+}
+
+func (m *fileMode) Set(value string) error {
+	n, err := strconv.ParseUint(strings.TrimSpace(value), 8, 32)
+	if err != nil || n > 0o777 {
+		return fmt.Errorf("invalid mode %q, must be octal like 0640", value)
+	}
+	*m = fileMode{mode: os.FileMode(n), set: true}
+	return nil
+}
+
+// or returns the mode, or def when it is unset.
+func (m fileMode) or(def os.FileMode) os.FileMode {
+	if !m.set {
+		return def
+	}
+	return m.mode
+}
+
+func (m fileMode) MarshalJSON() ([]byte, error) {
+	if !m.set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(m.String())
+}
+
+func (m *fileMode) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("mode must be a string like \"0640\"")
+	}
+	return m.Set(s)
+}
+
+// rollback is the -rollback flag, a count that may be left out
+type rollback int
+
+func (r *rollback) String() string {
+	return strconv.Itoa(int(*r))
+}
+
+func (r *rollback) Set(value string) error {
+	// A bare -rollback goes back one version
+	if value == "true" {
+		*r = 1
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("must be a positive number of versions")
+	}
+	*r = rollback(n)
+	return nil
+}
+
+func (r *rollback) IsBoolFlag() bool {
+	return true
+}
+
+func defaultConfig() config {
+	return config{
+		OutputDir:          ".",
+		RepresentedCountry: geonft.RepresentedIgnore,
+		Schema:             geonft.SchemaAuto,
+		CodeValidation:     validationPermissive,
+		TransitionRanges:   transitionKeep,
+		MinPrefixIPv4:      8,
+		MinPrefixIPv6:      12,
+		ExpectDatabaseType: "country",
+		NFTBinary:          "nft",
+		Table:              geonft.DefaultTable,
+		TableFamily:        geonft.DefaultFamily,
+		Samples:            10,
+		ApplyMethod:        applyMethodNFT,
+		ApplyFiles:         []string{"geoip_ipv4.nft"},
+		ApplyProbeTimeout:  duration(30 * time.Second),
+		ApplyHistoryKeep:   10,
+		RemoteDir:          "/var/lib/maxminddb-to-nft",
+		GitBranch:          "main",
+		GitPath:            ".",
+		GitMessage:         defaultGitMessage,
+		Listen:             ":8080",
+		WatchDelay:         duration(5 * time.Second),
+		WebhookFormat:      webhookFormatAuto,
+		LogLevel:           "info",
+		LogFormat:          logFormatText,
+		LogOutput:          logOutputStderr,
+		SetNaming:          setNamingAlpha2,
+		Format:             formatNFT,
+		StatsFamily:        "ipv4",
+		Families:           []string{"ipv4", "ipv6"},
+		RateLimitHook:      rateLimitHookInput,
+		FwmarkTable:        100,
+		SourceConcurrency:  4,
+		SourceFailure:      sourceFailureAbort,
+		StatsSort:          statsSortAddresses,
+		Top:                20,
+		BuildOutput:        "country.mmdb",
+	}
+}
+
+func newFlagSet(cfg *config) *flag.FlagSet {
+	fs := flag.NewFlagSet("maxminddb-to-nft", flag.ContinueOnError)
+	fs.StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile,
+		"path to a JSON config file, flags override its values")
+	fs.StringVar(&cfg.Input, "input", cfg.Input,
+		"read the database from a local .mmdb or .tar.gz file instead of downloading it")
+	fs.StringVar(&cfg.OutputDir, "output-dir", cfg.OutputDir, "directory the generated files are written to")
+	fs.Var(&cfg.FileMode, "file-mode", "exact octal permissions of the generated files (default 0644 reduced by the process umask)")
+	fs.Var(&cfg.DirMode, "dir-mode",
+		"exact octal permissions of the output directory and its by_country directories (default 0755 reduced by the process umask)")
+	fs.Var(&cfg.Umask, "umask", "octal permission bits removed from -file-mode and -dir-mode, which makes them exact")
+	fs.StringVar(&cfg.Owner, "owner", cfg.Owner,
+		"user, user:group or :group, by name or ID, the generated files and directories are given")
+	fs.StringVar(&cfg.RepresentedCountry, "represented-country", cfg.RepresentedCountry,
+		"represented_country handling: ignore, prefer (over country) or fallback (when country is empty)")
+	fs.StringVar(&cfg.Schema, "schema", cfg.Schema,
+		"record schema: auto, geolite2, dbip or ipinfo")
+	fs.StringVar(&cfg.LookupPath, "lookup-path", cfg.LookupPath,
+		"dotted path to the country code in each record, e.g. country.iso_code (overrides -schema)")
+	fs.StringVar(&cfg.CodeValidation, "code-validation", cfg.CodeValidation,
+		"country code validation: permissive (any two letters), strict (assigned ISO 3166-1 codes) or allowlist")
+	fs.Var((*stringList)(&cfg.AllowCodes), "allow-codes",
+		"comma separated codes accepted in addition to the ISO list (strict) or exclusively (allowlist), e.g. XK")
+	fs.StringVar(&cfg.UnknownSet, "unknown-set", cfg.UnknownSet,
+		"collect networks without a country code into a set with this name, e.g. UNKNOWN (disabled when empty)")
+	fs.Var((*stringList)(&cfg.Geofeeds), "geofeed",
+		"comma separated RFC 8805 geofeed URLs or files whose assignments override the database")
+	fs.BoolVar(&cfg.StripReserved, "strip-reserved", cfg.StripReserved,
+		"remove private, link-local, documentation and other special-purpose ranges from all sets")
+	fs.StringVar(&cfg.BogonSet, "bogon-set", cfg.BogonSet,
+		"emit the special-purpose ranges as a standalone set with this name, e.g. BOGONS (disabled when empty)")
+	fs.StringVar(&cfg.SetNaming, "set-naming", cfg.SetNaming,
+		"names of the country sets: alpha2 (US), alpha3 (USA) or numeric (country_840), "+setNamesFile+" maps them to the codes")
+	fs.Var((*stringList)(&cfg.NamesFormats), "names",
+		"comma separated formats of the country names metadata to write: json, csv")
+	fs.BoolVar(&cfg.NFTComments, "nft-comments", cfg.NFTComments,
+		"annotate each set in the nft files with the country name and continent")
+	fs.StringVar(&cfg.Table, "table", cfg.Table, "nft table holding the sets")
+	fs.StringVar(&cfg.TableFamily, "table-family", cfg.TableFamily, "family of the -table: inet, ip, ip6, bridge or netdev")
+	fs.BoolVar(&cfg.NoTable, "no-table", cfg.NoTable,
+		"write the bare sets without the table around them, for including them inside an existing table")
+	fs.StringVar(&cfg.Format, "format", cfg.Format,
+		"syntax of the set files: nft, or nft-json for the JSON ruleset read by nft -j -f")
+	fs.Var((*stringList)(&cfg.Locales), "locale",
+		"comma separated locales (e.g. de,fr,ja,ru,zh-CN) whose country names from the database are added to the names metadata")
+	fs.StringVar(&cfg.TransitionRanges, "transition-ranges", cfg.TransitionRanges,
+		"6to4 (2002::/16) and Teredo (2001::/32) handling: keep, drop, or derive 6to4 prefixes from each country's IPv4 space")
+	fs.IntVar(&cfg.MinPrefixIPv4, "min-prefix-ipv4", cfg.MinPrefixIPv4,
+		"exclude IPv4 prefixes shorter than this length (0.0.0.0/0 is always excluded)")
+	fs.IntVar(&cfg.MinPrefixIPv6, "min-prefix-ipv6", cfg.MinPrefixIPv6,
+		"exclude IPv6 prefixes shorter than this length (::/0 is always excluded)")
+	fs.BoolVar(&cfg.Strict, "strict", cfg.Strict,
+		"fail when more than -max-decode-errors records cannot be decoded or nothing was loaded")
+	fs.IntVar(&cfg.MaxDecodeErrors, "max-decode-errors", cfg.MaxDecodeErrors,
+		"number of decode errors tolerated in strict mode")
+	fs.StringVar(&cfg.SkipReport, "skip-report", cfg.SkipReport,
+		"write every skipped network with the reason (decode_error, empty_code, invalid_code) to this CSV file")
+	fs.StringVar(&cfg.ExpectDatabaseType, "expect-database-type", cfg.ExpectDatabaseType,
+		"abort unless the database_type metadata contains this string (case-insensitive, empty disables the check)")
+	fs.Var(&cfg.MaxAge, "max-age", "fail with exit code 3 when the database build is older than this, e.g. 14d (0 disables)")
+	fs.Var(&cfg.WarnAge, "warn-age", "warn when the database build is older than this, e.g. 7d (0 disables)")
+	fs.BoolVar(&cfg.NFTCheck, "nft-check", cfg.NFTCheck,
+		"validate every generated nft file with `nft -c -f` and fail the run if any does not parse")
+	fs.StringVar(&cfg.NFTBinary, "nft-binary", cfg.NFTBinary, "nft binary used by -nft-check")
+	fs.StringVar(&cfg.TargetNFTVersion, "target-nft-version", cfg.TargetNFTVersion,
+		"nft version like 0.9.0 the syntax of the files is adapted to, or local to probe -nft-binary and the kernel")
+	fs.IntVar(&cfg.Samples, "samples", cfg.Samples, "random addresses checked per set by the verify command")
+	fs.Uint64Var(&cfg.Seed, "seed", cfg.Seed, "random seed for the verify command (0 picks a random one)")
+	fs.StringVar(&cfg.StateFile, "state-file", cfg.StateFile,
+		"keep a snapshot of the sets in this file and print what changed since the previous run")
+	fs.StringVar(&cfg.DiffFile, "diff-file", cfg.DiffFile,
+		"write the changes since the previous run as JSON to this file (requires -state-file)")
+	fs.Float64Var(&cfg.MaxChangePercent, "max-change-percent", cfg.MaxChangePercent,
+		"abort before writing when a set's address space changed by more than this percentage since the previous run (0 disables, requires -state-file)")
+	fs.BoolVar(&cfg.Force, "force", cfg.Force, "write outputs even when -max-change-percent is exceeded")
+	fs.StringVar(&cfg.ApplyMethod, "apply-method", cfg.ApplyMethod,
+		"how apply loads the sets: nft (run the nft binary) or netlink (talk to the kernel directly)")
+	fs.Var((*stringList)(&cfg.ApplyFiles), "apply-files",
+		"comma separated files, relative to -output-dir, loaded by the apply command")
+	fs.StringVar(&cfg.ApplyProbe, "apply-probe", cfg.ApplyProbe,
+		"shell command run after apply, the previous ruleset is restored when it fails, e.g. \"ping -c1 -W2 192.0.2.1\"")
+	fs.Var(&cfg.ApplyProbeTimeout, "apply-probe-timeout", "timeout of the -apply-probe command")
+	fs.StringVar(&cfg.ApplyHistory, "apply-history", cfg.ApplyHistory,
+		"directory the apply command keeps a timestamped snapshot of every applied version in")
+	fs.IntVar(&cfg.ApplyHistoryKeep, "apply-history-keep", cfg.ApplyHistoryKeep, "snapshots kept in -apply-history")
+	fs.Var(&cfg.Rollback, "rollback",
+		"apply the Nth previous version kept in -apply-history instead of -output-dir; a bare -rollback goes back one")
+	fs.Var((*stringList)(&cfg.Hosts), "hosts",
+		"comma separated SSH hosts the apply command copies the files to and loads them on, instead of the local host")
+	fs.BoolVar(&cfg.Canary, "canary", cfg.Canary,
+		"apply to the first of -hosts alone first and stop when it fails")
+	fs.StringVar(&cfg.RemoteDir, "remote-dir", cfg.RemoteDir, "directory on the -hosts the files are copied to")
+	fs.Var((*stringList)(&cfg.Publish), "publish",
+		"comma separated rsync (host:/path, rsync://host/module), sftp://[user@]host[:port]/path, s3://, gs:// or az:// targets the outputs are synced to after a successful run")
+	fs.BoolVar(&cfg.PublishDelete, "publish-delete", cfg.PublishDelete,
+		"remove files from the -publish targets that are no longer generated")
+	fs.BoolVar(&cfg.PublishDryRun, "publish-dry-run", cfg.PublishDryRun,
+		"only print what -publish would transfer")
+	fs.StringVar(&cfg.PublishCacheControl, "publish-cache-control", cfg.PublishCacheControl,
+		"Cache-Control header of objects uploaded to s3://, gs:// and az:// targets, e.g. \"public, max-age=3600\"")
+	fs.StringVar(&cfg.GitRepo, "git-repo", cfg.GitRepo,
+		"git repository URL or path the outputs are committed and pushed to after a successful run")
+	fs.StringVar(&cfg.GitBranch, "git-branch", cfg.GitBranch, "branch of -git-repo to commit to")
+	fs.StringVar(&cfg.GitPath, "git-path", cfg.GitPath, "directory inside -git-repo the outputs are copied to")
+	fs.StringVar(&cfg.GitMessage, "git-message", cfg.GitMessage,
+		"text/template of the commit message, fields: DatabaseType, BuildEpoch, BuildTime, FilesChanged, HasDiff, SetsChanged, PrefixesAdded, PrefixesRemoved")
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "address the serve command listens on")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "certificate file serve uses for HTTPS, reloaded when it changes")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "private key file of -tls-cert")
+	fs.Var((*stringList)(&cfg.ACMEDomains), "acme-domains",
+		"comma separated domains serve obtains certificates for over ACME (Let's Encrypt) instead of -tls-cert")
+	fs.StringVar(&cfg.ACMECache, "acme-cache", cfg.ACMECache, "directory the ACME account and certificates are kept in")
+	fs.StringVar(&cfg.ACMEEmail, "acme-email", cfg.ACMEEmail, "contact address of the ACME account")
+	fs.Var((*stringList)(&cfg.AuthTokens), "auth-token",
+		"comma separated bearer tokens serve accepts, better set in the -config file")
+	fs.Var((*stringList)(&cfg.AuthUsers), "auth-user",
+		"comma separated user:password pairs serve accepts with basic auth, better set in the -config file")
+	fs.StringVar(&cfg.ServeRateLimit, "serve-rate-limit", cfg.ServeRateLimit,
+		"requests serve answers per client address, e.g. 60/minute")
+	fs.Var(&cfg.RefreshInterval, "refresh-interval",
+		"regenerate the outputs this often in serve and daemon, e.g. 12h; 0 generates once")
+	fs.StringVar(&cfg.Schedule, "schedule", cfg.Schedule,
+		"cron expression of the daemon and serve runs instead of -refresh-interval, e.g. \"0 4 * * 2,5\"")
+	fs.StringVar(&cfg.Timezone, "timezone", cfg.Timezone,
+		"IANA timezone of -schedule, e.g. Europe/Berlin; defaults to the local timezone")
+	fs.Var(&cfg.Jitter, "jitter", "random delay of up to this duration before every scheduled run, e.g. 15m")
+	fs.BoolVar(&cfg.DaemonApply, "daemon-apply", cfg.DaemonApply,
+		"apply the outputs after every successful daemon run")
+	fs.BoolVar(&cfg.Watch, "watch", cfg.Watch, "regenerate in daemon whenever the -input file is replaced or written")
+	fs.Var(&cfg.WatchDelay, "watch-delay", "time -input must stay unchanged before -watch regenerates")
+	fs.StringVar(&cfg.ASNInput, "asn-input", cfg.ASNInput,
+		"local .mmdb or .tar.gz ASN database (e.g. GeoLite2-ASN) whose data serve adds to /lookup responses")
+	fs.StringVar(&cfg.GRPCListen, "grpc-listen", cfg.GRPCListen,
+		"address serve also offers the gRPC API on, e.g. :9090")
+	fs.StringVar(&cfg.HealthListen, "health-listen", cfg.HealthListen,
+		"address daemon serves /healthz and /readyz on, e.g. :8081; serve offers them on -listen")
+	fs.Var(&cfg.StaleAfter, "stale-after", "/healthz fails when no generation succeeded for this long, e.g. 36h")
+	fs.StringVar(&cfg.TextfileDir, "textfile-dir", cfg.TextfileDir,
+		"node_exporter textfile collector directory generate writes "+textfileName+" to")
+	fs.Var((*stringList)(&cfg.Webhooks), "webhook", "comma separated URLs a JSON summary is posted to after every run")
+	fs.StringVar(&cfg.WebhookFormat, "webhook-format", cfg.WebhookFormat,
+		"webhook payload: json, slack, discord, or auto to pick slack and discord by the URL host")
+	fs.StringVar(&cfg.Pprof, "pprof", cfg.Pprof, "address net/http/pprof is served on, e.g. localhost:6060")
+	fs.StringVar(&cfg.CPUProfile, "cpu-profile", cfg.CPUProfile, "write a CPU profile of the whole process to this file")
+	fs.StringVar(&cfg.Trace, "trace", cfg.Trace, "write an execution trace of the whole process to this file")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "minimum log level: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log format: text or json")
+	fs.StringVar(&cfg.LogOutput, "log-output", cfg.LogOutput, "where logs go: stderr, syslog or journald")
+	fs.BoolVar(&cfg.JSON, "json", cfg.JSON, "print a JSON summary of the generate run to stdout")
+	fs.StringVar(&cfg.SummaryFile, "summary-file", cfg.SummaryFile, "write a JSON summary of the generate run to this file")
+	fs.BoolVar(&cfg.Stats, "stats", cfg.Stats,
+		"write "+statsFile+" with prefixes, addresses, share and change per set to the output directory")
+	fs.BoolVar(&cfg.HTMLIndex, "html-index", cfg.HTMLIndex,
+		"write "+indexFile+" listing the sets and files with names, prefix counts, sizes and links to the output directory")
+	fs.StringVar(&cfg.StatsInput, "stats-input", cfg.StatsInput,
+		"stats.json or manifest.json the stats command reads instead of the database")
+	fs.StringVar(&cfg.StatsFamily, "family", cfg.StatsFamily, "address family the stats command lists: ipv4 or ipv6")
+	fs.StringVar(&cfg.StatsSort, "sort", cfg.StatsSort, "order of the stats command: addresses or prefixes")
+	fs.IntVar(&cfg.Top, "top", cfg.Top, "rows printed by the stats command, 0 for all")
+	fs.IntVar(&cfg.FewerThan, "fewer-than", cfg.FewerThan, "stats command lists only sets with fewer prefixes than this")
+	fs.StringVar(&cfg.CompareInput, "compare-input", cfg.CompareInput,
+		"local .mmdb or .tar.gz database the compare command compares -input with")
+	fs.StringVar(&cfg.CompareReport, "compare-report", cfg.CompareReport,
+		"CSV file the compare command lists every network attributed differently in")
+	fs.Var((*stringList)(&cfg.BuildInputs), "build-inputs",
+		"comma separated nft files, geofeeds, per-country prefix lists or directories the build-mmdb command reads")
+	fs.StringVar(&cfg.BuildOutput, "build-output", cfg.BuildOutput, "database the build-mmdb command writes")
+	fs.StringVar(&cfg.Sign, "sign", cfg.Sign, "write detached signatures of every output with minisign or gpg")
+	fs.StringVar(&cfg.SignKey, "sign-key", cfg.SignKey, "minisign secret key file or gpg key ID used by -sign")
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "parts of the database read and files written concurrently, 0 for one per CPU")
+	fs.IntVar(&cfg.SourceConcurrency, "source-concurrency", cfg.SourceConcurrency,
+		"database and geofeeds downloaded and parsed concurrently")
+	fs.StringVar(&cfg.SourceFailure, "source-failure", cfg.SourceFailure,
+		"what a failed geofeed does: abort cancels the other downloads and fails the run, skip leaves it out")
+	fs.Var((*stringList)(&cfg.Families), "families",
+		"comma separated address families to read and generate: ipv4, ipv6")
+	fs.Var((*stringList)(&cfg.Within), "within",
+		"comma separated prefixes generation is limited to, networks outside them are neither read nor written")
+	fs.StringVar(&cfg.Filter, "filter", cfg.Filter,
+		"expr expression selecting the networks, e.g. 'record.country.iso_code in [\"RU\", \"CN\"] || prefix.bits <= 16'")
+	fs.Var((*stringList)(&cfg.Dimensions), "dimensions",
+		"comma separated dimensions generated in the same pass as the country sets: continent, asn")
+	fs.Var((*stringList)(&cfg.RateLimits), "rate-limit",
+		"comma separated SETS=RATE limits of new connections written to geoip_ratelimit_<family>.nft, e.g. RU=100/minute,CN+HK=10/second")
+	fs.StringVar(&cfg.RateLimitHook, "rate-limit-hook", cfg.RateLimitHook, "hook of the -rate-limit chains: input or forward")
+	fs.Var((*stringList)(&cfg.Fwmarks), "fwmark",
+		"comma separated SETS=MARK marks of the traffic to the sets written to "+fwmarkFile+", e.g. US+CA=0x1,DE=0x2")
+	fs.Var((*stringList)(&cfg.FwmarkRoutes), "fwmark-route",
+		"comma separated MARK=ROUTE interfaces or gateways the marked traffic leaves through, written to "+fwmarkScript+", e.g. 0x1=wg0,0x2=192.0.2.1+2001:db8::1")
+	fs.IntVar(&cfg.FwmarkTable, "fwmark-table", cfg.FwmarkTable, "routing table of a -fwmark is this number plus the mark")
+	fs.BoolVar(&cfg.Incremental, "incremental", cfg.Incremental,
+		"only rewrite the nft files whose sets changed since the last run, tracked in "+incrementalFile+" in the output directory")
+	fs.Var(&cfg.MaxMemory, "max-memory",
+		"memory limit, e.g. 256MiB; the sets are spilled to temporary files like with -stream when the heap reaches half of it")
+	fs.BoolVar(&cfg.Stream, "stream", cfg.Stream,
+		"spool the sets to temporary files while reading the database instead of keeping them in memory")
+	return fs
+}
+
+// tableFamilies are the nft families whose tables can hold address sets
+var tableFamilies = []string{"inet", "ip", "ip6", "bridge", "netdev"}
+
+// table returns the family and name of the -table, like "inet geoip".
+func (c config) table() string {
+	return c.TableFamily + " " + c.Table
+}
+
+// family reports whether the address family is selected with -families.
+func (c config) family(name string) bool {
+	return slices.Contains(c.Families, name)
+}
+
+// withinPrefixes returns the -within prefixes, sorted and non-overlapping,
+// with IPv4-mapped prefixes as IPv4. It is nil without -within.
+func (c config) withinPrefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, s := range c.Within {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, geonft.UnmapPrefix(p.Masked()))
+	}
+	if len(prefixes) == 0 {
+		return nil
+	}
+	return geonft.MergePrefixes(prefixes)
+}
+
+// workers returns the number of concurrent load and write tasks.
+func (c config) workers() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+func parseFlags(args []string) (config, error) {
+	cfg := defaultConfig()
+
+	if err := parseArgs(newFlagSet(&cfg), &cfg, args); err != nil {
+		return config{}, err
+	}
+
+	if cfg.ConfigFile != "" {
+		fileCfg, err := loadConfigFile(cfg.ConfigFile)
+		if err != nil {
+			return config{}, err
+		}
+
+		// Parse again on top of the file so explicit flags take precedence
+		if err := parseArgs(newFlagSet(&fileCfg), &fileCfg, args); err != nil {
+			return config{}, err
+		}
+		cfg = fileCfg
+	}
+
+	if err := cfg.validate(); err != nil {
+		return config{}, err
+	}
+
+	return cfg, nil
+}
+
+// parseArgs parses args into cfg. The count of "-rollback N" follows the
+// flag as a separate argument, which ends flag parsing, so parsing
+// continues after it.
+func parseArgs(fs *flag.FlagSet, cfg *config, args []string) error {
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		args = fs.Args()
+		if cfg.Rollback != 1 || len(args) == 0 {
+			return nil
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return nil
+		}
+		cfg.Rollback, args = rollback(n), args[1:]
+	}
+}
+
+func loadConfigFile(path string) (config, error) {
+	cfg := defaultConfig()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return config{}, fmt.Errorf("opening config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return config{}, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (c config) validate() error {
+	switch c.RepresentedCountry {
+	case geonft.RepresentedIgnore, geonft.RepresentedPrefer, geonft.RepresentedFallback:
+	default:
+		return fmt.Errorf("invalid -represented-country %q", c.RepresentedCountry)
+	}
+
+	switch c.Schema {
+	case geonft.SchemaAuto, geonft.SchemaGeoLite2, geonft.SchemaDBIP, geonft.SchemaIPInfo:
+	default:
+		return fmt.Errorf("invalid -schema %q", c.Schema)
+	}
+
+	switch c.CodeValidation {
+	case validationPermissive, validationStrict:
+	case validationAllowlist:
+		if len(c.AllowCodes) == 0 {
+			return fmt.Errorf("-code-validation allowlist requires -allow-codes")
+		}
+	default:
+		return fmt.Errorf("invalid -code-validation %q", c.CodeValidation)
+	}
+
+	for _, code := range c.AllowCodes {
+		if !geonft.ValidCountryCode(code) {
+			return fmt.Errorf("invalid code %q in -allow-codes", code)
+		}
+	}
+
+	if c.UnknownSet != "" && (!isValidSetName(c.UnknownSet) || geonft.ValidCountryCode(c.UnknownSet)) {
+		return fmt.Errorf("invalid -unknown-set %q, must be an identifier that is not a country code", c.UnknownSet)
+	}
+
+	if c.BogonSet != "" && (!isValidSetName(c.BogonSet) || geonft.ValidCountryCode(c.BogonSet)) {
+		return fmt.Errorf("invalid -bogon-set %q, must be an identifier that is not a country code", c.BogonSet)
+	}
+
+	if c.BogonSet != "" && c.BogonSet == c.UnknownSet {
+		return fmt.Errorf("-bogon-set and -unknown-set must differ")
+	}
+
+	if c.TargetNFTVersion != "" && c.TargetNFTVersion != targetNFTLocal {
+		if _, err := parseNFTVersion(c.TargetNFTVersion); err != nil {
+			return fmt.Errorf("invalid -target-nft-version: %w", err)
+		}
+	}
+
+	switch c.SetNaming {
+	case setNamingAlpha2, setNamingAlpha3, setNamingNumeric:
+	default:
+		return fmt.Errorf("invalid -set-naming %q", c.SetNaming)
+	}
+	for _, set := range []string{c.BogonSet, c.UnknownSet} {
+		if _, ok := setNameCodes(c.SetNaming)[set]; ok {
+			return fmt.Errorf("set %q is also the name of a country set with -set-naming %s", set, c.SetNaming)
+		}
+	}
+
+	for _, format := range c.NamesFormats {
+		if format != namesJSON && format != namesCSV {
+			return fmt.Errorf("invalid -names format %q", format)
+		}
+	}
+
+	switch c.TransitionRanges {
+	case transitionKeep, transitionDrop, transitionDerive:
+	default:
+		return fmt.Errorf("invalid -transition-ranges %q", c.TransitionRanges)
+	}
+
+	if c.MinPrefixIPv4 < 0 || c.MinPrefixIPv4 > 32 {
+		return fmt.Errorf("invalid -min-prefix-ipv4 %d", c.MinPrefixIPv4)
+	}
+
+	if c.MinPrefixIPv6 < 0 || c.MinPrefixIPv6 > 128 {
+		return fmt.Errorf("invalid -min-prefix-ipv6 %d", c.MinPrefixIPv6)
+	}
+
+	if c.MaxDecodeErrors < 0 {
+		return fmt.Errorf("invalid -max-decode-errors %d", c.MaxDecodeErrors)
+	}
+
+	if c.RefreshInterval < 0 || c.Jitter < 0 || c.StaleAfter < 0 || c.WatchDelay < 0 {
+		return fmt.Errorf("-refresh-interval, -jitter, -stale-after and -watch-delay must not be negative")
+	}
+	if c.Watch && c.Input == "" {
+		return fmt.Errorf("-watch requires -input")
+	}
+
+	if c.StatsFamily != "ipv4" && c.StatsFamily != "ipv6" {
+		return fmt.Errorf("-family must be ipv4 or ipv6")
+	}
+	if c.StatsSort != statsSortAddresses && c.StatsSort != statsSortPrefixes {
+		return fmt.Errorf("-sort must be %s or %s", statsSortAddresses, statsSortPrefixes)
+	}
+	if c.Top < 0 || c.FewerThan < 0 {
+		return fmt.Errorf("-top and -fewer-than must not be negative")
+	}
+
+	switch c.Sign {
+	case "":
+	case signMinisign, signGPG:
+		if c.SignKey == "" {
+			return fmt.Errorf("-sign requires -sign-key")
+		}
+	default:
+		return fmt.Errorf("-sign must be %s or %s", signMinisign, signGPG)
+	}
+
+	switch c.WebhookFormat {
+	case webhookFormatAuto, webhookFormatJSON, webhookFormatSlack, webhookFormatDiscord:
+	default:
+		return fmt.Errorf("-webhook-format must be one of %s, %s, %s, %s",
+			webhookFormatAuto, webhookFormatJSON, webhookFormatSlack, webhookFormatDiscord)
+	}
+	for _, target := range c.Webhooks {
+		if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("-webhook needs http or https URLs, got %q", redactURL(target))
+		}
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("-tls-cert and -tls-key must be given together")
+	}
+	if len(c.ACMEDomains) > 0 {
+		if c.TLSCert != "" {
+			return fmt.Errorf("-acme-domains and -tls-cert are mutually exclusive")
+		}
+		if c.ACMECache == "" {
+			return fmt.Errorf("-acme-domains requires -acme-cache")
+		}
+	}
+	for _, user := range c.AuthUsers {
+		if name, password, ok := strings.Cut(user, ":"); !ok || name == "" || password == "" {
+			return fmt.Errorf("invalid -auth-user entry, must be user:password")
+		}
+	}
+	for _, token := range c.AuthTokens {
+		if token == "" {
+			return fmt.Errorf("-auth-token entries must not be empty")
+		}
+	}
+	if c.ServeRateLimit != "" {
+		if _, err := newClientLimiter(c.ServeRateLimit); err != nil {
+			return fmt.Errorf("invalid -serve-rate-limit: %w", err)
+		}
+	}
+
+	if c.Schedule != "" && c.RefreshInterval > 0 {
+		return fmt.Errorf("-schedule and -refresh-interval are mutually exclusive")
+	}
+
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("invalid -timezone: %w", err)
+		}
+	}
+
+	if _, err := newSchedule(c); err != nil {
+		return err
+	}
+
+	if c.MaxAge < 0 || c.WarnAge < 0 {
+		return fmt.Errorf("-max-age and -warn-age must not be negative")
+	}
+
+	if c.Samples < 1 {
+		return fmt.Errorf("invalid -samples %d", c.Samples)
+	}
+
+	if c.DiffFile != "" && c.StateFile == "" {
+		return fmt.Errorf("-diff-file requires -state-file")
+	}
+
+	if c.MaxChangePercent < 0 {
+		return fmt.Errorf("invalid -max-change-percent %g", c.MaxChangePercent)
+	}
+
+	if c.MaxChangePercent > 0 && c.StateFile == "" {
+		return fmt.Errorf("-max-change-percent requires -state-file")
+	}
+
+	switch c.ApplyMethod {
+	case applyMethodNFT, applyMethodNetlink:
+	default:
+		return fmt.Errorf("invalid -apply-method %q", c.ApplyMethod)
+	}
+
+	if len(c.ApplyFiles) == 0 {
+		return fmt.Errorf("-apply-files must not be empty")
+	}
+
+	if c.ApplyProbeTimeout <= 0 {
+		return fmt.Errorf("-apply-probe-timeout must be positive")
+	}
+
+	// These change the sets after loading, which needs them in memory
+	spillModes := []struct {
+		flag string
+		set  bool
+	}{{"-stream", c.Stream}, {"-max-memory", c.MaxMemory > 0}}
+	for _, mode := range spillModes {
+		if !mode.set {
+			continue
+		}
+		for _, option := range []struct {
+			flag string
+			set  bool
+		}{
+			{"-geofeed", len(c.Geofeeds) > 0},
+			{"-strip-reserved", c.StripReserved},
+			{"-bogon-set", c.BogonSet != ""},
+			{"-transition-ranges", c.TransitionRanges != transitionKeep},
+			{"-state-file", c.StateFile != ""},
+			{"-stats", c.Stats},
+			{"-dimensions", len(c.Dimensions) > 0},
+			{"-fwmark", len(c.Fwmarks) > 0},
+		} {
+			if option.set {
+				return fmt.Errorf("%s cannot be combined with %s", mode.flag, option.flag)
+			}
+		}
+	}
+
+	if len(c.Families) == 0 {
+		return fmt.Errorf("-families must not be empty")
+	}
+	for _, family := range c.Families {
+		if family != "ipv4" && family != "ipv6" {
+			return fmt.Errorf("invalid -families entry %q, must be ipv4 or ipv6", family)
+		}
+	}
+
+	if c.TransitionRanges == transitionDerive && !c.family("ipv4") {
+		return fmt.Errorf("-transition-ranges %s requires ipv4 in -families", transitionDerive)
+	}
+
+	for _, s := range c.Within {
+		if _, err := netip.ParsePrefix(s); err != nil {
+			return fmt.Errorf("invalid -within prefix %q: %w", s, err)
+		}
+	}
+
+	for _, d := range c.Dimensions {
+		if d != dimensionContinent && d != dimensionASN {
+			return fmt.Errorf("invalid -dimensions entry %q, must be %s or %s", d, dimensionContinent, dimensionASN)
+		}
+	}
+
+	for _, s := range c.RateLimits {
+		if _, err := parseRateLimit(s); err != nil {
+			return fmt.Errorf("invalid -rate-limit: %w", err)
+		}
+	}
+	if c.RateLimitHook != rateLimitHookInput && c.RateLimitHook != rateLimitHookForward {
+		return fmt.Errorf("-rate-limit-hook must be %s or %s", rateLimitHookInput, rateLimitHookForward)
+	}
+
+	routes := make(map[uint32]bool)
+	for _, s := range c.FwmarkRoutes {
+		r, err := parseFwmarkRoute(s)
+		if err != nil {
+			return fmt.Errorf("invalid -fwmark-route: %w", err)
+		}
+		routes[r.mark] = true
+	}
+	marks := make(map[uint32]bool)
+	for _, s := range c.Fwmarks {
+		m, err := parseFwmark(s)
+		if err != nil {
+			return fmt.Errorf("invalid -fwmark: %w", err)
+		}
+		if marks[m.mark] {
+			return fmt.Errorf("invalid -fwmark: mark 0x%x is given twice, join the sets with +", m.mark)
+		}
+		if !routes[m.mark] {
+			return fmt.Errorf("-fwmark mark 0x%x has no -fwmark-route", m.mark)
+		}
+		// 253 to 255 are the default, main and local tables
+		if table := int64(c.FwmarkTable) + int64(m.mark); c.FwmarkTable < 0 || table > math.MaxUint32 || table >= 253 && table <= 255 {
+			return fmt.Errorf("-fwmark-table %d gives mark 0x%x the invalid or reserved routing table %d", c.FwmarkTable, m.mark, table)
+		}
+		marks[m.mark] = true
+	}
+
+	if !isValidSetName(c.Table) {
+		return fmt.Errorf("invalid -table %q", c.Table)
+	}
+	if !slices.Contains(tableFamilies, c.TableFamily) {
+		return fmt.Errorf("invalid -table-family %q, must be one of %s", c.TableFamily, strings.Join(tableFamilies, ", "))
+	}
+	// The rules match both address families
+	if c.TableFamily != geonft.DefaultFamily {
+		for _, option := range []struct {
+			flag string
+			set  bool
+		}{{"-rate-limit", len(c.RateLimits) > 0}, {"-fwmark", len(c.Fwmarks) > 0}} {
+			if option.set {
+				return fmt.Errorf("%s requires -table-family %s", option.flag, geonft.DefaultFamily)
+			}
+		}
+	}
+
+	switch c.Format {
+	case formatNFT:
+	case formatNFTJSON:
+		// The JSON sets name their table and carry no comments, the
+		// rules are only written in the nft syntax
+		for _, option := range []struct {
+			flag string
+			set  bool
+		}{
+			{"-no-table", c.NoTable},
+			{"-nft-comments", c.NFTComments},
+			{"-rate-limit", len(c.RateLimits) > 0},
+			{"-fwmark", len(c.Fwmarks) > 0},
+		} {
+			if option.set {
+				return fmt.Errorf("%s cannot be combined with -format %s", option.flag, formatNFTJSON)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid -format %q", c.Format)
+	}
+
+	if c.Filter != "" {
+		if _, err := geonft.CompileFilter(c.Filter); err != nil {
+			return fmt.Errorf("invalid -filter: %w", err)
+		}
+	}
+
+	if _, err := parseOwner(c.Owner); err != nil {
+		return err
+	}
+
+	if c.SourceConcurrency < 1 {
+		return fmt.Errorf("invalid -source-concurrency %d, must be at least 1", c.SourceConcurrency)
+	}
+	switch c.SourceFailure {
+	case sourceFailureAbort, sourceFailureSkip:
+	default:
+		return fmt.Errorf("invalid -source-failure %q", c.SourceFailure)
+	}
+
+	if c.Workers < 0 {
+		return fmt.Errorf("invalid -workers %d", c.Workers)
+	}
+
+	if c.ApplyHistoryKeep < 1 {
+		return fmt.Errorf("invalid -apply-history-keep %d", c.ApplyHistoryKeep)
+	}
+
+	if c.Rollback > 0 && c.ApplyHistory == "" {
+		return fmt.Errorf("-rollback requires -apply-history")
+	}
+
+	if len(c.Hosts) > 0 && c.ApplyMethod != applyMethodNFT {
+		return fmt.Errorf("-hosts requires -apply-method %s", applyMethodNFT)
+	}
+
+	if c.Canary && len(c.Hosts) < 2 {
+		return fmt.Errorf("-canary requires at least two -hosts")
+	}
+
+	for _, target := range c.Publish {
+		if strings.HasPrefix(target, "az://") {
+			if _, err := azureURL(target); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.PublishDelete && len(c.Publish) == 0 {
+		return fmt.Errorf("-publish-delete requires -publish")
+	}
+
+	if c.PublishDryRun && len(c.Publish) == 0 && c.GitRepo == "" {
+		return fmt.Errorf("-publish-dry-run requires -publish or -git-repo")
+	}
+
+	if c.GitRepo != "" {
+		if _, err := template.New("message").Parse(c.GitMessage); err != nil {
+			return fmt.Errorf("invalid -git-message: %w", err)
+		}
+		if filepath.IsAbs(c.GitPath) || strings.HasPrefix(filepath.Clean(c.GitPath), "..") {
+			return fmt.Errorf("-git-path must be relative to the repository")
+		}
+	}
+
+	if !path.IsAbs(c.RemoteDir) {
+		return fmt.Errorf("-remote-dir must be an absolute path")
+	}
+
+	if len(c.Locales) > 0 && len(c.NamesFormats) == 0 {
+		return fmt.Errorf("-locale requires -names")
+	}
+
+	if c.LookupPath != "" {
+		if _, err := geonft.ParseLookupPath(c.LookupPath); err != nil {
+			return fmt.Errorf("invalid -lookup-path: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// Country code validation modes
+const (
+	validationPermissive = "permissive"
+	validationStrict     = "strict"
+	validationAllowlist  = "allowlist"
+)
+
+// codeValidator decides which country codes are turned into sets and keeps
+// track of the ones it rejected.
+type codeValidator struct {
+	mode    string
+	allow   map[string]bool
+	dropped map[string]int
+}
+
+func newCodeValidator(mode string, allow []string) *codeValidator {
+	v := &codeValidator{
+		mode:    mode,
+		allow:   make(map[string]bool, len(allow)),
+		dropped: make(map[string]int),
+	}
+	for _, code := range allow {
+		v.allow[code] = true
+	}
+	return v
+}
+
+// drop records n rejected networks with code.
+func (v *codeValidator) drop(code string, n int) {
+	v.dropped[code] += n
+}
+
+func (v *codeValidator) accepts(code string) bool {
+	// Set names are derived from codes, so the syntax check always applies
+	if !geonft.ValidCountryCode(code) {
+		return false
+	}
+
+	switch v.mode {
+	case validationStrict:
+		// User-assigned codes like XK must be allowed explicitly
+		_, ok := iso3166Countries[code]
+		return ok || v.allow[code]
+	case validationAllowlist:
+		return v.allow[code]
+	default:
+		return true
+	}
+}
+
+// report prints the codes that were dropped, most frequent first.
+func (v *codeValidator) report() {
+	if len(v.dropped) == 0 {
+		return
+	}
+
+	codes := make([]string, 0, len(v.dropped))
+	total := 0
+	for code, n := range v.dropped {
+		codes = append(codes, code)
+		total += n
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if v.dropped[codes[i]] != v.dropped[codes[j]] {
+			return v.dropped[codes[i]] > v.dropped[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+
+	parts := make([]string, 0, len(codes))
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("%q (%d)", code, v.dropped[code]))
+	}
+
+	slog.Warn("Dropped networks with rejected country codes", "networks", total, "codes", strings.Join(parts, ", "))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/netip"
+	"sort"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// setDiff describes how a single set changed between two runs.
+type setDiff struct {
+	Family       string   `json:"family"`
+	Code         string   `json:"code"`
+	Added        []string `json:"added"`
+	Removed      []string `json:"removed"`
+	AddressDelta string   `json:"address_delta"` // decimal, may exceed 64 bits
+}
+
+// runDiff is the machine-readable change report between two runs.
+type runDiff struct {
+	PreviousBuildEpoch uint      `json:"previous_build_epoch"`
+	CurrentBuildEpoch  uint      `json:"current_build_epoch"`
+	Sets               []setDiff `json:"sets"`
+}
+
+func diffStates(prev, cur *runState) *runDiff {
+	diff := &runDiff{
+		PreviousBuildEpoch: prev.BuildEpoch,
+		CurrentBuildEpoch:  cur.BuildEpoch,
+	}
+	diff.Sets = append(diff.Sets, diffFamily("ipv4", prev.IPv4, cur.IPv4)...)
+	diff.Sets = append(diff.Sets, diffFamily("ipv6", prev.IPv6, cur.IPv6)...)
+	return diff
+}
+
+func diffFamily(family string, prev, cur map[string][]string) []setDiff {
+	codes := make(map[string]bool)
+	for code := range prev {
+		codes[code] = true
+	}
+	for code := range cur {
+		codes[code] = true
+	}
+
+	sorted := make([]string, 0, len(codes))
+	for code := range codes {
+		sorted = append(sorted, code)
+	}
+	sort.Strings(sorted)
+
+	var diffs []setDiff
+	for _, code := range sorted {
+		added := missingFrom(prev[code], cur[code])
+		removed := missingFrom(cur[code], prev[code])
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+
+		delta := new(big.Int).Sub(addressCountOf(added), addressCountOf(removed))
+		diffs = append(diffs, setDiff{
+			Family:       family,
+			Code:         code,
+			Added:        added,
+			Removed:      removed,
+			AddressDelta: delta.String(),
+		})
+	}
+	return diffs
+}
+
+// missingFrom returns the entries of items that are not in base.
+func missingFrom(base, items []string) []string {
+	seen := make(map[string]bool, len(base))
+	for _, s := range base {
+		seen[s] = true
+	}
+
+	out := []string{}
+	for _, s := range items {
+		if !seen[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func addressCountOf(prefixes []string) *big.Int {
+	total := new(big.Int)
+	for _, s := range prefixes {
+		if p, err := netip.ParsePrefix(s); err == nil {
+			total.Add(total, geonft.PrefixSize(p))
+		}
+	}
+	return total
+}
+
+// printDiff logs a one line summary per changed set.
+func printDiff(diff *runDiff) {
+	if len(diff.Sets) == 0 {
+		slog.Info("No changes since the previous run")
+		return
+	}
+
+	slog.Info("Sets changed since the previous run", "sets", len(diff.Sets),
+		"previous_build", diff.PreviousBuildEpoch, "current_build", diff.CurrentBuildEpoch)
+	for _, d := range diff.Sets {
+		sign := ""
+		if d.AddressDelta[0] != '-' {
+			sign = "+"
+		}
+		slog.Info("Set changed", "set", d.Code, "family", d.Family, "prefixes_added", len(d.Added),
+			"prefixes_removed", len(d.Removed), "address_delta", sign+d.AddressDelta)
+	}
+}
+
+func (g *geoIPGenerator) writeDiff(path string, diff *runDiff) error {
+	return g.writeOutput(path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	})
+}
+
+// checkChurn compares the address space of every set with the previous
+// run and fails when one changed by more than -max-change-percent, which
+// usually means a broken upstream build. New sets are not limited.
+func (g *geoIPGenerator) checkChurn(prev *runState) error {
+	limit := big.NewFloat(g.cfg.MaxChangePercent)
+	violations := 0
+
+	families := []struct {
+		name string
+		prev map[string][]string
+		cur  geonft.Sets
+	}{
+		{"ipv4", prev.IPv4, g.ipv4},
+		{"ipv6", prev.IPv6, g.ipv6},
+	}
+
+	for _, f := range families {
+		codes := make([]string, 0, len(f.prev))
+		for code := range f.prev {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+
+		for _, code := range codes {
+			before := addressCountOf(f.prev[code])
+			if before.Sign() == 0 {
+				continue
+			}
+
+			after := new(big.Int)
+			for p := range f.cur[code].All() {
+				after.Add(after, geonft.PrefixSize(p))
+			}
+
+			// Percentage change relative to the previous run
+			change := new(big.Float).SetInt(new(big.Int).Sub(after, before))
+			change.Quo(change, new(big.Float).SetInt(before))
+			change.Mul(change, big.NewFloat(100))
+
+			if new(big.Float).Abs(change).Cmp(limit) > 0 {
+				violations++
+				pct, _ := change.Float64()
+				slog.Error("Set address space change exceeds -max-change-percent", "set", code, "family", f.name,
+					"change_percent", pct, "limit_percent", g.cfg.MaxChangePercent)
+			}
+		}
+	}
+
+	if violations == 0 {
+		return nil
+	}
+
+	if g.cfg.Force {
+		slog.Warn("Sets exceed -max-change-percent, continuing because of -force", "sets", violations)
+		return nil
+	}
+
+	return fmt.Errorf("%d sets changed by more than %g%% since the previous run, rerun with -force to accept",
+		violations, g.cfg.MaxChangePercent)
+}
+
+// recordState diffs the current sets against the previous snapshot and
+// replaces the snapshot.
+func (g *geoIPGenerator) recordState(prev *runState) error {
+	cur := g.snapshot()
+	if prev != nil {
+		g.diff = diffStates(prev, cur)
+		printDiff(g.diff)
+
+		if g.cfg.DiffFile != "" {
+			if err := g.writeDiff(g.cfg.DiffFile, g.diff); err != nil {
+				return fmt.Errorf("writing diff %s: %w", g.cfg.DiffFile, err)
+			}
+			slog.Info("Generated file", "path", g.cfg.DiffFile)
+		}
+	} else {
+		slog.Info("No previous state, skipping diff")
+	}
+
+	if err := g.saveState(g.cfg.StateFile, cur); err != nil {
+		return fmt.Errorf("saving state: %w", err)
+	}
+	return nil
+}
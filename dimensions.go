@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// Dimensions generated besides the country sets with -dimensions
+const (
+	dimensionContinent = "continent"
+	dimensionASN       = "asn"
+)
+
+// dimension classifies the networks by another field of their records.
+// Its sets are filled in the same traversal of the database as the
+// country sets, which is the dominant cost of a run, and written to
+// geoip_<dimension>_<family>.nft.
+type dimension struct {
+	name string
+	// classify returns the set of a record, empty when it has none
+	classify   func(result maxminddb.Result) (string, error)
+	ipv4, ipv6 geonft.Sets
+}
+
+// newDimensions returns the dimensions selected with -dimensions, or an
+// error when schema lacks the field of one.
+func newDimensions(names []string, schema geonft.Schema) ([]*dimension, error) {
+	var dims []*dimension
+	for _, name := range names {
+		d := &dimension{name: name, ipv4: make(geonft.Sets), ipv6: make(geonft.Sets)}
+		switch name {
+		case dimensionContinent:
+			if schema.ContinentPath == nil {
+				return nil, fmt.Errorf("the %s schema has no continent field", schema.Name)
+			}
+			// Continent codes like AS or NA are also country codes, the
+			// sets of all files share the table
+			d.classify = func(result maxminddb.Result) (string, error) {
+				code, err := schema.ContinentCode(result)
+				if code == "" {
+					return "", err
+				}
+				return "continent_" + code, nil
+			}
+		case dimensionASN:
+			if schema.ASNPath == nil {
+				return nil, fmt.Errorf("the %s schema has no autonomous system field", schema.Name)
+			}
+			d.classify = schema.ASN
+		}
+		dims = append(dims, d)
+	}
+	return dims, nil
+}
+
+// classifyDimensions adds the network pfx to the sets of every dimension
+// of the shard. Records without the field are left out of the dimension.
+func (s *loadShard) classifyDimensions(dims []*dimension, pfx netip.Prefix, result maxminddb.Result) {
+	for i, d := range dims {
+		name, err := d.classify(result)
+		if err != nil || name == "" {
+			continue
+		}
+		s.dims[i].Add(name, pfx)
+	}
+}
+
+// finishDimensions applies the set changes of prepare that concern every
+// dimension: reserved ranges, overly broad prefixes and -within.
+func (g *geoIPGenerator) finishDimensions() {
+	within := g.cfg.withinPrefixes()
+	for _, d := range g.dimensions {
+		if g.cfg.StripReserved {
+			d.ipv4.Subtract(geonft.MergePrefixes(reservedIPv4))
+			d.ipv6.Subtract(geonft.MergePrefixes(reservedIPv6))
+		}
+		// Their warnings were logged for the country sets
+		dropBroadPrefixes(d.ipv4, g.cfg.MinPrefixIPv4)
+		dropBroadPrefixes(d.ipv6, g.cfg.MinPrefixIPv6)
+		if within != nil {
+			d.ipv4.Intersect(within)
+			d.ipv6.Intersect(within)
+		}
+		slog.Info("Generated dimension", "dimension", d.name, "ipv4_sets", len(d.ipv4), "ipv6_sets", len(d.ipv6))
+	}
+}
+
+// dimensionArtifacts lists the files of the dimensions.
+func (g *geoIPGenerator) dimensionArtifacts() []artifact {
+	var list []artifact
+	for _, d := range g.dimensions {
+		for _, family := range []struct {
+			sets   geonft.Sets
+			ipType string
+		}{{d.ipv4, "ipv4"}, {d.ipv6, "ipv6"}} {
+			if !g.cfg.family(family.ipType) {
+				continue
+			}
+			a := g.globalArtifact(family.sets, family.ipType)
+			a.path = fmt.Sprintf("geoip_%s_%s%s", d.name, family.ipType, g.cfg.setFileExt())
+			list = append(list, a)
+		}
+	}
+	return list
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Process exit codes. Download failures are usually transient and worth
+// a retry, the others need a human.
+const (
+	exitFailure      = 1
+	exitUsage        = 2
+	exitStale        = 3
+	exitDownload     = 4
+	exitParse        = 5
+	exitValidation   = 6
+	exitGeneration   = 7
+	exitVerification = 8
+	exitApply        = 9
+)
+
+// exitError attaches a specific process exit code to an error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func withExitCode(code int, format string, args ...any) error {
+	return &exitError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// classify attaches code to err unless it already carries a more specific
+// one, such as exitStale from within the validation.
+func classify(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return err
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code carried by err, or exitFailure.
+func exitCode(err error) int {
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return exitFailure
+}
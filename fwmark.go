@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// Files of the -fwmark bundle, next to the global files
+const (
+	fwmarkFile   = "geoip_fwmark.nft"
+	fwmarkScript = "geoip_fwmark.sh"
+)
+
+var interfaceName = regexp.MustCompile(`^[A-Za-z0-9_.@-]{1,15}$`)
+
+// fwmark marks the traffic to a group of sets, like US+CA=0x1.
+type fwmark struct {
+	sets []string
+	mark uint32
+}
+
+func parseFwmark(s string) (fwmark, error) {
+	sets, mark, ok := strings.Cut(s, "=")
+	if !ok {
+		return fwmark{}, fmt.Errorf("%q is not SETS=MARK", s)
+	}
+	m, err := parseMark(mark)
+	if err != nil {
+		return fwmark{}, fmt.Errorf("invalid mark in %q: %w", s, err)
+	}
+	f := fwmark{sets: strings.Split(sets, "+"), mark: m}
+	for _, set := range f.sets {
+		if !isValidSetName(set) {
+			return fwmark{}, fmt.Errorf("invalid set name %q in %q", set, s)
+		}
+	}
+	return f, nil
+}
+
+// parseMark parses a non-zero mark, hexadecimal with 0x or decimal.
+func parseMark(s string) (uint32, error) {
+	m, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, err
+	}
+	if m == 0 {
+		return 0, fmt.Errorf("mark must not be 0")
+	}
+	return uint32(m), nil
+}
+
+// fwmarkRoute is where the traffic with a mark leaves, like 0x1=wg0 or
+// 0x2=192.0.2.1+2001:db8::1: interfaces, or gateways of either family.
+type fwmarkRoute struct {
+	mark    uint32
+	targets []string
+}
+
+func parseFwmarkRoute(s string) (fwmarkRoute, error) {
+	mark, targets, ok := strings.Cut(s, "=")
+	if !ok || targets == "" {
+		return fwmarkRoute{}, fmt.Errorf("%q is not MARK=ROUTE", s)
+	}
+	m, err := parseMark(mark)
+	if err != nil {
+		return fwmarkRoute{}, fmt.Errorf("invalid mark in %q: %w", s, err)
+	}
+	r := fwmarkRoute{mark: m, targets: strings.Split(targets, "+")}
+	for _, target := range r.targets {
+		if _, err := netip.ParseAddr(target); err != nil && !interfaceName.MatchString(target) {
+			return fwmarkRoute{}, fmt.Errorf("route %q in %q is neither a gateway address nor an interface", target, s)
+		}
+	}
+	return r, nil
+}
+
+// fwmarkArtifacts renders the bundle: geoip_fwmark.nft marks the traffic
+// to the selected sets through an interval map per family, and
+// geoip_fwmark.sh routes every mark through its own routing table. The nft
+// objects are declared and flushed first, so that loading the file again
+// replaces them.
+func (g *geoIPGenerator) fwmarkArtifacts() []artifact {
+	// Validated with the configuration
+	var marks []fwmark
+	for _, s := range g.cfg.Fwmarks {
+		m, _ := parseFwmark(s)
+		marks = append(marks, m)
+	}
+	routes := make(map[uint32][]string)
+	for _, s := range g.cfg.FwmarkRoutes {
+		r, _ := parseFwmarkRoute(s)
+		routes[r.mark] = r.targets
+	}
+
+	type family struct {
+		name, match, ip string
+		sets            geonft.Sets
+	}
+	var families []family
+	for _, f := range []family{{"ipv4", "ip", "ip", g.ipv4}, {"ipv6", "ip6", "ip -6", g.ipv6}} {
+		if g.cfg.family(f.name) {
+			families = append(families, f)
+		}
+	}
+
+	nftFile := artifact{
+		path: fwmarkFile,
+		render: func(w io.Writer) error {
+			fmt.Fprintln(w, "#!/usr/sbin/nft -f")
+			fmt.Fprintf(w, "table %s {\n", g.cfg.table())
+			for _, f := range families {
+				fmt.Fprintf(w, "    map fwmark_%s {\n        type %s_addr : mark\n        flags interval\n    }\n", f.name, f.name)
+			}
+			// Forwarded traffic is marked before routing, local traffic
+			// is routed again once marked
+			mangle := g.features.priority("mangle")
+			fmt.Fprintf(w, "    chain fwmark_prerouting {\n        type filter hook prerouting priority %s; policy accept;\n    }\n", mangle)
+			fmt.Fprintf(w, "    chain fwmark_output {\n        type route hook output priority %s; policy accept;\n    }\n}\n", mangle)
+			for _, f := range families {
+				fmt.Fprintf(w, "flush map %s fwmark_%s\n", g.cfg.table(), f.name)
+			}
+			fmt.Fprintf(w, "flush chain %s fwmark_prerouting\n", g.cfg.table())
+			fmt.Fprintf(w, "flush chain %s fwmark_output\n", g.cfg.table())
+
+			fmt.Fprintf(w, "table %s {\n", g.cfg.table())
+			for _, f := range families {
+				if err := writeFwmarkMap(w, f.name, f.sets, marks); err != nil {
+					return err
+				}
+			}
+			for _, chain := range []string{"fwmark_prerouting", "fwmark_output"} {
+				fmt.Fprintf(w, "    chain %s {\n", chain)
+				for _, f := range families {
+					fmt.Fprintf(w, "        meta mark set %s daddr map @fwmark_%s\n", f.match, f.name)
+				}
+				fmt.Fprintln(w, "    }")
+			}
+			_, err := fmt.Fprintln(w, "}")
+			return err
+		},
+	}
+
+	script := artifact{
+		path: fwmarkScript,
+		render: func(w io.Writer) error {
+			fmt.Fprintf(w, "#!/bin/sh\n# Routes the marks of %s, run after loading it\nset -e\n", fwmarkFile)
+			for _, m := range marks {
+				table := g.cfg.FwmarkTable + int(m.mark)
+				fmt.Fprintf(w, "\n# %s\n", strings.Join(m.sets, "+"))
+				for _, f := range families {
+					fmt.Fprintf(w, "%s rule del fwmark 0x%x table %d 2>/dev/null || true\n", f.ip, m.mark, table)
+					fmt.Fprintf(w, "%s rule add fwmark 0x%x table %d\n", f.ip, m.mark, table)
+					for _, target := range routes[m.mark] {
+						addr, err := netip.ParseAddr(target)
+						switch {
+						case err != nil:
+							fmt.Fprintf(w, "%s route replace default dev %s table %d\n", f.ip, target, table)
+						case addr.Is4() == (f.name == "ipv4"):
+							fmt.Fprintf(w, "%s route replace default via %s table %d\n", f.ip, addr, table)
+						}
+					}
+				}
+			}
+			return nil
+		},
+	}
+
+	return []artifact{nftFile, script}
+}
+
+// writeFwmarkMap writes the interval map of family, mapping the prefixes of
+// the sets of every group to its mark. Interval maps reject overlapping
+// elements, so a prefix inside one already mapped, e.g. from a -bogon-set,
+// is left out.
+func writeFwmarkMap(w io.Writer, family string, sets geonft.Sets, marks []fwmark) error {
+	type element struct {
+		prefix netip.Prefix
+		mark   uint32
+	}
+	var elements []element
+	for _, m := range marks {
+		for _, set := range m.sets {
+			if sets[set].Len() == 0 {
+				slog.Warn("Marked set was not generated", "set", set, "family", family)
+			}
+			for p := range sets[set].All() {
+				elements = append(elements, element{p, m.mark})
+			}
+		}
+	}
+	slices.SortStableFunc(elements, func(a, b element) int {
+		if c := a.prefix.Addr().Compare(b.prefix.Addr()); c != 0 {
+			return c
+		}
+		return a.prefix.Bits() - b.prefix.Bits()
+	})
+
+	fmt.Fprintf(w, "    map fwmark_%s {\n        type %s_addr : mark\n        flags interval\n", family, family)
+	if len(elements) > 0 {
+		io.WriteString(w, "        elements = { ")
+		var last netip.Prefix
+		buf := make([]byte, 0, 64)
+		for _, e := range elements {
+			if last.IsValid() && last.Contains(e.prefix.Addr()) {
+				continue
+			}
+			buf = buf[:0]
+			if last.IsValid() {
+				buf = append(buf, ", "...)
+			}
+			buf = e.prefix.AppendTo(buf)
+			buf = fmt.Appendf(buf, " : 0x%x", e.mark)
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			last = e.prefix
+		}
+		io.WriteString(w, " }\n")
+	}
+	_, err := io.WriteString(w, "    }\n")
+	return err
+}
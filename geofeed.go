@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// geofeedEntry is a single RFC 8805 prefix to country assignment. An empty
+// code means the network owner does not attribute the prefix to a country.
+type geofeedEntry struct {
+	prefix netip.Prefix
+	code   string
+}
+
+// applyGeofeeds lets the assignments of the fetched geofeeds override the
+// database. More specific feed entries win over broader ones and later
+// feeds win over earlier ones for identical prefixes.
+func (g *geoIPGenerator) applyGeofeeds(feeds [][]geofeedEntry) error {
+	if len(feeds) == 0 {
+		return nil
+	}
+
+	byPrefix := make(map[netip.Prefix]string)
+	for _, entries := range feeds {
+		for _, e := range entries {
+			byPrefix[e.prefix] = e.code
+		}
+	}
+
+	var v4, v6 []netip.Prefix
+	for p := range byPrefix {
+		if p.Addr().Is4() {
+			v4 = append(v4, p)
+		} else {
+			v6 = append(v6, p)
+		}
+	}
+
+	g.overrideFamily(g.ipv4, v4, byPrefix)
+	g.overrideFamily(g.ipv6, v6, byPrefix)
+
+	return nil
+}
+
+// overrideFamily removes the space covered by the feed prefixes from every
+// set and re-adds it under the codes assigned by the feeds.
+func (g *geoIPGenerator) overrideFamily(countryMap geonft.Sets, feed []netip.Prefix, codes map[netip.Prefix]string) {
+	if len(feed) == 0 {
+		return
+	}
+
+	countryMap.Subtract(geonft.MergePrefixes(feed))
+
+	// Nested feed prefixes follow their broader entry in sorted order
+	geonft.SortPrefixes(feed)
+	added := make(map[string][]netip.Prefix)
+	for i, p := range feed {
+		var nested []netip.Prefix
+		for _, q := range feed[i+1:] {
+			if !p.Contains(q.Addr()) {
+				break
+			}
+			nested = append(nested, q)
+		}
+
+		code := codes[p]
+		if code == "" {
+			if g.cfg.UnknownSet == "" {
+				continue
+			}
+			code = g.cfg.UnknownSet
+		}
+
+		if len(nested) == 0 {
+			added[code] = append(added[code], p)
+			continue
+		}
+		added[code] = append(added[code], geonft.SubtractPrefixes(p, geonft.MergePrefixes(nested))...)
+	}
+
+	for code, feedPrefixes := range added {
+		prefixes := append(countryMap[code].Unpack(), feedPrefixes...)
+		geonft.SortPrefixes(prefixes)
+		countryMap[code] = geonft.PackPrefixes(prefixes)
+	}
+}
+
+// loadGeofeed reads a geofeed from an http(s) URL or a local file.
+func (g *geoIPGenerator) loadGeofeed(ctx context.Context, source string) ([]geofeedEntry, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return g.parseGeofeed(f)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+
+	return g.parseGeofeed(io.LimitReader(resp.Body, maxDownloadSize))
+}
+
+// parseGeofeed parses the RFC 8805 CSV format:
+// ip_prefix,alpha2code,region,city,postal_code
+func (g *geoIPGenerator) parseGeofeed(r io.Reader) ([]geofeedEntry, error) {
+	var entries []geofeedEntry
+	rejected := 0
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		prefix, err := parseGeofeedPrefix(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		var code string
+		if len(fields) > 1 {
+			code = strings.ToUpper(strings.TrimSpace(fields[1]))
+		}
+		if code != "" && !g.validator.accepts(code) {
+			rejected++
+			continue
+		}
+
+		entries = append(entries, geofeedEntry{prefix: prefix, code: code})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading geofeed: %w", err)
+	}
+
+	if rejected > 0 {
+		slog.Warn("Skipped geofeed entries with rejected country codes", "entries", rejected)
+	}
+
+	return entries, nil
+}
+
+// parseGeofeedPrefix accepts a prefix or a single address.
+func parseGeofeedPrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid prefix %q", s)
+		}
+		return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %q", s)
+	}
+	return geonft.UnmapPrefix(prefix.Masked()), nil
+}
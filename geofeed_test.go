@@ -0,0 +1,209 @@
+package main
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+func TestParseGeofeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		feed    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "fields",
+			feed: "# comment\n\n192.0.2.0/24,DE,DE-BE,Berlin,\n2001:db8::/32,fr\n",
+			want: []string{"192.0.2.0/24 DE", "2001:db8::/32 FR"},
+		},
+		{
+			name: "addresses",
+			feed: "192.0.2.1,US\n2001:db8::1,US\n::ffff:198.51.100.1,US\n",
+			want: []string{"192.0.2.1/32 US", "2001:db8::1/128 US", "198.51.100.1/32 US"},
+		},
+		{
+			name: "unmasked and mapped prefixes",
+			feed: "192.0.2.77/24,US\n::ffff:198.51.100.0/120,US\n",
+			want: []string{"192.0.2.0/24 US", "198.51.100.0/24 US"},
+		},
+		{
+			name: "empty code",
+			feed: "192.0.2.0/24,\n198.51.100.0/24\n",
+			want: []string{"192.0.2.0/24 ", "198.51.100.0/24 "},
+		},
+		{
+			name: "rejected codes",
+			feed: "192.0.2.0/24,D1\n198.51.100.0/24,XK\n203.0.113.0/24,JP\n",
+			args: []string{"-code-validation", "strict"},
+			want: []string{"203.0.113.0/24 JP"},
+		},
+		{
+			name:    "invalid prefix",
+			feed:    "192.0.2.0/24,DE\n192.0.2.0/33,DE\n",
+			wantErr: `line 2: invalid prefix "192.0.2.0/33"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseFlags(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := newGeoIPGenerator(t.Context(), cfg).parseGeofeed(strings.NewReader(tt.feed))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseGeofeed() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.prefix.String()+" "+e.code)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyGeofeeds(t *testing.T) {
+	db := map[string][]string{
+		"DE": {"10.0.0.0/8", "2001:db8::/32"},
+		"NL": {"192.0.2.0/24"},
+	}
+
+	tests := []struct {
+		name  string
+		feeds []string
+		args  []string
+		want  map[string][]string
+	}{
+		{
+			name:  "override",
+			feeds: []string{"10.1.0.0/16,FR\n2001:db8:1::/48,FR\n"},
+			want: map[string][]string{
+				"DE": {"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9",
+					"2001:db8::/48", "2001:db8:2::/47", "2001:db8:4::/46", "2001:db8:8::/45", "2001:db8:10::/44", "2001:db8:20::/43",
+					"2001:db8:40::/42", "2001:db8:80::/41", "2001:db8:100::/40", "2001:db8:200::/39", "2001:db8:400::/38",
+					"2001:db8:800::/37", "2001:db8:1000::/36", "2001:db8:2000::/35", "2001:db8:4000::/34", "2001:db8:8000::/33"},
+				"FR": {"10.1.0.0/16", "2001:db8:1::/48"},
+				"NL": {"192.0.2.0/24"},
+			},
+		},
+		{
+			name:  "nested prefixes",
+			feeds: []string{"192.0.2.128/25,BE\n192.0.0.0/16,LU\n"},
+			want: map[string][]string{
+				"BE": {"192.0.2.128/25"},
+				"DE": {"10.0.0.0/8", "2001:db8::/32"},
+				"LU": {"192.0.0.0/23", "192.0.2.0/25", "192.0.3.0/24", "192.0.4.0/22", "192.0.8.0/21", "192.0.16.0/20", "192.0.32.0/19", "192.0.64.0/18", "192.0.128.0/17"},
+			},
+		},
+		{
+			name:  "empty code",
+			feeds: []string{"192.0.2.0/25,\n"},
+			want: map[string][]string{
+				"DE": {"10.0.0.0/8", "2001:db8::/32"},
+				"NL": {"192.0.2.128/25"},
+			},
+		},
+		{
+			name:  "empty code with -unknown-set",
+			feeds: []string{"192.0.2.0/25,\n"},
+			args:  []string{"-unknown-set", "unknown"},
+			want: map[string][]string{
+				"DE":      {"10.0.0.0/8", "2001:db8::/32"},
+				"NL":      {"192.0.2.128/25"},
+				"unknown": {"192.0.2.0/25"},
+			},
+		},
+		{
+			name:  "empty code nested in a coded prefix",
+			feeds: []string{"192.0.2.0/24,BE\n192.0.2.0/25,\n"},
+			want: map[string][]string{
+				"BE": {"192.0.2.128/25"},
+				"DE": {"10.0.0.0/8", "2001:db8::/32"},
+			},
+		},
+		{
+			name:  "later feed wins",
+			feeds: []string{"192.0.2.0/24,BE\n", "192.0.2.0/24,LU\n"},
+			want: map[string][]string{
+				"DE": {"10.0.0.0/8", "2001:db8::/32"},
+				"LU": {"192.0.2.0/24"},
+			},
+		},
+		{
+			name:  "later feed removes the code",
+			feeds: []string{"192.0.2.0/24,BE\n", "192.0.2.0/24,\n"},
+			args:  []string{"-unknown-set", "unknown"},
+			want: map[string][]string{
+				"DE":      {"10.0.0.0/8", "2001:db8::/32"},
+				"unknown": {"192.0.2.0/24"},
+			},
+		},
+		{
+			name:  "later feed more specific",
+			feeds: []string{"192.0.2.0/25,\n", "192.0.2.0/24,BE\n"},
+			want: map[string][]string{
+				"DE": {"10.0.0.0/8", "2001:db8::/32"},
+				"BE": {"192.0.2.128/25"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseFlags(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := newGeoIPGenerator(t.Context(), cfg)
+			for code, prefixes := range db {
+				for _, s := range prefixes {
+					p := netip.MustParsePrefix(s)
+					sets := g.ipv4
+					if p.Addr().Is6() {
+						sets = g.ipv6
+					}
+					sets[code] = geonft.PackPrefixes(append(sets[code].Unpack(), p))
+				}
+			}
+
+			var feeds [][]geofeedEntry
+			for _, feed := range tt.feeds {
+				entries, err := g.parseGeofeed(strings.NewReader(feed))
+				if err != nil {
+					t.Fatal(err)
+				}
+				feeds = append(feeds, entries)
+			}
+			if err := g.applyGeofeeds(feeds); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string][]string)
+			for _, sets := range []geonft.Sets{g.ipv4, g.ipv6} {
+				for code, prefixes := range sets {
+					for _, p := range geonft.MergePrefixes(prefixes.Unpack()) {
+						got[code] = append(got[code], p.String())
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
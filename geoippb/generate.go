@@ -0,0 +1,4 @@
+// Package geoippb contains the gRPC API of the serve command.
+package geoippb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative geoip.proto
@@ -0,0 +1,617 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: geoip.proto
+
+package geoippb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LookupRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupRequest) Reset() {
+	*x = LookupRequest{}
+	mi := &file_geoip_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupRequest) ProtoMessage() {}
+
+func (x *LookupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geoip_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupRequest.ProtoReflect.Descriptor instead.
+func (*LookupRequest) Descriptor() ([]byte, []int) {
+	return file_geoip_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LookupRequest) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+type Place struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Place) Reset() {
+	*x = Place{}
+	mi := &file_geoip_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Place) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Place) ProtoMessage() {}
+
+func (x *Place) ProtoReflect() protoreflect.Message {
+	mi := &file_geoip_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Place.ProtoReflect.Descriptor instead.
+func (*Place) Descriptor() ([]byte, []int) {
+	return file_geoip_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Place) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Place) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type ASN struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Number        uint32                 `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Organization  string                 `protobuf:"bytes,2,opt,name=organization,proto3" json:"organization,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ASN) Reset() {
+	*x = ASN{}
+	mi := &file_geoip_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ASN) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ASN) ProtoMessage() {}
+
+func (x *ASN) ProtoReflect() protoreflect.Message {
+	mi := &file_geoip_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ASN.ProtoReflect.Descriptor instead.
+func (*ASN) Descriptor() ([]byte, []int) {
+	return file_geoip_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ASN) GetNumber() uint32 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *ASN) GetOrganization() string {
+	if x != nil {
+		return x.Organization
+	}
+	return ""
+}
+
+type LookupResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Network       string                 `protobuf:"bytes,2,opt,name=network,proto3" json:"network,omitempty"`
+	Country       *Place                 `protobuf:"bytes,3,opt,name=country,proto3" json:"country,omitempty"`
+	Continent     *Place                 `protobuf:"bytes,4,opt,name=continent,proto3" json:"continent,omitempty"`
+	Asn           *ASN                   `protobuf:"bytes,5,opt,name=asn,proto3" json:"asn,omitempty"`
+	Sets          []string               `protobuf:"bytes,6,rep,name=sets,proto3" json:"sets,omitempty"`
+	BuildEpoch    uint64                 `protobuf:"varint,7,opt,name=build_epoch,json=buildEpoch,proto3" json:"build_epoch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupResponse) Reset() {
+	*x = LookupResponse{}
+	mi := &file_geoip_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupResponse) ProtoMessage() {}
+
+func (x *LookupResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_geoip_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupResponse.ProtoReflect.Descriptor instead.
+func (*LookupResponse) Descriptor() ([]byte, []int) {
+	return file_geoip_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *LookupResponse) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetCountry() *Place {
+	if x != nil {
+		return x.Country
+	}
+	return nil
+}
+
+func (x *LookupResponse) GetContinent() *Place {
+	if x != nil {
+		return x.Continent
+	}
+	return nil
+}
+
+func (x *LookupResponse) GetAsn() *ASN {
+	if x != nil {
+		return x.Asn
+	}
+	return nil
+}
+
+func (x *LookupResponse) GetSets() []string {
+	if x != nil {
+		return x.Sets
+	}
+	return nil
+}
+
+func (x *LookupResponse) GetBuildEpoch() uint64 {
+	if x != nil {
+		return x.BuildEpoch
+	}
+	return 0
+}
+
+type GetManifestRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetManifestRequest) Reset() {
+	*x = GetManifestRequest{}
+	mi := &file_geoip_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetManifestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetManifestRequest) ProtoMessage() {}
+
+func (x *GetManifestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geoip_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetManifestRequest.ProtoReflect.Descriptor instead.
+func (*GetManifestRequest) Descriptor() ([]byte, []int) {
+	return file_geoip_proto_rawDescGZIP(), []int{4}
+}
+
+type ManifestFile struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Size          int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Sha256        string                 `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ManifestFile) Reset() {
+	*x = ManifestFile{}
+	mi := &file_geoip_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ManifestFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ManifestFile) ProtoMessage() {}
+
+func (x *ManifestFile) ProtoReflect() protoreflect.Message {
+	mi := &file_geoip_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ManifestFile.ProtoReflect.Descriptor instead.
+func (*ManifestFile) Descriptor() ([]byte, []int) {
+	return file_geoip_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ManifestFile) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ManifestFile) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *ManifestFile) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+type Manifest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DatabaseType  string                 `protobuf:"bytes,1,opt,name=database_type,json=databaseType,proto3" json:"database_type,omitempty"`
+	BuildEpoch    uint64                 `protobuf:"varint,2,opt,name=build_epoch,json=buildEpoch,proto3" json:"build_epoch,omitempty"`
+	Generated     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=generated,proto3" json:"generated,omitempty"`
+	Files         []*ManifestFile        `protobuf:"bytes,4,rep,name=files,proto3" json:"files,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Manifest) Reset() {
+	*x = Manifest{}
+	mi := &file_geoip_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Manifest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Manifest) ProtoMessage() {}
+
+func (x *Manifest) ProtoReflect() protoreflect.Message {
+	mi := &file_geoip_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Manifest.ProtoReflect.Descriptor instead.
+func (*Manifest) Descriptor() ([]byte, []int) {
+	return file_geoip_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Manifest) GetDatabaseType() string {
+	if x != nil {
+		return x.DatabaseType
+	}
+	return ""
+}
+
+func (x *Manifest) GetBuildEpoch() uint64 {
+	if x != nil {
+		return x.BuildEpoch
+	}
+	return 0
+}
+
+func (x *Manifest) GetGenerated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Generated
+	}
+	return nil
+}
+
+func (x *Manifest) GetFiles() []*ManifestFile {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+type TriggerRefreshRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TriggerRefreshRequest) Reset() {
+	*x = TriggerRefreshRequest{}
+	mi := &file_geoip_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TriggerRefreshRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TriggerRefreshRequest) ProtoMessage() {}
+
+func (x *TriggerRefreshRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geoip_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TriggerRefreshRequest.ProtoReflect.Descriptor instead.
+func (*TriggerRefreshRequest) Descriptor() ([]byte, []int) {
+	return file_geoip_proto_rawDescGZIP(), []int{7}
+}
+
+type TriggerRefreshResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Manifest      *Manifest              `protobuf:"bytes,1,opt,name=manifest,proto3" json:"manifest,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TriggerRefreshResponse) Reset() {
+	*x = TriggerRefreshResponse{}
+	mi := &file_geoip_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TriggerRefreshResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TriggerRefreshResponse) ProtoMessage() {}
+
+func (x *TriggerRefreshResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_geoip_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TriggerRefreshResponse.ProtoReflect.Descriptor instead.
+func (*TriggerRefreshResponse) Descriptor() ([]byte, []int) {
+	return file_geoip_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TriggerRefreshResponse) GetManifest() *Manifest {
+	if x != nil {
+		return x.Manifest
+	}
+	return nil
+}
+
+var File_geoip_proto protoreflect.FileDescriptor
+
+const file_geoip_proto_rawDesc = "" +
+	"\n" +
+	"\vgeoip.proto\x12\bgeoip.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x1f\n" +
+	"\rLookupRequest\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\"/\n" +
+	"\x05Place\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"A\n" +
+	"\x03ASN\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\rR\x06number\x12\"\n" +
+	"\forganization\x18\x02 \x01(\tR\forganization\"\xea\x01\n" +
+	"\x0eLookupResponse\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x18\n" +
+	"\anetwork\x18\x02 \x01(\tR\anetwork\x12)\n" +
+	"\acountry\x18\x03 \x01(\v2\x0f.geoip.v1.PlaceR\acountry\x12-\n" +
+	"\tcontinent\x18\x04 \x01(\v2\x0f.geoip.v1.PlaceR\tcontinent\x12\x1f\n" +
+	"\x03asn\x18\x05 \x01(\v2\r.geoip.v1.ASNR\x03asn\x12\x12\n" +
+	"\x04sets\x18\x06 \x03(\tR\x04sets\x12\x1f\n" +
+	"\vbuild_epoch\x18\a \x01(\x04R\n" +
+	"buildEpoch\"\x14\n" +
+	"\x12GetManifestRequest\"N\n" +
+	"\fManifestFile\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06sha256\x18\x03 \x01(\tR\x06sha256\"\xb8\x01\n" +
+	"\bManifest\x12#\n" +
+	"\rdatabase_type\x18\x01 \x01(\tR\fdatabaseType\x12\x1f\n" +
+	"\vbuild_epoch\x18\x02 \x01(\x04R\n" +
+	"buildEpoch\x128\n" +
+	"\tgenerated\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tgenerated\x12,\n" +
+	"\x05files\x18\x04 \x03(\v2\x16.geoip.v1.ManifestFileR\x05files\"\x17\n" +
+	"\x15TriggerRefreshRequest\"H\n" +
+	"\x16TriggerRefreshResponse\x12.\n" +
+	"\bmanifest\x18\x01 \x01(\v2\x12.geoip.v1.ManifestR\bmanifest2\xda\x01\n" +
+	"\x05GeoIP\x12;\n" +
+	"\x06Lookup\x12\x17.geoip.v1.LookupRequest\x1a\x18.geoip.v1.LookupResponse\x12?\n" +
+	"\vGetManifest\x12\x1c.geoip.v1.GetManifestRequest\x1a\x12.geoip.v1.Manifest\x12S\n" +
+	"\x0eTriggerRefresh\x12\x1f.geoip.v1.TriggerRefreshRequest\x1a .geoip.v1.TriggerRefreshResponseB+Z)github.com/kkrow/maxminddb-to-nft/geoippbb\x06proto3"
+
+var (
+	file_geoip_proto_rawDescOnce sync.Once
+	file_geoip_proto_rawDescData []byte
+)
+
+func file_geoip_proto_rawDescGZIP() []byte {
+	file_geoip_proto_rawDescOnce.Do(func() {
+		file_geoip_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_geoip_proto_rawDesc), len(file_geoip_proto_rawDesc)))
+	})
+	return file_geoip_proto_rawDescData
+}
+
+var file_geoip_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_geoip_proto_goTypes = []any{
+	(*LookupRequest)(nil),          // 0: geoip.v1.LookupRequest
+	(*Place)(nil),                  // 1: geoip.v1.Place
+	(*ASN)(nil),                    // 2: geoip.v1.ASN
+	(*LookupResponse)(nil),         // 3: geoip.v1.LookupResponse
+	(*GetManifestRequest)(nil),     // 4: geoip.v1.GetManifestRequest
+	(*ManifestFile)(nil),           // 5: geoip.v1.ManifestFile
+	(*Manifest)(nil),               // 6: geoip.v1.Manifest
+	(*TriggerRefreshRequest)(nil),  // 7: geoip.v1.TriggerRefreshRequest
+	(*TriggerRefreshResponse)(nil), // 8: geoip.v1.TriggerRefreshResponse
+	(*timestamppb.Timestamp)(nil),  // 9: google.protobuf.Timestamp
+}
+var file_geoip_proto_depIdxs = []int32{
+	1, // 0: geoip.v1.LookupResponse.country:type_name -> geoip.v1.Place
+	1, // 1: geoip.v1.LookupResponse.continent:type_name -> geoip.v1.Place
+	2, // 2: geoip.v1.LookupResponse.asn:type_name -> geoip.v1.ASN
+	9, // 3: geoip.v1.Manifest.generated:type_name -> google.protobuf.Timestamp
+	5, // 4: geoip.v1.Manifest.files:type_name -> geoip.v1.ManifestFile
+	6, // 5: geoip.v1.TriggerRefreshResponse.manifest:type_name -> geoip.v1.Manifest
+	0, // 6: geoip.v1.GeoIP.Lookup:input_type -> geoip.v1.LookupRequest
+	4, // 7: geoip.v1.GeoIP.GetManifest:input_type -> geoip.v1.GetManifestRequest
+	7, // 8: geoip.v1.GeoIP.TriggerRefresh:input_type -> geoip.v1.TriggerRefreshRequest
+	3, // 9: geoip.v1.GeoIP.Lookup:output_type -> geoip.v1.LookupResponse
+	6, // 10: geoip.v1.GeoIP.GetManifest:output_type -> geoip.v1.Manifest
+	8, // 11: geoip.v1.GeoIP.TriggerRefresh:output_type -> geoip.v1.TriggerRefreshResponse
+	9, // [9:12] is the sub-list for method output_type
+	6, // [6:9] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_geoip_proto_init() }
+func file_geoip_proto_init() {
+	if File_geoip_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_geoip_proto_rawDesc), len(file_geoip_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_geoip_proto_goTypes,
+		DependencyIndexes: file_geoip_proto_depIdxs,
+		MessageInfos:      file_geoip_proto_msgTypes,
+	}.Build()
+	File_geoip_proto = out.File
+	file_geoip_proto_goTypes = nil
+	file_geoip_proto_depIdxs = nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultGitMessage = `Update GeoIP sets to {{.DatabaseType}} build {{.BuildTime}}
+
+{{.FilesChanged}} files changed
+{{- if .HasDiff}}, {{.SetsChanged}} sets changed (+{{.PrefixesAdded}} -{{.PrefixesRemoved}} prefixes){{end}}
+Database build epoch: {{.BuildEpoch}}
+`
+
+// gitCommitInfo is the data available to the -git-message template.
+type gitCommitInfo struct {
+	DatabaseType string
+	BuildEpoch   uint
+	BuildTime    string
+	FilesChanged int
+	// Set statistics are only known with -state-file
+	HasDiff         bool
+	SetsChanged     int
+	PrefixesAdded   int
+	PrefixesRemoved int
+}
+
+// publishGit commits the outputs to -git-path of a fresh shallow clone of
+// -git-branch and pushes it. Nothing is committed when no file changed.
+func (g *geoIPGenerator) publishGit() error {
+	tmpl, err := template.New("message").Parse(g.cfg.GitMessage)
+	if err != nil {
+		return fmt.Errorf("parsing -git-message: %w", err)
+	}
+
+	files, err := g.relativeOutputs()
+	if err != nil {
+		return err
+	}
+
+	clone, err := os.MkdirTemp("", "geoip-git-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(clone)
+
+	if _, err := runGit(g.ctx, "", "clone", "--quiet", "--depth", "1", "--single-branch",
+		"--branch", g.cfg.GitBranch, g.cfg.GitRepo, clone); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(clone, g.cfg.GitPath)
+	for _, file := range files {
+		if err := g.copyOutput(filepath.Join(g.cfg.OutputDir, file), filepath.Join(dest, file)); err != nil {
+			return fmt.Errorf("copying %s: %w", file, err)
+		}
+	}
+
+	pathspec := filepath.Clean(g.cfg.GitPath)
+	if _, err := runGit(g.ctx, clone, "add", "--all", "--", pathspec); err != nil {
+		return err
+	}
+	changed, err := runGit(g.ctx, clone, "diff", "--cached", "--name-only")
+	if err != nil {
+		return err
+	}
+	if changed == "" {
+		slog.Info("No changes to commit", "repo", g.cfg.GitRepo, "branch", g.cfg.GitBranch)
+		return nil
+	}
+
+	info := g.gitCommitInfo(len(strings.Split(changed, "\n")))
+	var message strings.Builder
+	if err := tmpl.Execute(&message, info); err != nil {
+		return fmt.Errorf("rendering -git-message: %w", err)
+	}
+
+	if g.cfg.PublishDryRun {
+		slog.Info("Dry run, would commit", "files", info.FilesChanged, "repo", g.cfg.GitRepo, "branch", g.cfg.GitBranch,
+			"message", message.String())
+		return nil
+	}
+
+	cmd := exec.CommandContext(g.ctx, "git", "-C", clone, "commit", "--quiet", "--file", "-")
+	cmd.Stdin = strings.NewReader(message.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git commit: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	if _, err := runGit(g.ctx, clone, "push", "--quiet", "origin", "HEAD:"+g.cfg.GitBranch); err != nil {
+		return err
+	}
+
+	slog.Info("Committed changed files", "files", info.FilesChanged, "repo", g.cfg.GitRepo, "branch", g.cfg.GitBranch)
+	return nil
+}
+
+func (g *geoIPGenerator) gitCommitInfo(filesChanged int) gitCommitInfo {
+	info := gitCommitInfo{
+		DatabaseType: g.metadata.DatabaseType,
+		BuildEpoch:   g.metadata.BuildEpoch,
+		BuildTime:    time.Unix(int64(g.metadata.BuildEpoch), 0).UTC().Format(time.RFC3339),
+		FilesChanged: filesChanged,
+	}
+	if g.diff != nil {
+		info.HasDiff = true
+		info.SetsChanged = len(g.diff.Sets)
+		for _, d := range g.diff.Sets {
+			info.PrefixesAdded += len(d.Added)
+			info.PrefixesRemoved += len(d.Removed)
+		}
+	}
+	return info
+}
+
+// runGit runs git in dir and returns its trimmed output.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	name := args[0]
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
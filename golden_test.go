@@ -0,0 +1,232 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kkrow/maxminddb-to-nft/internal/mmdbfixture"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// Build epoch of the fixtures, so stats.json does not change between runs
+const fixtureEpoch = 1700000000
+
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture mmdbfixture.Options
+		args    []string
+	}{
+		{name: "geolite2"},
+		{
+			name: "geolite2_names",
+			args: []string{"-names", "json,csv", "-locale", "de", "-nft-comments"},
+		},
+		{
+			name: "geolite2_represented",
+			args: []string{"-represented-country", "fallback", "-unknown-set", "UNKNOWN"},
+		},
+		{
+			name: "geolite2_set_naming",
+			args: []string{"-set-naming", "numeric", "-rate-limit", "US=10/second"},
+		},
+		{
+			name: "geolite2_strict_codes",
+			args: []string{"-code-validation", "strict", "-allow-codes", "XK"},
+		},
+		{
+			name: "geolite2_reserved",
+			args: []string{"-strip-reserved", "-bogon-set", "BOGONS", "-transition-ranges", "derive"},
+		},
+		{
+			name: "geolite2_stats",
+			args: []string{"-stats", "-skip-report", "skipped.csv"},
+		},
+		{
+			name: "geolite2_index",
+			args: []string{"-html-index", "-names", "json"},
+		},
+		{
+			name: "geolite2_stream",
+			args: []string{"-stream"},
+		},
+		{
+			name: "geolite2_dimensions",
+			args: []string{"-dimensions", "continent", "-strip-reserved"},
+		},
+		{
+			name: "geolite2_ratelimit",
+			args: []string{"-rate-limit", "RU=100/minute,CN+DE=10/second", "-rate-limit-hook", "forward"},
+		},
+		{
+			name: "geolite2_table",
+			args: []string{"-table", "filter", "-table-family", "ip", "-families", "ipv4"},
+		},
+		{
+			name: "geolite2_no_table",
+			args: []string{"-no-table"},
+		},
+		{
+			name: "geolite2_target_nft",
+			args: []string{"-target-nft-version", "0.9.0", "-fwmark", "DE=0x1", "-fwmark-route", "0x1=wg0"},
+		},
+		{
+			name: "geolite2_nft_json",
+			args: []string{"-format", "nft-json", "-target-nft-version", "1.0.0"},
+		},
+		{
+			name: "geolite2_fwmark",
+			args: []string{"-fwmark", "US+CA=0x1,DE=2", "-fwmark-route", "0x1=wg0,2=192.0.2.1+2001:db8::1"},
+		},
+		{
+			name:    "ipv4_in_ipv6",
+			fixture: mmdbfixture.Options{IPv4InIPv6: true},
+		},
+		{
+			name:    "ipv4_in_ipv6_stream",
+			fixture: mmdbfixture.Options{IPv4InIPv6: true},
+			args:    []string{"-stream"},
+		},
+		{
+			name:    "ipinfo",
+			fixture: mmdbfixture.Options{Schema: mmdbfixture.SchemaIPInfo, DatabaseType: "ipinfo country.mmdb"},
+		},
+		{
+			name:    "ipinfo_lite",
+			fixture: mmdbfixture.Options{Schema: mmdbfixture.SchemaIPInfoLite, DatabaseType: "ipinfo lite country.mmdb"},
+		},
+		{
+			name:    "ipinfo_lite_dimensions",
+			fixture: mmdbfixture.Options{Schema: mmdbfixture.SchemaIPInfoLite, DatabaseType: "ipinfo lite country.mmdb"},
+			args:    []string{"-dimensions", "continent,asn"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "fixture.mmdb")
+			output := filepath.Join(dir, "out")
+			writeFixture(t, input, tt.fixture)
+			if err := os.MkdirAll(output, 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			args := []string{"-input", input, "-output-dir", output, "-workers", "4"}
+			for i, arg := range tt.args {
+				// Report files go to the output directory
+				if i > 0 && tt.args[i-1] == "-skip-report" {
+					arg = filepath.Join(output, arg)
+				}
+				args = append(args, arg)
+			}
+			cfg, err := parseFlags(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := newGeoIPGenerator(t.Context(), cfg).run(); err != nil {
+				t.Fatal(err)
+			}
+
+			compareGolden(t, output, filepath.Join("testdata", "golden", tt.name))
+		})
+	}
+}
+
+func writeFixture(t *testing.T, path string, opts mmdbfixture.Options) {
+	t.Helper()
+	opts.BuildEpoch = fixtureEpoch
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := mmdbfixture.Write(f, opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// compareGolden compares every file below dir with the file of the same
+// name below golden, or with -update replaces golden by dir.
+func compareGolden(t *testing.T, dir, golden string) {
+	t.Helper()
+
+	got := listFiles(t, dir)
+	if *update {
+		if err := os.RemoveAll(golden); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range got {
+			copyGolden(t, filepath.Join(dir, name), filepath.Join(golden, name))
+		}
+		return
+	}
+
+	want := listFiles(t, golden)
+	if !slices.Equal(got, want) {
+		t.Fatalf("generated files differ from %s\ngot:  %v\nwant: %v", golden, got, want)
+	}
+	for _, name := range got {
+		gotData, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantData, err := os.ReadFile(filepath.Join(golden, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(gotData) != string(wantData) {
+			t.Errorf("%s differs from %s\ngot:\n%s\nwant:\n%s", name, golden, gotData, wantData)
+		}
+	}
+}
+
+// listFiles returns the sorted paths of the files below dir, relative to
+// dir.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		names = append(names, filepath.ToSlash(name))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func copyGolden(t *testing.T, src, dst string) {
+	t.Helper()
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/netip"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/kkrow/maxminddb-to-nft/geoippb"
+)
+
+// grpcService implements geoippb.GeoIPServer on top of the file server, so
+// both interfaces always answer from the same snapshot.
+type grpcService struct {
+	geoippb.UnimplementedGeoIPServer
+	srv *fileServer
+}
+
+func newGRPCServer(srv *fileServer, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	geoippb.RegisterGeoIPServer(server, &grpcService{srv: srv})
+	// Lets grpcurl and similar tools discover the API without the .proto
+	reflection.Register(server)
+	return server
+}
+
+func (s *grpcService) Lookup(_ context.Context, req *geoippb.LookupRequest) (*geoippb.LookupResponse, error) {
+	addr, err := netip.ParseAddr(req.GetIp())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid IP address %q", req.GetIp())
+	}
+
+	resp, err := s.srv.current().lookup.lookup(addr)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	out := &geoippb.LookupResponse{
+		Ip:         resp.IP,
+		Network:    resp.Network,
+		Sets:       resp.Sets,
+		BuildEpoch: uint64(resp.BuildEpoch),
+	}
+	if resp.Country != nil {
+		out.Country = &geoippb.Place{Code: resp.Country.Code, Name: resp.Country.Name}
+	}
+	if resp.Continent != nil {
+		out.Continent = &geoippb.Place{Code: resp.Continent.Code, Name: resp.Continent.Name}
+	}
+	if resp.ASN != nil {
+		out.Asn = &geoippb.ASN{Number: uint32(resp.ASN.Number), Organization: resp.ASN.Organization}
+	}
+	return out, nil
+}
+
+func (s *grpcService) GetManifest(context.Context, *geoippb.GetManifestRequest) (*geoippb.Manifest, error) {
+	return manifestProto(s.srv.current().info), nil
+}
+
+// TriggerRefresh regenerates the files right away. It waits for a refresh
+// already in progress instead of starting a second one in parallel.
+func (s *grpcService) TriggerRefresh(context.Context, *geoippb.TriggerRefreshRequest) (*geoippb.TriggerRefreshResponse, error) {
+	snapshot, err := s.srv.refresh()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "refresh failed, still serving the previous files: %v", err)
+	}
+	return &geoippb.TriggerRefreshResponse{Manifest: manifestProto(snapshot.info)}, nil
+}
+
+func manifestProto(m manifest) *geoippb.Manifest {
+	out := &geoippb.Manifest{
+		DatabaseType: m.DatabaseType,
+		BuildEpoch:   uint64(m.BuildEpoch),
+		Generated:    timestamppb.New(m.Generated),
+	}
+	for _, f := range m.Files {
+		out.Files = append(out.Files, &geoippb.ManifestFile{Path: f.Path, Size: int64(f.Size), Sha256: f.SHA256})
+	}
+	return out
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthState tracks the outcome of the scheduled runs for /healthz and
+// /readyz.
+type healthState struct {
+	cfg     config
+	started time.Time
+
+	mu            sync.Mutex
+	lastAttempt   time.Time
+	lastSuccess   time.Time
+	lastError     string
+	databaseBuild time.Time
+	lastApply     time.Time
+	applyError    string
+}
+
+// healthResponse is the JSON body of both endpoints.
+type healthResponse struct {
+	Status      string     `json:"status"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	// Age of the database the served or applied sets were built from
+	DatabaseBuild      *time.Time   `json:"database_build,omitempty"`
+	DatabaseAgeSeconds int64        `json:"database_age_seconds,omitempty"`
+	Apply              *applyHealth `json:"apply,omitempty"`
+}
+
+type applyHealth struct {
+	Last  *time.Time `json:"last,omitempty"`
+	Error string     `json:"error,omitempty"`
+}
+
+func newHealthState(cfg config) *healthState {
+	return &healthState{cfg: cfg, started: time.Now()}
+}
+
+// setConfig replaces the configuration after a reload.
+func (h *healthState) setConfig(cfg config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cfg = cfg
+}
+
+// recordRun stores the result of a generation. g is the generator of the
+// run, its metadata is only read on success.
+func (h *healthState) recordRun(g *geoIPGenerator, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastAttempt = time.Now()
+	if err != nil {
+		h.lastError = err.Error()
+		return
+	}
+	h.lastSuccess, h.lastError = h.lastAttempt, ""
+	h.databaseBuild = time.Unix(int64(g.metadata.BuildEpoch), 0).UTC()
+}
+
+func (h *healthState) recordApply(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastApply, h.applyError = time.Now(), ""
+	if err != nil {
+		h.applyError = err.Error()
+	}
+}
+
+// live reports an error when no generation succeeded within -stale-after,
+// counted from the start of the process until the first success.
+func (h *healthState) live() error {
+	if h.cfg.StaleAfter <= 0 {
+		return nil
+	}
+	since := h.lastSuccess
+	if since.IsZero() {
+		since = h.started
+	}
+	if age := time.Since(since); age > time.Duration(h.cfg.StaleAfter) {
+		return fmt.Errorf("no successful generation for %s", age.Round(time.Second))
+	}
+	return nil
+}
+
+// ready reports an error until the first generation succeeded and, with
+// -daemon-apply, while the last apply failed.
+func (h *healthState) ready() error {
+	if h.lastSuccess.IsZero() {
+		return fmt.Errorf("no successful generation yet")
+	}
+	if h.applyError != "" {
+		return fmt.Errorf("last apply failed")
+	}
+	return nil
+}
+
+func (h *healthState) handler(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		resp := h.response()
+		err := check()
+		h.mu.Unlock()
+
+		code := http.StatusOK
+		if err != nil {
+			code = http.StatusServiceUnavailable
+			resp.Status = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (h *healthState) response() healthResponse {
+	resp := healthResponse{
+		Status:      "ok",
+		LastAttempt: optionalTime(h.lastAttempt),
+		LastSuccess: optionalTime(h.lastSuccess),
+		LastError:   h.lastError,
+	}
+	if !h.databaseBuild.IsZero() {
+		resp.DatabaseBuild = &h.databaseBuild
+		resp.DatabaseAgeSeconds = int64(time.Since(h.databaseBuild).Seconds())
+	}
+	if h.cfg.DaemonApply {
+		resp.Apply = &applyHealth{Last: optionalTime(h.lastApply), Error: h.applyError}
+	}
+	return resp
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// register adds /healthz and /readyz to mux.
+func (h *healthState) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", h.handler(h.live))
+	mux.HandleFunc("GET /readyz", h.handler(h.ready))
+}
+
+// listen serves only the health endpoints, for the daemon.
+func (h *healthState) listen(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("health check listener: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	h.register(mux)
+	go func() {
+		if err := http.Serve(lis, mux); err != nil {
+			slog.Error("Health check server stopped", "error", err)
+		}
+	}()
+	slog.Info("Serving health checks", "listen", addr)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// indexFile is written to the output directory with -html-index.
+const indexFile = "index.html"
+
+var indexTemplate = template.Must(template.New(indexFile).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>GeoIP sets</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 0.2em 0.8em; border-bottom: 1px solid #ddd; text-align: left; }
+td.number { text-align: right; }
+</style>
+</head>
+<body>
+<h1>GeoIP sets</h1>
+<p>Generated from {{.DatabaseType}} built {{.Built}}.</p>
+<h2>Sets</h2>
+<table>
+<tr><th>Set</th><th>Name</th><th>Continent</th><th>IPv4 prefixes</th><th>IPv6 prefixes</th><th>Files</th></tr>
+{{- range .Sets}}
+<tr><td>{{.Set}}</td><td>{{.Name}}</td><td>{{.Continent}}</td><td class="number">{{.IPv4}}</td><td class="number">{{.IPv6}}</td><td>{{range .Files}}<a href="{{.Path}}">{{.Label}}</a> {{end}}</td></tr>
+{{- end}}
+</table>
+<h2>Files</h2>
+<table>
+<tr><th>File</th><th>Size</th></tr>
+{{- range .Files}}
+<tr><td><a href="{{.Path}}">{{.Path}}</a></td><td class="number">{{.Size}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+type indexFileEntry struct {
+	Path, Label, Size string
+}
+
+type indexSet struct {
+	Set, Name, Continent string
+	IPv4, IPv6           int
+	Files                []indexFileEntry
+}
+
+// writeHTMLIndex writes index.html listing the sets with their names and
+// prefix counts and every file written so far with its size, for output
+// directories that are also browsed by people. It runs after the other
+// outputs so that the sizes are final.
+func (g *geoIPGenerator) writeHTMLIndex() error {
+	var files []indexFileEntry
+	written := make(map[string]indexFileEntry)
+	for _, filename := range g.outputs {
+		rel, err := filepath.Rel(g.cfg.OutputDir, filename)
+		if err != nil || !filepath.IsLocal(rel) {
+			// Like a -skip-report elsewhere
+			continue
+		}
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		entry := indexFileEntry{Path: filepath.ToSlash(rel), Size: humanSize(info.Size())}
+		files = append(files, entry)
+		written[entry.Path] = entry
+	}
+
+	sizes := g.setSizes()
+	var sets []indexSet
+	for _, n := range g.countryNames() {
+		s := indexSet{Set: g.setName(n.Code), Name: n.Name, Continent: n.ContinentName, IPv4: sizes["ipv4"][n.Code], IPv6: sizes["ipv6"][n.Code]}
+		for _, family := range []string{"ipv4", "ipv6"} {
+			if entry, ok := written[filepath.ToSlash(g.countryFile(n.Code, family))]; ok {
+				entry.Label = family
+				s.Files = append(s.Files, entry)
+			}
+		}
+		sets = append(sets, s)
+	}
+
+	var buf bytes.Buffer
+	err := indexTemplate.Execute(&buf, map[string]any{
+		"DatabaseType": g.metadata.DatabaseType,
+		"Built":        time.Unix(int64(g.metadata.BuildEpoch), 0).UTC().Format(time.DateOnly),
+		"Sets":         sets,
+		"Files":        files,
+	})
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(g.cfg.OutputDir, indexFile)
+	if err := g.writeOutput(filename, func(w io.Writer) error {
+		_, err := buf.WriteTo(w)
+		return err
+	}); err != nil {
+		return err
+	}
+	g.outputs = append(g.outputs, filename)
+	slog.Info("Generated file", "path", filename)
+	return nil
+}
+
+// humanSize formats a file size with a binary unit, like 1.5 MiB.
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
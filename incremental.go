@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// incrementalFile keeps the set hashes of the last -incremental run in the
+// output directory.
+const incrementalFile = ".incremental.json"
+
+// Bumped when the rendering of the files changes, so that the next run
+// rewrites everything
+const incrementalVersion = 1
+
+// incrementalManifest records, for every file, a hash of the sets it was
+// rendered from. A file whose sets and configuration did not change since
+// the last run is left as it is.
+type incrementalManifest struct {
+	Version int                         `json:"version"`
+	Config  string                      `json:"config"`
+	Files   map[string]incrementalEntry `json:"files"`
+}
+
+type incrementalEntry struct {
+	Sets string `json:"sets"`
+	Size int64  `json:"size"`
+}
+
+// incrementalConfig is the part of the configuration the hashed files
+// depend on besides their sets: the options they are rendered with, the
+// nft features and the modes and owner applied when they are written.
+// Options deciding what goes into the sets are covered by the set hashes.
+type incrementalConfig struct {
+	Format      string   `json:"format"`
+	Table       string   `json:"table"`
+	TableFamily string   `json:"table_family"`
+	NoTable     bool     `json:"no_table"`
+	SetNaming   string   `json:"set_naming"`
+	NFTComments bool     `json:"nft_comments"`
+	Features    string   `json:"features"`
+	FileMode    fileMode `json:"file_mode"`
+	DirMode     fileMode `json:"dir_mode"`
+	Umask       fileMode `json:"umask"`
+	Owner       string   `json:"owner"`
+}
+
+func (g *geoIPGenerator) newIncrementalManifest() (*incrementalManifest, error) {
+	data, err := json.Marshal(incrementalConfig{
+		Format:      g.cfg.Format,
+		Table:       g.cfg.Table,
+		TableFamily: g.cfg.TableFamily,
+		NoTable:     g.cfg.NoTable,
+		SetNaming:   g.cfg.SetNaming,
+		NFTComments: g.cfg.NFTComments,
+		Features:    fmt.Sprintf("%+v", g.features),
+		FileMode:    g.cfg.FileMode,
+		DirMode:     g.cfg.DirMode,
+		Umask:       g.cfg.Umask,
+		Owner:       g.cfg.Owner,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &incrementalManifest{
+		Version: incrementalVersion,
+		Config:  hex.EncodeToString(sum[:]),
+		Files:   make(map[string]incrementalEntry),
+	}, nil
+}
+
+// loadIncrementalManifest reads the manifest of the last run. A missing
+// or unreadable manifest yields nil, so that everything is written.
+func loadIncrementalManifest(dir string) *incrementalManifest {
+	data, err := os.ReadFile(filepath.Join(dir, incrementalFile))
+	if err != nil {
+		return nil
+	}
+	var m incrementalManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return &m
+}
+
+// unchanged reports whether the file at path was rendered from the same
+// sets by the last run and is still in place.
+func (m *incrementalManifest) unchanged(prev *incrementalManifest, dir, path string) bool {
+	if prev == nil || prev.Version != m.Version || prev.Config != m.Config {
+		return false
+	}
+	entry, ok := prev.Files[path]
+	if !ok || entry.Sets != m.Files[path].Sets {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(dir, path))
+	return err == nil && info.Size() == entry.Size
+}
+
+// record stores the size of the file at path after it was written.
+func (m *incrementalManifest) record(dir, path string) error {
+	info, err := os.Stat(filepath.Join(dir, path))
+	if err != nil {
+		return err
+	}
+	entry := m.Files[path]
+	entry.Size = info.Size()
+	m.Files[path] = entry
+	return nil
+}
+
+// removeStale deletes the files of the last run that are no longer
+// generated, like the files of a country gone from the database.
+func (m *incrementalManifest) removeStale(prev *incrementalManifest, dir string) error {
+	if prev == nil {
+		return nil
+	}
+	for _, path := range slices.Sorted(maps.Keys(prev.Files)) {
+		if _, ok := m.Files[path]; ok {
+			continue
+		}
+		name := filepath.Join(dir, path)
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("removing stale %s: %w", path, err)
+		}
+		// The by_country directory of the set, when it is empty now
+		os.Remove(filepath.Dir(name))
+		slog.Info("Removed stale file", "path", name)
+	}
+	return nil
+}
+
+// saveManifest writes the manifest like the other outputs.
+func (g *geoIPGenerator) saveManifest(m *incrementalManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return g.writeOutputData(filepath.Join(g.cfg.OutputDir, incrementalFile), data)
+}
+
+// hashSets returns the hash of the sets an artifact is rendered from.
+func hashSets(sets func(w io.Writer)) string {
+	h := sha256.New()
+	sets(h)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashSet writes the set code with its prefixes to w.
+func hashSet(w io.Writer, code string, l *geonft.PrefixList) {
+	fmt.Fprintf(w, "%s %d\n", code, l.Len())
+	w.Write(l.AppendBinary(nil))
+}
+
+// removeIncrementalManifest deletes the manifest, so that the next run
+// does not trust files of a run that failed halfway.
+func removeIncrementalManifest(dir string) error {
+	err := os.Remove(filepath.Join(dir, incrementalFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+// TestIncrementalConfig checks that only the options changing the
+// rendered files invalidate the manifest of the last run.
+func TestIncrementalConfig(t *testing.T) {
+	hash := func(t *testing.T, features nftFeatures, args ...string) string {
+		t.Helper()
+		cfg, err := parseFlags(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := newGeoIPGenerator(t.Context(), cfg)
+		g.features = features
+		m, err := g.newIncrementalManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.Config
+	}
+	base := hash(t, defaultNFTFeatures)
+
+	tests := []struct {
+		name     string
+		features nftFeatures
+		args     []string
+		changed  bool
+	}{
+		{"workers", defaultNFTFeatures, []string{"-workers", "2"}, false},
+		{"log level", defaultNFTFeatures, []string{"-log-level", "debug"}, false},
+		{"textfile", defaultNFTFeatures, []string{"-textfile-dir", "/tmp"}, false},
+		{"table", defaultNFTFeatures, []string{"-table", "filter"}, true},
+		{"nft comments", defaultNFTFeatures, []string{"-nft-comments"}, true},
+		{"format", defaultNFTFeatures, []string{"-format", "nft-json"}, true},
+		{"file mode", defaultNFTFeatures, []string{"-file-mode", "0640"}, true},
+		{"auto-merge", nftFeatures{autoMerge: true, priorityNames: true, namedLimits: true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hash(t, tt.features, tt.args...) != base; got != tt.changed {
+				t.Errorf("configuration hash changed = %v, want %v", got, tt.changed)
+			}
+		})
+	}
+}
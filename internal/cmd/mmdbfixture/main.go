@@ -0,0 +1,33 @@
+// Command mmdbfixture writes a synthetic test database, e.g.
+//
+//	go run ./internal/cmd/mmdbfixture -out test.mmdb -ipv4-in-ipv6
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/kkrow/maxminddb-to-nft/internal/mmdbfixture"
+)
+
+func main() {
+	out := flag.String("out", "test.mmdb", "file the database is written to")
+	var opts mmdbfixture.Options
+	flag.StringVar(&opts.Schema, "schema", mmdbfixture.SchemaGeoLite2, "record layout: geolite2, ipinfo or ipinfo-lite")
+	flag.StringVar(&opts.DatabaseType, "type", "GeoLite2-Country", "database type stored in the metadata")
+	flag.BoolVar(&opts.IPv4InIPv6, "ipv4-in-ipv6", false, "store additional networks under ::ffff:0:0/96")
+	flag.Int64Var(&opts.BuildEpoch, "epoch", 0, "build epoch stored in the metadata")
+	flag.Parse()
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := mmdbfixture.Write(f, opts); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
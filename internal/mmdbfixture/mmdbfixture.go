@@ -0,0 +1,181 @@
+// Package mmdbfixture writes tiny synthetic MaxMind databases covering the
+// edge cases of the generator, for golden tests and manual checks.
+package mmdbfixture
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// Record layouts
+const (
+	SchemaGeoLite2   = "geolite2"
+	SchemaIPInfo     = "ipinfo"
+	SchemaIPInfoLite = "ipinfo-lite"
+)
+
+// Options selects the database written.
+type Options struct {
+	// Schema is the record layout, SchemaGeoLite2 when empty
+	Schema string
+	// DatabaseType is stored in the metadata, GeoLite2-Country when empty
+	DatabaseType string
+	// IPv4InIPv6 stores additional networks under ::ffff:0:0/96 instead of
+	// aliasing that subtree to the IPv4 tree
+	IPv4InIPv6 bool
+	BuildEpoch int64
+}
+
+// Network is one network of the fixture.
+type Network struct {
+	Prefix string
+	// Code is the country code, empty for a record without country
+	Code string
+	// Represented is the represented country of GeoLite2 records
+	Represented string
+	// ASN is the autonomous system of ipinfo records, none when zero
+	ASN uint32
+}
+
+// Networks are the networks of every fixture: plain assignments, adjacent
+// networks of one country, a represented country with and without a
+// country, a record without country, the user-assigned XK, an invalid
+// lowercase code, reserved ranges, a network broader than the usual
+// prefix floor and IPv6 networks.
+var Networks = []Network{
+	{Prefix: "1.0.0.0/24", Code: "AU", ASN: 13335},
+	{Prefix: "1.0.1.0/24", Code: "CN", ASN: 4134},
+	{Prefix: "2.0.0.0/16", Code: "FR", ASN: 3215},
+	{Prefix: "2.1.0.0/16", Code: "FR", ASN: 3215},
+	{Prefix: "3.0.0.0/9", Code: "US", ASN: 16509},
+	{Prefix: "5.0.0.0/16", Code: "DE", Represented: "US"},
+	{Prefix: "6.0.0.0/16", Represented: "US"},
+	{Prefix: "7.0.0.0/16"},
+	{Prefix: "8.0.0.0/16", Code: "XK"},
+	{Prefix: "9.0.0.0/16", Code: "zz"},
+	{Prefix: "10.0.0.0/16", Code: "US"},
+	{Prefix: "100.0.0.0/2", Code: "BR"},
+	{Prefix: "192.0.2.0/24", Code: "DE"},
+	{Prefix: "2001:db8::/32", Code: "DE"},
+	{Prefix: "2a00::/16", Code: "RU", ASN: 12389},
+	{Prefix: "2a01::/16", Code: "DE", ASN: 3320},
+	{Prefix: "2c0f::/16", Code: "EG"},
+	{Prefix: "fe80::/10", Code: "US"},
+}
+
+// MappedNetworks are added with Options.IPv4InIPv6: networks of their
+// own, a duplicate and a part of native networks and a network before the
+// native ones of its country.
+var MappedNetworks = []Network{
+	{Prefix: "::ffff:1.0.0.0/120", Code: "AU"},
+	{Prefix: "::ffff:2.0.0.0/112", Code: "FR"},
+	{Prefix: "::ffff:4.0.0.0/112", Code: "DE"},
+	{Prefix: "::ffff:11.0.0.0/104", Code: "JP"},
+	{Prefix: "::ffff:12.0.0.0/112", Code: "KR"},
+}
+
+// Write writes the database selected by opts to w.
+func Write(w io.Writer, opts Options) error {
+	if opts.Schema == "" {
+		opts.Schema = SchemaGeoLite2
+	}
+	if opts.DatabaseType == "" {
+		opts.DatabaseType = "GeoLite2-Country"
+	}
+
+	tree, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            opts.DatabaseType,
+		Languages:               []string{"en", "de"},
+		BuildEpoch:              opts.BuildEpoch,
+		IncludeReservedNetworks: true,
+		DisableIPv4Aliasing:     opts.IPv4InIPv6,
+	})
+	if err != nil {
+		return err
+	}
+
+	networks := Networks
+	if opts.IPv4InIPv6 {
+		networks = append(networks[:len(networks):len(networks)], MappedNetworks...)
+	}
+	for _, n := range networks {
+		_, ipNet, err := net.ParseCIDR(n.Prefix)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", n.Prefix, err)
+		}
+		record, err := newRecord(opts.Schema, n)
+		if err != nil {
+			return err
+		}
+		if err := tree.Insert(ipNet, record); err != nil {
+			return fmt.Errorf("inserting %s: %w", n.Prefix, err)
+		}
+	}
+
+	_, err = tree.WriteTo(w)
+	return err
+}
+
+// continents of the codes in Networks
+var continents = map[string]string{
+	"AU": "OC", "BR": "SA", "CN": "AS", "DE": "EU", "EG": "AF", "FR": "EU",
+	"JP": "AS", "KR": "AS", "RU": "EU", "US": "NA", "XK": "EU",
+}
+
+func newRecord(schema string, n Network) (mmdbtype.Map, error) {
+	continent := continents[n.Code]
+	var asn string
+	if n.ASN != 0 {
+		asn = fmt.Sprintf("AS%d", n.ASN)
+	}
+
+	switch schema {
+	case SchemaGeoLite2:
+		record := mmdbtype.Map{}
+		if continent != "" {
+			record["continent"] = mmdbtype.Map{
+				"code":  mmdbtype.String(continent),
+				"names": mmdbtype.Map{"en": mmdbtype.String("Name " + continent)},
+			}
+		}
+		if n.Code != "" {
+			record["country"] = country(n.Code)
+			record["registered_country"] = country(n.Code)
+		}
+		if n.Represented != "" {
+			represented := country(n.Represented)
+			represented["type"] = mmdbtype.String("military")
+			record["represented_country"] = represented
+		}
+		return record, nil
+	case SchemaIPInfo:
+		return mmdbtype.Map{
+			"country":      mmdbtype.String(n.Code),
+			"country_name": mmdbtype.String("Name " + n.Code),
+			"continent":    mmdbtype.String(continent),
+		}, nil
+	case SchemaIPInfoLite:
+		return mmdbtype.Map{
+			"country_code":   mmdbtype.String(n.Code),
+			"country":        mmdbtype.String("Name " + n.Code),
+			"continent_code": mmdbtype.String(continent),
+			"asn":            mmdbtype.String(asn),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown schema %q", schema)
+	}
+}
+
+func country(code string) mmdbtype.Map {
+	return mmdbtype.Map{
+		"iso_code": mmdbtype.String(code),
+		"names": mmdbtype.Map{
+			"en": mmdbtype.String("Name " + code),
+			"de": mmdbtype.String("Name " + code + " (de)"),
+		},
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+// countryInfo holds the English name, continent code and the other ISO
+// 3166-1 codes of a country.
+type countryInfo struct {
+	Name      string
+	Continent string
+	Alpha3    string
+	// Numeric is the three digit code, empty for user-assigned codes
+	Numeric string
+}
+
+// Continent codes as used by MaxMind databases
+var continentNames = map[string]string{
+	"AF": "Africa",
+	"AN": "Antarctica",
+	"AS": "Asia",
+	"EU": "Europe",
+	"NA": "North America",
+	"OC": "Oceania",
+	"SA": "South America",
+}
+
+// Officially assigned ISO 3166-1 alpha-2 codes
+var iso3166Countries = map[string]countryInfo{
+	"AD": {"Andorra", "EU", "AND", "020"},
+	"AE": {"United Arab Emirates", "AS", "ARE", "784"},
+	"AF": {"Afghanistan", "AS", "AFG", "004"},
+	"AG": {"Antigua and Barbuda", "NA", "ATG", "028"},
+	"AI": {"Anguilla", "NA", "AIA", "660"},
+	"AL": {"Albania", "EU", "ALB", "008"},
+	"AM": {"Armenia", "AS", "ARM", "051"},
+	"AO": {"Angola", "AF", "AGO", "024"},
+	"AQ": {"Antarctica", "AN", "ATA", "010"},
+	"AR": {"Argentina", "SA", "ARG", "032"},
+	"AS": {"American Samoa", "OC", "ASM", "016"},
+	"AT": {"Austria", "EU", "AUT", "040"},
+	"AU": {"Australia", "OC", "AUS", "036"},
+	"AW": {"Aruba", "NA", "ABW", "533"},
+	"AX": {"Åland Islands", "EU", "ALA", "248"},
+	"AZ": {"Azerbaijan", "AS", "AZE", "031"},
+	"BA": {"Bosnia and Herzegovina", "EU", "BIH", "070"},
+	"BB": {"Barbados", "NA", "BRB", "052"},
+	"BD": {"Bangladesh", "AS", "BGD", "050"},
+	"BE": {"Belgium", "EU", "BEL", "056"},
+	"BF": {"Burkina Faso", "AF", "BFA", "854"},
+	"BG": {"Bulgaria", "EU", "BGR", "100"},
+	"BH": {"Bahrain", "AS", "BHR", "048"},
+	"BI": {"Burundi", "AF", "BDI", "108"},
+	"BJ": {"Benin", "AF", "BEN", "204"},
+	"BL": {"Saint Barthélemy", "NA", "BLM", "652"},
+	"BM": {"Bermuda", "NA", "BMU", "060"},
+	"BN": {"Brunei Darussalam", "AS", "BRN", "096"},
+	"BO": {"Bolivia", "SA", "BOL", "068"},
+	"BQ": {"Bonaire, Sint Eustatius and Saba", "NA", "BES", "535"},
+	"BR": {"Brazil", "SA", "BRA", "076"},
+	"BS": {"Bahamas", "NA", "BHS", "044"},
+	"BT": {"Bhutan", "AS", "BTN", "064"},
+	"BV": {"Bouvet Island", "AN", "BVT", "074"},
+	"BW": {"Botswana", "AF", "BWA", "072"},
+	"BY": {"Belarus", "EU", "BLR", "112"},
+	"BZ": {"Belize", "NA", "BLZ", "084"},
+	"CA": {"Canada", "NA", "CAN", "124"},
+	"CC": {"Cocos (Keeling) Islands", "AS", "CCK", "166"},
+	"CD": {"Congo, The Democratic Republic of the", "AF", "COD", "180"},
+	"CF": {"Central African Republic", "AF", "CAF", "140"},
+	"CG": {"Congo", "AF", "COG", "178"},
+	"CH": {"Switzerland", "EU", "CHE", "756"},
+	"CI": {"Côte d'Ivoire", "AF", "CIV", "384"},
+	"CK": {"Cook Islands", "OC", "COK", "184"},
+	"CL": {"Chile", "SA", "CHL", "152"},
+	"CM": {"Cameroon", "AF", "CMR", "120"},
+	"CN": {"China", "AS", "CHN", "156"},
+	"CO": {"Colombia", "SA", "COL", "170"},
+	"CR": {"Costa Rica", "NA", "CRI", "188"},
+	"CU": {"Cuba", "NA", "CUB", "192"},
+	"CV": {"Cabo Verde", "AF", "CPV", "132"},
+	"CW": {"Curaçao", "NA", "CUW", "531"},
+	"CX": {"Christmas Island", "AS", "CXR", "162"},
+	"CY": {"Cyprus", "EU", "CYP", "196"},
+	"CZ": {"Czechia", "EU", "CZE", "203"},
+	"DE": {"Germany", "EU", "DEU", "276"},
+	"DJ": {"Djibouti", "AF", "DJI", "262"},
+	"DK": {"Denmark", "EU", "DNK", "208"},
+	"DM": {"Dominica", "NA", "DMA", "212"},
+	"DO": {"Dominican Republic", "NA", "DOM", "214"},
+	"DZ": {"Algeria", "AF", "DZA", "012"},
+	"EC": {"Ecuador", "SA", "ECU", "218"},
+	"EE": {"Estonia", "EU", "EST", "233"},
+	"EG": {"Egypt", "AF", "EGY", "818"},
+	"EH": {"Western Sahara", "AF", "ESH", "732"},
+	"ER": {"Eritrea", "AF", "ERI", "232"},
+	"ES": {"Spain", "EU", "ESP", "724"},
+	"ET": {"Ethiopia", "AF", "ETH", "231"},
+	"FI": {"Finland", "EU", "FIN", "246"},
+	"FJ": {"Fiji", "OC", "FJI", "242"},
+	"FK": {"Falkland Islands (Malvinas)", "SA", "FLK", "238"},
+	"FM": {"Micronesia, Federated States of", "OC", "FSM", "583"},
+	"FO": {"Faroe Islands", "EU", "FRO", "234"},
+	"FR": {"France", "EU", "FRA", "250"},
+	"GA": {"Gabon", "AF", "GAB", "266"},
+	"GB": {"United Kingdom", "EU", "GBR", "826"},
+	"GD": {"Grenada", "NA", "GRD", "308"},
+	"GE": {"Georgia", "AS", "GEO", "268"},
+	"GF": {"French Guiana", "SA", "GUF", "254"},
+	"GG": {"Guernsey", "EU", "GGY", "831"},
+	"GH": {"Ghana", "AF", "GHA", "288"},
+	"GI": {"Gibraltar", "EU", "GIB", "292"},
+	"GL": {"Greenland", "NA", "GRL", "304"},
+	"GM": {"Gambia", "AF", "GMB", "270"},
+	"GN": {"Guinea", "AF", "GIN", "324"},
+	"GP": {"Guadeloupe", "NA", "GLP", "312"},
+	"GQ": {"Equatorial Guinea", "AF", "GNQ", "226"},
+	"GR": {"Greece", "EU", "GRC", "300"},
+	"GS": {"South Georgia and the South Sandwich Islands", "AN", "SGS", "239"},
+	"GT": {"Guatemala", "NA", "GTM", "320"},
+	"GU": {"Guam", "OC", "GUM", "316"},
+	"GW": {"Guinea-Bissau", "AF", "GNB", "624"},
+	"GY": {"Guyana", "SA", "GUY", "328"},
+	"HK": {"Hong Kong", "AS", "HKG", "344"},
+	"HM": {"Heard Island and McDonald Islands", "AN", "HMD", "334"},
+	"HN": {"Honduras", "NA", "HND", "340"},
+	"HR": {"Croatia", "EU", "HRV", "191"},
+	"HT": {"Haiti", "NA", "HTI", "332"},
+	"HU": {"Hungary", "EU", "HUN", "348"},
+	"ID": {"Indonesia", "AS", "IDN", "360"},
+	"IE": {"Ireland", "EU", "IRL", "372"},
+	"IL": {"Israel", "AS", "ISR", "376"},
+	"IM": {"Isle of Man", "EU", "IMN", "833"},
+	"IN": {"India", "AS", "IND", "356"},
+	"IO": {"British Indian Ocean Territory", "AS", "IOT", "086"},
+	"IQ": {"Iraq", "AS", "IRQ", "368"},
+	"IR": {"Iran", "AS", "IRN", "364"},
+	"IS": {"Iceland", "EU", "ISL", "352"},
+	"IT": {"Italy", "EU", "ITA", "380"},
+	"JE": {"Jersey", "EU", "JEY", "832"},
+	"JM": {"Jamaica", "NA", "JAM", "388"},
+	"JO": {"Jordan", "AS", "JOR", "400"},
+	"JP": {"Japan", "AS", "JPN", "392"},
+	"KE": {"Kenya", "AF", "KEN", "404"},
+	"KG": {"Kyrgyzstan", "AS", "KGZ", "417"},
+	"KH": {"Cambodia", "AS", "KHM", "116"},
+	"KI": {"Kiribati", "OC", "KIR", "296"},
+	"KM": {"Comoros", "AF", "COM", "174"},
+	"KN": {"Saint Kitts and Nevis", "NA", "KNA", "659"},
+	"KP": {"North Korea", "AS", "PRK", "408"},
+	"KR": {"South Korea", "AS", "KOR", "410"},
+	"KW": {"Kuwait", "AS", "KWT", "414"},
+	"KY": {"Cayman Islands", "NA", "CYM", "136"},
+	"KZ": {"Kazakhstan", "AS", "KAZ", "398"},
+	"LA": {"Laos", "AS", "LAO", "418"},
+	"LB": {"Lebanon", "AS", "LBN", "422"},
+	"LC": {"Saint Lucia", "NA", "LCA", "662"},
+	"LI": {"Liechtenstein", "EU", "LIE", "438"},
+	"LK": {"Sri Lanka", "AS", "LKA", "144"},
+	"LR": {"Liberia", "AF", "LBR", "430"},
+	"LS": {"Lesotho", "AF", "LSO", "426"},
+	"LT": {"Lithuania", "EU", "LTU", "440"},
+	"LU": {"Luxembourg", "EU", "LUX", "442"},
+	"LV": {"Latvia", "EU", "LVA", "428"},
+	"LY": {"Libya", "AF", "LBY", "434"},
+	"MA": {"Morocco", "AF", "MAR", "504"},
+	"MC": {"Monaco", "EU", "MCO", "492"},
+	"MD": {"Moldova", "EU", "MDA", "498"},
+	"ME": {"Montenegro", "EU", "MNE", "499"},
+	"MF": {"Saint Martin (French part)", "NA", "MAF", "663"},
+	"MG": {"Madagascar", "AF", "MDG", "450"},
+	"MH": {"Marshall Islands", "OC", "MHL", "584"},
+	"MK": {"North Macedonia", "EU", "MKD", "807"},
+	"ML": {"Mali", "AF", "MLI", "466"},
+	"MM": {"Myanmar", "AS", "MMR", "104"},
+	"MN": {"Mongolia", "AS", "MNG", "496"},
+	"MO": {"Macao", "AS", "MAC", "446"},
+	"MP": {"Northern Mariana Islands", "OC", "MNP", "580"},
+	"MQ": {"Martinique", "NA", "MTQ", "474"},
+	"MR": {"Mauritania", "AF", "MRT", "478"},
+	"MS": {"Montserrat", "NA", "MSR", "500"},
+	"MT": {"Malta", "EU", "MLT", "470"},
+	"MU": {"Mauritius", "AF", "MUS", "480"},
+	"MV": {"Maldives", "AS", "MDV", "462"},
+	"MW": {"Malawi", "AF", "MWI", "454"},
+	"MX": {"Mexico", "NA", "MEX", "484"},
+	"MY": {"Malaysia", "AS", "MYS", "458"},
+	"MZ": {"Mozambique", "AF", "MOZ", "508"},
+	"NA": {"Namibia", "AF", "NAM", "516"},
+	"NC": {"New Caledonia", "OC", "NCL", "540"},
+	"NE": {"Niger", "AF", "NER", "562"},
+	"NF": {"Norfolk Island", "OC", "NFK", "574"},
+	"NG": {"Nigeria", "AF", "NGA", "566"},
+	"NI": {"Nicaragua", "NA", "NIC", "558"},
+	"NL": {"Netherlands", "EU", "NLD", "528"},
+	"NO": {"Norway", "EU", "NOR", "578"},
+	"NP": {"Nepal", "AS", "NPL", "524"},
+	"NR": {"Nauru", "OC", "NRU", "520"},
+	"NU": {"Niue", "OC", "NIU", "570"},
+	"NZ": {"New Zealand", "OC", "NZL", "554"},
+	"OM": {"Oman", "AS", "OMN", "512"},
+	"PA": {"Panama", "NA", "PAN", "591"},
+	"PE": {"Peru", "SA", "PER", "604"},
+	"PF": {"French Polynesia", "OC", "PYF", "258"},
+	"PG": {"Papua New Guinea", "OC", "PNG", "598"},
+	"PH": {"Philippines", "AS", "PHL", "608"},
+	"PK": {"Pakistan", "AS", "PAK", "586"},
+	"PL": {"Poland", "EU", "POL", "616"},
+	"PM": {"Saint Pierre and Miquelon", "NA", "SPM", "666"},
+	"PN": {"Pitcairn", "OC", "PCN", "612"},
+	"PR": {"Puerto Rico", "NA", "PRI", "630"},
+	"PS": {"Palestine, State of", "AS", "PSE", "275"},
+	"PT": {"Portugal", "EU", "PRT", "620"},
+	"PW": {"Palau", "OC", "PLW", "585"},
+	"PY": {"Paraguay", "SA", "PRY", "600"},
+	"QA": {"Qatar", "AS", "QAT", "634"},
+	"RE": {"Réunion", "AF", "REU", "638"},
+	"RO": {"Romania", "EU", "ROU", "642"},
+	"RS": {"Serbia", "EU", "SRB", "688"},
+	"RU": {"Russian Federation", "EU", "RUS", "643"},
+	"RW": {"Rwanda", "AF", "RWA", "646"},
+	"SA": {"Saudi Arabia", "AS", "SAU", "682"},
+	"SB": {"Solomon Islands", "OC", "SLB", "090"},
+	"SC": {"Seychelles", "AF", "SYC", "690"},
+	"SD": {"Sudan", "AF", "SDN", "729"},
+	"SE": {"Sweden", "EU", "SWE", "752"},
+	"SG": {"Singapore", "AS", "SGP", "702"},
+	"SH": {"Saint Helena, Ascension and Tristan da Cunha", "AF", "SHN", "654"},
+	"SI": {"Slovenia", "EU", "SVN", "705"},
+	"SJ": {"Svalbard and Jan Mayen", "EU", "SJM", "744"},
+	"SK": {"Slovakia", "EU", "SVK", "703"},
+	"SL": {"Sierra Leone", "AF", "SLE", "694"},
+	"SM": {"San Marino", "EU", "SMR", "674"},
+	"SN": {"Senegal", "AF", "SEN", "686"},
+	"SO": {"Somalia", "AF", "SOM", "706"},
+	"SR": {"Suriname", "SA", "SUR", "740"},
+	"SS": {"South Sudan", "AF", "SSD", "728"},
+	"ST": {"Sao Tome and Principe", "AF", "STP", "678"},
+	"SV": {"El Salvador", "NA", "SLV", "222"},
+	"SX": {"Sint Maarten (Dutch part)", "NA", "SXM", "534"},
+	"SY": {"Syria", "AS", "SYR", "760"},
+	"SZ": {"Eswatini", "AF", "SWZ", "748"},
+	"TC": {"Turks and Caicos Islands", "NA", "TCA", "796"},
+	"TD": {"Chad", "AF", "TCD", "148"},
+	"TF": {"French Southern Territories", "AN", "ATF", "260"},
+	"TG": {"Togo", "AF", "TGO", "768"},
+	"TH": {"Thailand", "AS", "THA", "764"},
+	"TJ": {"Tajikistan", "AS", "TJK", "762"},
+	"TK": {"Tokelau", "OC", "TKL", "772"},
+	"TL": {"Timor-Leste", "AS", "TLS", "626"},
+	"TM": {"Turkmenistan", "AS", "TKM", "795"},
+	"TN": {"Tunisia", "AF", "TUN", "788"},
+	"TO": {"Tonga", "OC", "TON", "776"},
+	"TR": {"Türkiye", "AS", "TUR", "792"},
+	"TT": {"Trinidad and Tobago", "NA", "TTO", "780"},
+	"TV": {"Tuvalu", "OC", "TUV", "798"},
+	"TW": {"Taiwan", "AS", "TWN", "158"},
+	"TZ": {"Tanzania", "AF", "TZA", "834"},
+	"UA": {"Ukraine", "EU", "UKR", "804"},
+	"UG": {"Uganda", "AF", "UGA", "800"},
+	"UM": {"United States Minor Outlying Islands", "OC", "UMI", "581"},
+	"US": {"United States", "NA", "USA", "840"},
+	"UY": {"Uruguay", "SA", "URY", "858"},
+	"UZ": {"Uzbekistan", "AS", "UZB", "860"},
+	"VA": {"Holy See (Vatican City State)", "EU", "VAT", "336"},
+	"VC": {"Saint Vincent and the Grenadines", "NA", "VCT", "670"},
+	"VE": {"Venezuela", "SA", "VEN", "862"},
+	"VG": {"Virgin Islands, British", "NA", "VGB", "092"},
+	"VI": {"Virgin Islands, U.S.", "NA", "VIR", "850"},
+	"VN": {"Vietnam", "AS", "VNM", "704"},
+	"VU": {"Vanuatu", "OC", "VUT", "548"},
+	"WF": {"Wallis and Futuna", "OC", "WLF", "876"},
+	"WS": {"Samoa", "OC", "WSM", "882"},
+	"YE": {"Yemen", "AS", "YEM", "887"},
+	"YT": {"Mayotte", "AF", "MYT", "175"},
+	"ZA": {"South Africa", "AF", "ZAF", "710"},
+	"ZM": {"Zambia", "AF", "ZMB", "894"},
+	"ZW": {"Zimbabwe", "AF", "ZWE", "716"},
+}
+
+// User-assigned codes commonly found in geolocation databases. They are not
+// part of ISO 3166-1 and are therefore rejected by strict validation.
+var userAssignedCountries = map[string]countryInfo{
+	"XK": {"Kosovo", "EU", "XKX", ""},
+}
+
+// lookupCountry returns the metadata for code from the embedded tables.
+func lookupCountry(code string) (countryInfo, bool) {
+	if info, ok := iso3166Countries[code]; ok {
+		return info, true
+	}
+	info, ok := userAssignedCountries[code]
+	return info, ok
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/netip"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// loadShard reads the networks of one part of the address space into its
+// own sets and counters, so that shards can be loaded concurrently and
+// merged in address order afterwards.
+type loadShard struct {
+	// within is the part of the address space, scope the one it was split
+	// from
+	within     netip.Prefix
+	scope      netip.Prefix
+	ipv4, ipv6 geonft.Sets
+	names      map[string]map[string]string
+	// Sets of the -dimensions, in their order
+	dims     []*geonft.Dataset
+	counters loadCounters
+	dropped  map[string]int
+	skipped  []skippedNetwork
+	mapped   int
+}
+
+type skippedNetwork struct {
+	prefix netip.Prefix
+	reason string
+	detail string
+	err    error
+}
+
+func newLoadShard(scope, within netip.Prefix, dims int) *loadShard {
+	s := &loadShard{
+		within:  within,
+		scope:   scope,
+		ipv4:    make(geonft.Sets),
+		ipv6:    make(geonft.Sets),
+		names:   make(map[string]map[string]string),
+		dropped: make(map[string]int),
+	}
+	for range dims {
+		s.dims = append(s.dims, geonft.NewDataset())
+	}
+	return s
+}
+
+// loadShards returns the shards loading the selected families of db, one
+// per scope, or with parallel the scopes split for concurrent loading.
+func (g *geoIPGenerator) loadShards(db *maxminddb.Reader, parallel bool) []*loadShard {
+	var shards []*loadShard
+	scopes := geonft.Scopes(db, g.cfg.family("ipv4"), g.cfg.family("ipv6"), g.cfg.withinPrefixes())
+	for _, scope := range scopes {
+		if !parallel {
+			shards = append(shards, newLoadShard(scope, scope, len(g.dimensions)))
+			continue
+		}
+
+		for _, p := range geonft.Shards(scope) {
+			shards = append(shards, newLoadShard(scope, p, len(g.dimensions)))
+		}
+	}
+	return shards
+}
+
+// ipv4Mapped reports whether the shard holds the IPv4-mapped networks of an
+// IPv6 database. They may duplicate the native IPv4 ones and are merged
+// into them after loading.
+func (s *loadShard) ipv4Mapped() bool {
+	return s.scope.Addr().Is4In6()
+}
+
+// loader returns the loader classifying the networks of db like the
+// configuration.
+func (g *geoIPGenerator) loader(schema geonft.Schema) *geonft.Loader {
+	return &geonft.Loader{
+		Schema:      schema,
+		Represented: g.cfg.RepresentedCountry,
+		UnknownSet:  g.cfg.UnknownSet,
+		Accept:      g.validator.accepts,
+		Filter:      g.filter,
+	}
+}
+
+// load reads the networks of the shard. With -strict it stops once the
+// shard alone has too many decode errors.
+func (s *loadShard) load(g *geoIPGenerator, db *maxminddb.Reader, schema geonft.Schema) error {
+	mapped, err := g.loader(schema).LoadShard(g.ctx, db, s.scope, s.within, shardVisitor{g, s, schema})
+	s.mapped += mapped
+	return err
+}
+
+// shardVisitor collects the networks of a shard.
+type shardVisitor struct {
+	g      *geoIPGenerator
+	s      *loadShard
+	schema geonft.Schema
+}
+
+func (v shardVisitor) Network(pfx netip.Prefix, result maxminddb.Result, code string) error {
+	g, s := v.g, v.s
+	if len(g.dimensions) > 0 {
+		s.classifyDimensions(g.dimensions, pfx, result)
+	}
+
+	if len(g.cfg.Locales) > 0 {
+		g.collectLocalizedNames(s.names, v.schema, result, code)
+	}
+
+	switch {
+	case g.spool != nil && !s.ipv4Mapped():
+		if err := g.spoolNetwork(code, pfx); err != nil {
+			return err
+		}
+	case pfx.Addr().Is4():
+		s.ipv4.Add(code, pfx)
+	default:
+		s.ipv6.Add(code, pfx)
+	}
+	s.counters.loaded++
+
+	if g.spool == nil && g.cfg.MaxMemory > 0 && s.counters.loaded%spillCheckInterval == 0 {
+		return g.spillOverLimit(s)
+	}
+	return nil
+}
+
+func (v shardVisitor) Skip(prefix netip.Prefix, reason, detail string, err error) error {
+	s := v.s
+	switch reason {
+	case geonft.SkipDecodeError:
+		s.counters.decodeErrors++
+	case geonft.SkipEmptyCode:
+		s.counters.noCountry++
+	case geonft.SkipInvalidCode:
+		s.counters.rejected++
+		s.dropped[detail]++
+	case geonft.SkipFiltered:
+		s.counters.filtered++
+	}
+	strict := reason == geonft.SkipDecodeError && v.g.cfg.Strict
+	// Only the skip report and -strict need the networks themselves, a
+	// filter may skip almost the whole database
+	if v.g.cfg.SkipReport != "" || strict {
+		s.skipped = append(s.skipped, skippedNetwork{prefix, reason, detail, err})
+	}
+
+	if strict && s.counters.decodeErrors > v.g.cfg.MaxDecodeErrors {
+		return geonft.ErrStopShard
+	}
+	return nil
+}
+
+// mergeShards adds the results of the shards, in address order, to the
+// generator and the skip report. With -strict it fails at the decode error
+// a sequential load would have stopped at.
+func (g *geoIPGenerator) mergeShards(shards []*loadShard, report *skipReport) (mapped int, err error) {
+	for _, s := range shards {
+		decodeErrors := g.counters.decodeErrors
+		for _, skipped := range s.skipped {
+			report.add(skipped.prefix, skipped.reason, skipped.detail)
+			if skipped.reason != geonft.SkipDecodeError {
+				continue
+			}
+			decodeErrors++
+			if g.cfg.Strict && decodeErrors > g.cfg.MaxDecodeErrors {
+				return 0, withExitCode(exitParse, "too many decode errors (%d), last at %s: %w",
+					decodeErrors, skipped.prefix, skipped.err)
+			}
+		}
+
+		g.counters.loaded += s.counters.loaded
+		g.counters.decodeErrors += s.counters.decodeErrors
+		g.counters.noCountry += s.counters.noCountry
+		g.counters.rejected += s.counters.rejected
+		g.counters.filtered += s.counters.filtered
+		mapped += s.mapped
+
+		if s.ipv4Mapped() {
+			g.mapped.Merge(s.ipv4)
+		} else {
+			g.ipv4.Merge(s.ipv4)
+		}
+		g.ipv6.Merge(s.ipv6)
+		for i, d := range g.dimensions {
+			d.ipv4.Merge(s.dims[i].IPv4)
+			d.ipv6.Merge(s.dims[i].IPv6)
+		}
+		for code, n := range s.dropped {
+			g.validator.drop(code, n)
+		}
+		for code, names := range s.names {
+			if _, ok := g.localizedNames[code]; !ok {
+				g.localizedNames[code] = names
+			}
+		}
+	}
+	return mapped, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kkrow/maxminddb-to-nft/internal/mmdbfixture"
+)
+
+// TestLoadMappedNetworks checks that networks stored under ::ffff:0:0/96
+// land in the IPv4 sets as native prefixes, sorted in and without
+// duplicates, with every load path.
+func TestLoadMappedNetworks(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"sequential", []string{"-workers", "1"}},
+		{"sharded", []string{"-workers", "4"}},
+		{"stream", []string{"-stream"}},
+	}
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "fixture.mmdb")
+	writeFixture(t, input, mmdbfixture.Options{IPv4InIPv6: true})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := t.TempDir()
+			generate(t, append([]string{"-input", input, "-output-dir", output}, tt.args...)...)
+
+			ipv4, err := readNFTSets(filepath.Join(output, "geoip_ipv4.nft"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for code, want := range map[string][]netip.Prefix{
+				"JP": {netip.MustParsePrefix("11.0.0.0/8")},
+				"KR": {netip.MustParsePrefix("12.0.0.0/16")},
+				"AU": {netip.MustParsePrefix("1.0.0.0/24")},
+				"FR": {netip.MustParsePrefix("2.0.0.0/15")},
+				"DE": {netip.MustParsePrefix("4.0.0.0/16"), netip.MustParsePrefix("5.0.0.0/16"), netip.MustParsePrefix("192.0.2.0/24")},
+			} {
+				if !slices.Equal(ipv4[code], want) {
+					t.Errorf("IPv4 set %s = %v, want %v", code, ipv4[code], want)
+				}
+			}
+
+			ipv6, err := readNFTSets(filepath.Join(output, "geoip_ipv6.nft"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for code, prefixes := range ipv6 {
+				for _, p := range prefixes {
+					if p.Addr().Is4In6() {
+						t.Errorf("IPv6 set %s holds the mapped prefix %s", code, p)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestLoadShardSkipped checks that the shards only keep the skipped
+// networks when the skip report needs them.
+func TestLoadShardSkipped(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "fixture.mmdb")
+	writeFixture(t, input, mmdbfixture.Options{})
+
+	for _, tt := range []struct {
+		name        string
+		args        []string
+		wantSkipped bool
+	}{
+		{"without report", nil, false},
+		{"with report", []string{"-skip-report", "skipped.csv"}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-input", input, "-code-validation", "allowlist", "-allow-codes", "AU"}, tt.args...)
+			cfg, err := parseFlags(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := newGeoIPGenerator(t.Context(), cfg)
+			db, schema, err := g.openDatabase(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			var rejected, skipped int
+			for _, s := range g.loadShards(db, true) {
+				if err := s.load(g, db, schema); err != nil {
+					t.Fatal(err)
+				}
+				rejected += s.counters.rejected
+				skipped += len(s.skipped)
+			}
+			if rejected == 0 {
+				t.Fatal("no networks rejected")
+			}
+			if got := skipped > 0; got != tt.wantSkipped {
+				t.Errorf("kept %d skipped networks, want kept %t", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
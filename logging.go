@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats of -log-format
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Destinations of -log-output
+const (
+	logOutputStderr   = "stderr"
+	logOutputSyslog   = "syslog"
+	logOutputJournald = "journald"
+)
+
+// logIdentifier tags the messages sent to syslog and the journal.
+const logIdentifier = "maxminddb-to-nft"
+
+// setupLogging installs the default slog logger for -log-level,
+// -log-format and -log-output. Logs go to stderr by default, leaving
+// stdout to command output.
+func setupLogging(cfg config) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return fmt.Errorf("invalid -log-level %q, expected debug, info, warn or error", cfg.LogLevel)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.LogOutput != logOutputStderr {
+		// Syslog and the journal record the time and priority themselves
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return a
+		}
+	}
+
+	var format func(w io.Writer) slog.Handler
+	switch cfg.LogFormat {
+	case logFormatText:
+		format = func(w io.Writer) slog.Handler { return slog.NewTextHandler(w, opts) }
+	case logFormatJSON:
+		format = func(w io.Writer) slog.Handler { return slog.NewJSONHandler(w, opts) }
+	default:
+		return fmt.Errorf("-log-format must be %s or %s", logFormatText, logFormatJSON)
+	}
+
+	var handler slog.Handler
+	switch cfg.LogOutput {
+	case logOutputStderr:
+		handler = format(os.Stderr)
+	case logOutputSyslog, logOutputJournald:
+		send, err := openLogSink(cfg.LogOutput)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", cfg.LogOutput, err)
+		}
+		handler = newSinkHandler(format, send)
+	default:
+		return fmt.Errorf("-log-output must be %s, %s or %s", logOutputStderr, logOutputSyslog, logOutputJournald)
+	}
+
+	slog.SetDefault(slog.New(&warningHandler{Handler: handler}))
+	return nil
+}
+
+// sinkHandler formats each record with a regular slog handler and passes
+// the line with its level to a message based destination such as syslog.
+type sinkHandler struct {
+	inner slog.Handler
+	// Shared by all derived handlers, the buffer holds one record at a time
+	mu   *sync.Mutex
+	buf  *bytes.Buffer
+	send func(level slog.Level, line []byte) error
+}
+
+func newSinkHandler(format func(w io.Writer) slog.Handler, send func(slog.Level, []byte) error) *sinkHandler {
+	buf := new(bytes.Buffer)
+	return &sinkHandler{inner: format(buf), mu: new(sync.Mutex), buf: buf, send: send}
+}
+
+func (h *sinkHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buf.Reset()
+	if err := h.inner.Handle(ctx, r); err != nil {
+		return err
+	}
+	return h.send(r.Level, bytes.TrimSuffix(h.buf.Bytes(), []byte("\n")))
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := *h
+	derived.inner = h.inner.WithAttrs(attrs)
+	return &derived
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	derived := *h
+	derived.inner = h.inner.WithGroup(name)
+	return &derived
+}
+
+// syslogPriority maps a level to the syslog severity, as also used by the
+// journal's PRIORITY field.
+func syslogPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3 // err
+	case level >= slog.LevelWarn:
+		return 4 // warning
+	case level >= slog.LevelInfo:
+		return 6 // info
+	}
+	return 7 // debug
+}
+
+// fatal logs msg at error level and exits with code.
+func fatal(code int, msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(code)
+}
+
+// phaseTiming is the duration of one step of a run.
+type phaseTiming struct {
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// phase runs one step of a run, logs its duration and records it for the
+// run summary.
+func (g *geoIPGenerator) phase(name string, fn func() error) error {
+	// No step starts after a shutdown signal
+	if err := g.ctx.Err(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start).Seconds()
+	g.phases = append(g.phases, phaseTiming{Name: name, DurationSeconds: elapsed})
+	slog.Info("Phase finished", "phase", name, "duration_seconds", elapsed, "ok", err == nil)
+	return err
+}
+
+// warningLog collects the warnings logged during a run for the summary.
+type warningLog struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+var runWarnings warningLog
+
+func (l *warningLog) add(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, msg)
+}
+
+func (l *warningLog) list() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.messages...)
+}
+
+// warningHandler passes every record on and remembers those at warning
+// level in runWarnings, with their attributes as key=value pairs.
+type warningHandler struct {
+	slog.Handler
+	attrs []slog.Attr
+}
+
+func (h *warningHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level == slog.LevelWarn {
+		var msg strings.Builder
+		msg.WriteString(r.Message)
+		appendAttr := func(a slog.Attr) bool {
+			fmt.Fprintf(&msg, " %s=%v", a.Key, a.Value)
+			return true
+		}
+		for _, a := range h.attrs {
+			appendAttr(a)
+		}
+		r.Attrs(appendAttr)
+		runWarnings.add(msg.String())
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *warningHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &warningHandler{Handler: h.Handler.WithAttrs(attrs), attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h *warningHandler) WithGroup(name string) slog.Handler {
+	return &warningHandler{Handler: h.Handler.WithGroup(name), attrs: h.attrs}
+}
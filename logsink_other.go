@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+func openLogSink(output string) (func(slog.Level, []byte) error, error) {
+	return nil, fmt.Errorf("-log-output %s is not supported on this platform", output)
+}
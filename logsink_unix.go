@@ -0,0 +1,69 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"net"
+	"strconv"
+)
+
+// journalSocket is where systemd-journald accepts its native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// openLogSink connects to syslog or the journal and returns a function
+// sending one formatted line with the priority of its level.
+func openLogSink(output string) (func(slog.Level, []byte) error, error) {
+	if output == logOutputSyslog {
+		w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, logIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		return func(level slog.Level, line []byte) error {
+			switch syslogPriority(level) {
+			case 3:
+				return w.Err(string(line))
+			case 4:
+				return w.Warning(string(line))
+			case 6:
+				return w.Info(string(line))
+			}
+			return w.Debug(string(line))
+		}, nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return func(level slog.Level, line []byte) error {
+		var msg bytes.Buffer
+		journalField(&msg, "MESSAGE", line)
+		journalField(&msg, "PRIORITY", []byte(strconv.Itoa(syslogPriority(level))))
+		journalField(&msg, "SYSLOG_IDENTIFIER", []byte(logIdentifier))
+		if _, err := conn.Write(msg.Bytes()); err != nil {
+			return fmt.Errorf("writing to the journal: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// journalField appends a field in the journal's native protocol. Values
+// with newlines need the length prefixed binary form.
+func journalField(buf *bytes.Buffer, name string, value []byte) {
+	buf.WriteString(name)
+	if bytes.IndexByte(value, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.Write(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.Write(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// lookupPlace is a country or continent in a lookup response.
+type lookupPlace struct {
+	Code string `json:"code"`
+	Name string `json:"name,omitempty"`
+}
+
+type lookupASN struct {
+	Number       uint   `json:"number"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// lookupResponse is the JSON body of GET /lookup/{ip}. Country is what the
+// database says, Sets are the generated sets containing the address, which
+// differ when geofeeds or reserved range handling changed the assignment.
+type lookupResponse struct {
+	IP         string       `json:"ip"`
+	Network    string       `json:"network,omitempty"`
+	Country    *lookupPlace `json:"country,omitempty"`
+	Continent  *lookupPlace `json:"continent,omitempty"`
+	ASN        *lookupASN   `json:"asn,omitempty"`
+	Sets       []string     `json:"sets"`
+	BuildEpoch uint         `json:"build_epoch"`
+}
+
+// lookupData is the database and the sets of one run, served together so
+// that answers always match the files of the same snapshot.
+type lookupData struct {
+	db     *maxminddb.Reader
+	schema geonft.Schema
+	mode   string
+	asn    *maxminddb.Reader
+	ipv4   map[string][]netip.Prefix
+	ipv6   map[string][]netip.Prefix
+}
+
+// newLookupData takes the database and sets of a finished run. The sets
+// are sorted copies keyed by set name, the generator may be reused
+// afterwards.
+func (g *geoIPGenerator) newLookupData(asn *maxminddb.Reader) *lookupData {
+	return &lookupData{
+		db:     g.db,
+		schema: g.schema,
+		mode:   g.cfg.RepresentedCountry,
+		asn:    asn,
+		ipv4:   sortedCopy(g.ipv4, g.setName),
+		ipv6:   sortedCopy(g.ipv6, g.setName),
+	}
+}
+
+func sortedCopy(countryMap geonft.Sets, setName func(code string) string) map[string][]netip.Prefix {
+	out := make(map[string][]netip.Prefix, len(countryMap))
+	for code, prefixes := range countryMap {
+		out[setName(code)] = geonft.MergePrefixes(prefixes.Unpack())
+	}
+	return out
+}
+
+// openASNDatabase loads the optional -asn-input database.
+func (g *geoIPGenerator) openASNDatabase() (*maxminddb.Reader, error) {
+	if g.cfg.ASNInput == "" {
+		return nil, nil
+	}
+
+	db, err := g.openLocalMMDB(g.cfg.ASNInput)
+	if err != nil {
+		return nil, fmt.Errorf("opening ASN database: %w", err)
+	}
+	return db, nil
+}
+
+func (d *lookupData) lookup(addr netip.Addr) (lookupResponse, error) {
+	addr = addr.Unmap()
+	resp := lookupResponse{
+		IP:         addr.String(),
+		Sets:       []string{},
+		BuildEpoch: d.db.Metadata.BuildEpoch,
+	}
+
+	result := d.db.Lookup(addr)
+	if err := result.Err(); err != nil {
+		return resp, err
+	}
+	if result.Found() {
+		resp.Network = geonft.UnmapPrefix(result.Prefix()).String()
+	}
+
+	code, err := d.schema.CountryCode(result, d.mode)
+	if err != nil {
+		return resp, err
+	}
+	if code != "" {
+		resp.Country = &lookupPlace{Code: code}
+		if info, ok := lookupCountry(code); ok {
+			resp.Country.Name = info.Name
+			resp.Continent = &lookupPlace{Code: info.Continent, Name: continentNames[info.Continent]}
+		}
+	}
+
+	if d.asn != nil {
+		var record struct {
+			Number       uint   `maxminddb:"autonomous_system_number"`
+			Organization string `maxminddb:"autonomous_system_organization"`
+		}
+		if err := d.asn.Lookup(addr).Decode(&record); err != nil {
+			return resp, fmt.Errorf("decoding ASN record: %w", err)
+		}
+		if record.Number != 0 {
+			resp.ASN = &lookupASN{Number: record.Number, Organization: record.Organization}
+		}
+	}
+
+	countryMap := d.ipv6
+	if addr.Is4() {
+		countryMap = d.ipv4
+	}
+	for _, set := range sortedCodes(countryMap) {
+		if containsAddr(countryMap[set], addr) {
+			resp.Sets = append(resp.Sets, set)
+		}
+	}
+
+	return resp, nil
+}
+
+// containsAddr reports whether one of the sorted, non-overlapping prefixes
+// contains addr.
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	// The candidate is the last prefix starting at or before addr
+	i := sort.Search(len(prefixes), func(i int) bool {
+		return prefixes[i].Addr().Compare(addr) > 0
+	})
+	return i > 0 && prefixes[i-1].Contains(addr)
+}
+
+func (s *fileServer) serveLookup(w http.ResponseWriter, r *http.Request) {
+	addr, err := netip.ParseAddr(r.PathValue("ip"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid IP address %q", r.PathValue("ip")))
+		return
+	}
+
+	resp, err := s.current().lookup.lookup(addr)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", s.cacheControl())
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -1,315 +1,790 @@
 package main
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/netip"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime/debug"
 	"sort"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
 	"github.com/oschwald/maxminddb-golang/v2"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
-	maxDownloadSize = 1024 * 1024 * 1024 // 1024MB limit
+	maxDownloadSize = geonft.MaxDatabaseSize
 	requestTimeout  = 30 * time.Second
 	filePermissions = 0644
 	dirPermissions  = 0755
 )
 
-type countryRecord struct {
-	Country struct {
-		ISOCode string `maxminddb:"iso_code"`
-	} `maxminddb:"country"`
+type geoIPGenerator struct {
+	// Cancelled on SIGINT and SIGTERM
+	ctx       context.Context
+	cfg       config
+	client    *http.Client
+	validator *codeValidator
+	// Compiled -filter, nil without
+	filter *geonft.Filter
+	// Sets of the -dimensions besides the countries
+	dimensions []*dimension
+	ipv4       geonft.Sets
+	ipv6       geonft.Sets
+	// Localized country names from the database, keyed by code and locale
+	localizedNames map[string]map[string]string
+	counters       loadCounters
+	// Elements of the sets with -stream, the maps stay empty
+	spool *prefixSpool
+	// IPv4-mapped networks of IPv6 databases until they are merged into
+	// ipv4 or handed to the spool
+	mapped geonft.Sets
+	// Files written by the last generation
+	outputs []string
+	// Metadata of the loaded database
+	metadata maxminddb.Metadata
+	// The loaded database and its schema, kept for lookups by serve
+	db     *maxminddb.Reader
+	schema geonft.Schema
+	// Changes against the previous run, nil without -state-file or state
+	diff *runDiff
+	// Durations of the steps of the last run
+	phases []phaseTiming
+	// Per-set statistics of the last run, nil without -stats
+	stats *runStats
+	// Syntax of the target nft, see -target-nft-version
+	features nftFeatures
+	// User and group of the outputs, see -owner
+	owner outputOwner
+	// Set by serve to open -asn-input with the sources into asn
+	openASN bool
+	asn     *maxminddb.Reader
 }
 
-type geoIPGenerator struct {
-	client *http.Client
-	ipv4   map[string][]netip.Prefix
-	ipv6   map[string][]netip.Prefix
+// loadCounters tracks what happened to the networks of the database.
+type loadCounters struct {
+	loaded       int
+	decodeErrors int
+	noCountry    int
+	rejected     int
+	filtered     int
+}
+
+func (c loadCounters) skipped() int {
+	return c.decodeErrors + c.noCountry + c.rejected + c.filtered
 }
 
-func newGeoIPGenerator() *geoIPGenerator {
+func newGeoIPGenerator(ctx context.Context, cfg config) *geoIPGenerator {
+	// Validated with the configuration
+	owner, _ := parseOwner(cfg.Owner)
 	return &geoIPGenerator{
+		ctx: ctx,
+		cfg: cfg,
 		client: &http.Client{
 			Timeout: requestTimeout,
 		},
-		ipv4: make(map[string][]netip.Prefix),
-		ipv6: make(map[string][]netip.Prefix),
+		validator: newCodeValidator(cfg.CodeValidation, cfg.AllowCodes),
+		ipv4:      make(geonft.Sets),
+		ipv6:      make(geonft.Sets),
+
+		localizedNames: make(map[string]map[string]string),
+		features:       defaultNFTFeatures,
+		owner:          owner,
 	}
 }
 
-func main() {
-	generator := newGeoIPGenerator()
+const databaseURL = "https://github.com/GitSquared/node-geolite2-redist/raw/refs/heads/master/redist/GeoLite2-Country.tar.gz"
 
-	if err := generator.run(); err != nil {
-		log.Fatalf("Generation failed: %v", err)
+// Subcommands
+const (
+	commandGenerate = "generate"
+	commandCheck    = "check"
+	commandVerify   = "verify"
+	commandApply    = "apply"
+	commandServe    = "serve"
+	commandDaemon   = "daemon"
+	commandStats    = "stats"
+	commandCompare  = "compare"
+	commandBuild    = "build-mmdb"
+)
+
+func main() {
+	command, args := commandGenerate, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
-}
 
-func (g *geoIPGenerator) run() error {
-	const url = "https://github.com/GitSquared/node-geolite2-redist/raw/refs/heads/master/redist/GeoLite2-Country.tar.gz"
+	cfg, err := parseFlags(args)
+	if err != nil {
+		fatal(exitUsage, "Invalid arguments", "error", err)
+	}
+	if err := setupLogging(cfg); err != nil {
+		fatal(exitUsage, "Invalid arguments", "error", err)
+	}
 
-	mmdbData, err := g.downloadAndExtractMMDB(url)
+	stopProfiling, err := startProfiling(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to download and extract MMDB: %w", err)
+		fatal(exitUsage, "Invalid arguments", "error", err)
 	}
 
-	if err := g.loadGeoIPData(mmdbData); err != nil {
-		return fmt.Errorf("failed to load GeoIP data: %w", err)
+	if cfg.MaxMemory > 0 {
+		debug.SetMemoryLimit(int64(cfg.MaxMemory))
 	}
 
-	if err := g.generateAllFiles(); err != nil {
-		return fmt.Errorf("failed to generate files: %w", err)
+	// The first signal cancels the running command, a second one kills
+	// the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		slog.Warn("Shutting down, signal again to force")
+	}()
+
+	generator := newGeoIPGenerator(ctx, cfg)
+
+	switch command {
+	case commandGenerate:
+		start := time.Now()
+		err = generator.run()
+		generator.report(start, err)
+	case commandCheck:
+		err = generator.check()
+	case commandVerify:
+		err = generator.verify()
+	case commandApply:
+		err = generator.apply()
+	case commandServe:
+		if cfg.Stream || cfg.MaxMemory > 0 {
+			// /lookup answers from the sets in memory
+			fatal(exitUsage, "Invalid arguments", "error", "serve does not support -stream or -max-memory")
+		}
+		err = generator.serve()
+	case commandDaemon:
+		err = generator.daemon(func() (config, error) { return parseFlags(args) })
+	case commandStats:
+		err = generator.printStats()
+	case commandCompare:
+		if cfg.CompareInput == "" {
+			fatal(exitUsage, "Invalid arguments", "error", "compare requires -compare-input")
+		}
+		err = generator.compare()
+	case commandBuild:
+		if len(cfg.BuildInputs) == 0 {
+			fatal(exitUsage, "Invalid arguments", "error", "build-mmdb requires -build-inputs")
+		}
+		err = generator.buildMMDB()
+	default:
+		fatal(exitUsage, "Unknown command", "command", command, "expected",
+			[]string{commandGenerate, commandCheck, commandVerify, commandApply, commandServe, commandDaemon, commandStats, commandCompare, commandBuild})
 	}
 
-	return nil
+	stopProfiling()
+	if err != nil && ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		fatal(exitFailure, "Command interrupted", "command", command)
+	}
+	if err != nil {
+		fatal(exitCode(err), "Command failed", "command", command, "error", err)
+	}
 }
 
-func (g *geoIPGenerator) downloadAndExtractMMDB(url string) ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+func (g *geoIPGenerator) run() error {
+	if g.cfg.Stream {
+		var err error
+		if g.spool, err = newPrefixSpool(g.cfg.Format); err != nil {
+			return fmt.Errorf("creating spool: %w", err)
+		}
 	}
+	// -max-memory may create the spool while loading
+	defer func() { g.spool.remove() }()
 
-	resp, err := g.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	if err := g.resolveNFTFeatures(); err != nil {
+		return err
+	}
+	if err := g.prepare(); err != nil {
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	var prev *runState
+	if g.cfg.StateFile != "" {
+		var err error
+		if prev, err = loadState(g.cfg.StateFile); err != nil {
+			return fmt.Errorf("failed to load previous state: %w", err)
+		}
 	}
 
-	// Limit response size to prevent memory exhaustion
-	limitedReader := io.LimitReader(resp.Body, maxDownloadSize)
+	// Refuse to overwrite good outputs with a suspicious build
+	if prev != nil && g.cfg.MaxChangePercent > 0 {
+		if err := classify(exitValidation, g.checkChurn(prev)); err != nil {
+			return fmt.Errorf("churn safety check: %w", err)
+		}
+	}
 
-	gz, err := gzip.NewReader(limitedReader)
-	if err != nil {
-		return nil, fmt.Errorf("gzip reader: %w", err)
+	if err := classify(exitGeneration, g.phase("generate", g.generateAllFiles)); err != nil {
+		return fmt.Errorf("failed to generate files: %w", err)
 	}
-	defer gz.Close()
 
-	return g.extractMMDBFromTar(gz)
-}
+	if g.cfg.NFTCheck {
+		if err := classify(exitValidation, g.phase("nft_check", g.checkNFTFiles)); err != nil {
+			return fmt.Errorf("failed to validate files: %w", err)
+		}
+	}
 
-func (g *geoIPGenerator) extractMMDBFromTar(r io.Reader) ([]byte, error) {
-	tr := tar.NewReader(r)
+	if g.cfg.StateFile != "" {
+		if err := g.phase("state", func() error { return g.recordState(prev) }); err != nil {
+			return fmt.Errorf("failed to record state: %w", err)
+		}
+	}
 
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
+	if g.cfg.Stats {
+		if err := g.phase("stats", func() error { return g.writeStats(prev) }); err != nil {
+			return fmt.Errorf("failed to write statistics: %w", err)
 		}
-		if err != nil {
-			return nil, fmt.Errorf("reading tar header: %w", err)
+	}
+
+	if g.cfg.HTMLIndex {
+		if err := g.phase("index", g.writeHTMLIndex); err != nil {
+			return fmt.Errorf("failed to write %s: %w", indexFile, err)
 		}
+	}
 
-		// Security: prevent path traversal
-		if !isValidTarPath(hdr.Name) {
-			continue
+	if g.cfg.Sign != "" {
+		if err := g.phase("sign", g.signOutputs); err != nil {
+			return fmt.Errorf("failed to sign outputs: %w", err)
 		}
+	}
 
-		if strings.HasSuffix(hdr.Name, ".mmdb") {
-			// Limit file size to prevent memory exhaustion
-			if hdr.Size > maxDownloadSize {
-				return nil, fmt.Errorf("MMDB file too large: %d bytes", hdr.Size)
-			}
+	if len(g.cfg.Publish) > 0 {
+		if err := g.phase("publish", g.publish); err != nil {
+			return fmt.Errorf("failed to publish: %w", err)
+		}
+	}
 
-			mmdbData, err := io.ReadAll(io.LimitReader(tr, hdr.Size))
-			if err != nil {
-				return nil, fmt.Errorf("reading MMDB file: %w", err)
-			}
-			return mmdbData, nil
+	if g.cfg.GitRepo != "" {
+		if err := g.phase("git", g.publishGit); err != nil {
+			return fmt.Errorf("failed to commit outputs: %w", err)
 		}
 	}
 
-	return nil, fmt.Errorf("MMDB file not found in archive")
+	return nil
 }
 
-func (g *geoIPGenerator) loadGeoIPData(mmdbData []byte) error {
-	db, err := maxminddb.FromBytes(mmdbData)
+// prepare obtains the database and builds the final sets in memory.
+func (g *geoIPGenerator) prepare() error {
+	var src sources
+	err := g.phase("read", func() (err error) {
+		src, err = g.fetchSources()
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("opening MMDB: %w", err)
+		return err
 	}
-	defer db.Close()
+	return g.prepareSources(src)
+}
 
-	for result := range db.Networks() {
-		var rec countryRecord
-		if err := result.Decode(&rec); err != nil {
-			continue // Skip invalid records
-		}
+// prepareSources builds the sets from the fetched sources.
+func (g *geoIPGenerator) prepareSources(src sources) error {
+	g.asn = src.asn
+	if err := g.phase("load", func() error { return g.loadGeoIPData(src.db, src.schema) }); err != nil {
+		return fmt.Errorf("failed to load GeoIP data: %w", err)
+	}
 
-		pfx := result.Prefix()
-		code := rec.Country.ISOCode
+	// The options changing the sets after loading need them in memory
+	// and are rejected with -stream
+	if g.spool != nil {
+		return g.spool.finish()
+	}
 
-		if code == "" || !isValidCountryCode(code) {
-			continue
-		}
+	if err := g.phase("geofeeds", func() error { return g.applyGeofeeds(src.geofeeds) }); err != nil {
+		return fmt.Errorf("failed to apply geofeeds: %w", err)
+	}
 
-		if pfx.Addr().Is4() {
-			g.ipv4[code] = append(g.ipv4[code], pfx)
-		} else {
-			g.ipv6[code] = append(g.ipv6[code], pfx)
-		}
+	if g.cfg.StripReserved {
+		g.stripReserved()
+	}
+
+	g.guardBroadPrefixes()
+
+	if g.cfg.TransitionRanges != transitionKeep {
+		g.handleTransitionRanges()
+	}
+
+	// Geofeeds and derived transition ranges may reach outside -within
+	if within := g.cfg.withinPrefixes(); within != nil {
+		g.ipv4.Intersect(within)
+		g.ipv6.Intersect(within)
+	}
+
+	g.finishDimensions()
+
+	if g.cfg.BogonSet != "" {
+		g.addBogonSet(g.cfg.BogonSet)
 	}
 
 	return nil
 }
 
-func (g *geoIPGenerator) generateAllFiles() error {
-	// Create output directory
-	if err := os.MkdirAll("by_country", dirPermissions); err != nil {
-		return fmt.Errorf("creating by_country directory: %w", err)
+// openMMDB opens the database from -input or downloads it.
+func (g *geoIPGenerator) openMMDB(ctx context.Context) (*maxminddb.Reader, error) {
+	if g.cfg.Input != "" {
+		return g.openLocalMMDB(g.cfg.Input)
 	}
 
-	// Generate general files
-	if err := g.generateGlobalFile(g.ipv4, "geoip_ipv4.nft", "ipv4"); err != nil {
-		return fmt.Errorf("generating IPv4 global file: %w", err)
+	db, err := geonft.URLSource{URL: databaseURL, Client: g.client}.Open(ctx)
+	var dbErr *geonft.DatabaseError
+	if err != nil && !errors.As(err, &dbErr) {
+		return nil, classify(exitDownload, err)
 	}
+	return db, classify(exitParse, err)
+}
 
-	if err := g.generateGlobalFile(g.ipv6, "geoip_ipv6.nft", "ipv6"); err != nil {
-		return fmt.Errorf("generating IPv6 global file: %w", err)
+// openLocalMMDB opens a local database. A file that cannot be read fails
+// with the generic exit code, a broken database with exitParse.
+func (g *geoIPGenerator) openLocalMMDB(path string) (*maxminddb.Reader, error) {
+	db, err := geonft.FileSource{Path: path}.Open(g.ctx)
+	var dbErr *geonft.DatabaseError
+	if errors.As(err, &dbErr) {
+		return nil, classify(exitParse, err)
 	}
+	return db, err
+}
 
-	// Generate per-country files
-	if err := g.generateCountryFiles(); err != nil {
-		return fmt.Errorf("generating country files: %w", err)
+// openDatabase opens the database and resolves its record schema.
+func (g *geoIPGenerator) openDatabase(ctx context.Context) (*maxminddb.Reader, geonft.Schema, error) {
+	db, err := g.openMMDB(ctx)
+	if err != nil {
+		return nil, geonft.Schema{}, err
 	}
 
-	return nil
+	schema, err := geonft.DetectSchema(db, g.cfg.Schema, g.cfg.LookupPath)
+	if err != nil {
+		db.Close()
+		return nil, geonft.Schema{}, classify(exitParse, fmt.Errorf("detecting record schema: %w", err))
+	}
+	slog.Info("Using record schema", "schema", schema.Name)
+
+	if err := validateMetadata(db, schema, g.cfg); err != nil {
+		db.Close()
+		return nil, geonft.Schema{}, classify(exitValidation, fmt.Errorf("validating database: %w", err))
+	}
+
+	return db, schema, nil
 }
 
-func (g *geoIPGenerator) generateGlobalFile(countryMap map[string][]netip.Prefix, filename, ipType string) error {
-	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePermissions)
-	if err != nil {
-		return fmt.Errorf("creating file %s: %w", filename, err)
+func (g *geoIPGenerator) loadGeoIPData(db *maxminddb.Reader, schema geonft.Schema) error {
+	g.db, g.schema = db, schema
+	g.metadata = db.Metadata
+
+	if err := checkDatabaseAge(db.Metadata, g.cfg); err != nil {
+		return err
 	}
-	defer f.Close()
 
-	fmt.Fprintln(f, "#!/usr/sbin/nft -f")
-	fmt.Fprintln(f, "table inet geoip {")
+	if len(g.cfg.Locales) > 0 {
+		g.checkLocales(db)
+	}
 
-	// Sort country codes for consistent output
-	codes := make([]string, 0, len(countryMap))
-	for code := range countryMap {
-		codes = append(codes, code)
+	if len(g.cfg.Dimensions) > 0 {
+		var err error
+		if g.dimensions, err = newDimensions(g.cfg.Dimensions, schema); err != nil {
+			return classify(exitValidation, fmt.Errorf("-dimensions: %w", err))
+		}
 	}
-	sort.Strings(codes)
 
-	for _, code := range codes {
-		prefixes := countryMap[code]
-		if len(prefixes) == 0 {
-			continue
+	if g.cfg.Filter != "" {
+		var err error
+		if g.filter, err = geonft.CompileFilter(g.cfg.Filter); err != nil {
+			return fmt.Errorf("compiling -filter: %w", err)
 		}
+	}
 
-		if err := g.writeNFTSet(f, code, prefixes, ipType); err != nil {
-			return fmt.Errorf("writing NFT set for %s: %w", code, err)
+	var report *skipReport
+	if g.cfg.SkipReport != "" {
+		var err error
+		if report, err = g.openSkipReport(g.cfg.SkipReport); err != nil {
+			return err
 		}
+		defer report.abort()
+	}
+
+	g.mapped = make(geonft.Sets)
+	var mapped int
+	if g.spool == nil && g.cfg.MaxMemory == 0 && g.cfg.workers() > 1 {
+		shards := g.loadShards(db, true)
+
+		var group errgroup.Group
+		group.SetLimit(g.cfg.workers())
+		for _, shard := range shards {
+			group.Go(func() error { return shard.load(g, db, schema) })
+		}
+		if err := group.Wait(); err != nil {
+			return err
+		}
+
+		var err error
+		if mapped, err = g.mergeShards(shards, report); err != nil {
+			return err
+		}
+	} else {
+		// The spool takes the networks in address order, so -stream and
+		// -max-memory load sequentially and merge every shard right away.
+		// The IPv4-mapped networks come first, for the spool to merge them
+		// into the native IPv4 ones.
+		var shards, native []*loadShard
+		for _, shard := range g.loadShards(db, false) {
+			if shard.ipv4Mapped() {
+				shards = append(shards, shard)
+			} else {
+				native = append(native, shard)
+			}
+		}
+		for _, shard := range append(shards, native...) {
+			if g.spool != nil && !shard.ipv4Mapped() {
+				g.spoolMapped()
+			}
+			if err := shard.load(g, db, schema); err != nil {
+				return err
+			}
+			n, err := g.mergeShards([]*loadShard{shard}, report)
+			if err != nil {
+				return err
+			}
+			mapped += n
+		}
+	}
+
+	if mapped > 0 {
+		// The same networks may also exist in the native IPv4 tree. The
+		// spool merges them while writing.
+		if g.spool == nil {
+			g.ipv4.Merge(g.mapped)
+			geonft.MergeOverlaps(&geonft.Dataset{IPv4: g.ipv4})
+		} else {
+			g.spoolMapped()
+		}
+		for _, d := range g.dimensions {
+			geonft.MergeOverlaps(&geonft.Dataset{IPv4: d.ipv4})
+		}
+		slog.Info("Converted IPv4-mapped IPv6 networks to IPv4", "networks", mapped)
+	}
+
+	g.validator.report()
+
+	c := g.counters
+	slog.Info("Loaded networks", "loaded", c.loaded, "skipped", c.skipped(),
+		"decode_errors", c.decodeErrors, "no_country", c.noCountry, "rejected", c.rejected, "filtered", c.filtered)
+
+	if g.cfg.Strict && c.loaded == 0 {
+		return withExitCode(exitParse, "no networks loaded, the database schema probably does not match")
+	}
+
+	if err := report.close(); err != nil {
+		return fmt.Errorf("writing skip report: %w", err)
+	}
+	if report != nil {
+		slog.Info("Generated file", "path", g.cfg.SkipReport)
 	}
 
-	fmt.Fprintln(f, "}")
-	fmt.Printf("✅ Generated %s\n", filename)
 	return nil
 }
 
-func (g *geoIPGenerator) generateCountryFiles() error {
-	for code := range g.ipv4 {
-		if err := g.generateCountryFile(code, g.ipv4[code], "ipv4"); err != nil {
-			return fmt.Errorf("generating IPv4 file for %s: %w", code, err)
+// guardBroadPrefixes excludes prefixes that would match a huge part of the
+// internet, which is never a legitimate country assignment.
+func (g *geoIPGenerator) guardBroadPrefixes() {
+	families := []struct {
+		countryMap geonft.Sets
+		minBits    int
+	}{
+		{g.ipv4, g.cfg.MinPrefixIPv4},
+		{g.ipv6, g.cfg.MinPrefixIPv6},
+	}
+
+	for _, f := range families {
+		dropped := dropBroadPrefixes(f.countryMap, f.minBits)
+		for code, prefixes := range dropped {
+			for _, p := range prefixes {
+				slog.Warn("Excluding overly broad prefix", "prefix", p, "set", code, "floor", f.minBits)
+			}
 		}
 	}
+}
+
+// artifact is a generated output file and the function rendering it.
+type artifact struct {
+	path   string // relative to the output directory
+	render func(w io.Writer) error
+	// sets writes the data the file is rendered from for -incremental, nil
+	// when the file is always written
+	sets func(w io.Writer)
+}
 
-	for code := range g.ipv6 {
-		if err := g.generateCountryFile(code, g.ipv6[code], "ipv6"); err != nil {
-			return fmt.Errorf("generating IPv6 file for %s: %w", code, err)
+// artifacts lists every file the current sets produce.
+func (g *geoIPGenerator) artifacts() []artifact {
+	if g.spool != nil {
+		return append(g.spooledArtifacts(), g.ruleArtifacts()...)
+	}
+
+	var list []artifact
+	if g.cfg.family("ipv4") {
+		list = append(list, g.globalArtifact(g.ipv4, "ipv4"))
+	}
+	if g.cfg.family("ipv6") {
+		list = append(list, g.globalArtifact(g.ipv6, "ipv6"))
+	}
+
+	// Per-country files
+	for _, family := range []struct {
+		countryMap geonft.Sets
+		ipType     string
+	}{{g.ipv4, "ipv4"}, {g.ipv6, "ipv6"}} {
+		for _, code := range sortedCodes(family.countryMap) {
+			prefixes := family.countryMap[code]
+			if prefixes.Len() == 0 {
+				continue
+			}
+
+			code, ipType := code, family.ipType
+			list = append(list, artifact{
+				path: g.countryFile(code, ipType),
+				render: func(w io.Writer) error {
+					return g.writeCountryFile(w, code, prefixes, ipType)
+				},
+				sets: func(w io.Writer) { hashSet(w, code, prefixes) },
+			})
 		}
 	}
 
-	return nil
+	list = append(list, g.dimensionArtifacts()...)
+	list = append(list, g.ruleArtifacts()...)
+	list = append(list, g.setNamesArtifacts()...)
+	return append(list, g.namesArtifacts()...)
 }
 
-func (g *geoIPGenerator) generateCountryFile(code string, prefixes []netip.Prefix, ipType string) error {
-	if len(prefixes) == 0 {
-		return nil
+// countryFile returns the path of the per-country file of a set.
+func (g *geoIPGenerator) countryFile(code, ipType string) string {
+	name := g.setName(code)
+	return filepath.Join("by_country", name, fmt.Sprintf("%s_%s%s", name, ipType, g.cfg.setFileExt()))
+}
+
+// ruleArtifacts lists the files with rules using the sets.
+func (g *geoIPGenerator) ruleArtifacts() []artifact {
+	var list []artifact
+	if len(g.cfg.RateLimits) > 0 {
+		list = append(list, g.rateLimitArtifacts()...)
+	}
+	if len(g.cfg.Fwmarks) > 0 {
+		list = append(list, g.fwmarkArtifacts()...)
 	}
+	return list
+}
 
-	countryDir := filepath.Join("by_country", code)
-	if err := os.MkdirAll(countryDir, dirPermissions); err != nil {
-		return fmt.Errorf("creating country directory %s: %w", countryDir, err)
+func (g *geoIPGenerator) globalArtifact(countryMap geonft.Sets, ipType string) artifact {
+	return artifact{
+		path:   fmt.Sprintf("geoip_%s%s", ipType, g.cfg.setFileExt()),
+		render: func(w io.Writer) error { return g.writeGlobalFile(w, countryMap, ipType) },
+		sets: func(w io.Writer) {
+			for _, code := range sortedCodes(countryMap) {
+				hashSet(w, code, countryMap[code])
+			}
+		},
 	}
+}
 
-	filename := filepath.Join(countryDir, fmt.Sprintf("%s_%s.nft", code, ipType))
-	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePermissions)
-	if err != nil {
-		return fmt.Errorf("creating file %s: %w", filename, err)
+func (g *geoIPGenerator) generateAllFiles() error {
+	// Create output directory
+	if err := g.makeOutputDir(filepath.Join(g.cfg.OutputDir, "by_country")); err != nil {
+		return fmt.Errorf("creating by_country directory: %w", err)
 	}
-	defer f.Close()
 
-	fmt.Fprintln(f, "#!/usr/sbin/nft -f")
-	fmt.Fprintln(f, "table inet geoip {")
+	list := g.artifacts()
 
-	if err := g.writeNFTSet(f, code, prefixes, ipType); err != nil {
-		return fmt.Errorf("writing NFT set: %w", err)
+	// With -incremental, files whose sets did not change are left alone
+	var prev, next *incrementalManifest
+	if g.cfg.Incremental {
+		var err error
+		if next, err = g.newIncrementalManifest(); err != nil {
+			return fmt.Errorf("hashing configuration: %w", err)
+		}
+		for _, a := range list {
+			if a.sets != nil {
+				next.Files[a.path] = incrementalEntry{Sets: hashSets(a.sets)}
+			}
+		}
+		prev = loadIncrementalManifest(g.cfg.OutputDir)
+		// A run failing halfway must not leave a manifest describing
+		// files it did not write
+		if err := removeIncrementalManifest(g.cfg.OutputDir); err != nil {
+			return fmt.Errorf("removing %s: %w", incrementalFile, err)
+		}
 	}
 
-	fmt.Fprintln(f, "}")
+	// Write the files concurrently, but record and log them in artifact
+	// order so outputs and logs do not depend on scheduling
+	written := make([]string, len(list))
+	unchanged := make([]bool, len(list))
+	group, ctx := errgroup.WithContext(g.ctx)
+	group.SetLimit(g.cfg.workers())
+	for i, a := range list {
+		group.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if next != nil && a.sets != nil && next.unchanged(prev, g.cfg.OutputDir, a.path) {
+				written[i], unchanged[i] = filepath.Join(g.cfg.OutputDir, a.path), true
+				return nil
+			}
+			filename, err := g.writeArtifact(a)
+			if err != nil {
+				return fmt.Errorf("generating %s: %w", a.path, err)
+			}
+			written[i] = filename
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	for i, filename := range written {
+		g.outputs = append(g.outputs, filename)
+		if filepath.Dir(list[i].path) == "." && !unchanged[i] {
+			slog.Info("Generated file", "path", filename)
+		}
+	}
+
+	if next == nil {
+		return nil
+	}
+	var rewritten int
+	for i, a := range list {
+		if a.sets == nil || unchanged[i] {
+			continue
+		}
+		rewritten++
+		if err := next.record(g.cfg.OutputDir, a.path); err != nil {
+			return fmt.Errorf("recording %s: %w", a.path, err)
+		}
+	}
+	if err := next.removeStale(prev, g.cfg.OutputDir); err != nil {
+		return err
+	}
+	if err := g.saveManifest(next); err != nil {
+		return fmt.Errorf("writing %s: %w", incrementalFile, err)
+	}
+	slog.Info("Incremental generation", "rewritten", rewritten, "unchanged", len(list)-rewritten)
 	return nil
 }
 
-func (g *geoIPGenerator) writeNFTSet(w io.Writer, code string, prefixes []netip.Prefix, ipType string) error {
-	fmt.Fprintf(w, "    set %s {\n", code)
-	fmt.Fprintf(w, "        type %s_addr\n", ipType)
-	fmt.Fprintln(w, "        flags interval")
-	fmt.Fprint(w, "        elements = { ")
+// writeArtifact renders a to its file and returns the file path. It runs
+// concurrently with the other artifacts.
+func (g *geoIPGenerator) writeArtifact(a artifact) (string, error) {
+	filename := filepath.Join(g.cfg.OutputDir, a.path)
 
-	// Pre-allocate slice for better performance
-	parts := make([]string, 0, len(prefixes))
-	for _, prefix := range prefixes {
-		parts = append(parts, prefix.String())
+	if err := g.makeOutputDir(filepath.Dir(filename)); err != nil {
+		return "", fmt.Errorf("creating directory for %s: %w", filename, err)
 	}
 
-	fmt.Fprint(w, strings.Join(parts, ", "))
-	fmt.Fprintln(w, " }")
-	fmt.Fprintln(w, "    }")
+	if err := g.writeOutput(filename, a.render); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
 
-	return nil
+// sortedCodes returns the set names of countryMap in consistent order.
+func sortedCodes[V any](countryMap map[string]V) []string {
+	codes := make([]string, 0, len(countryMap))
+	for code := range countryMap {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func (g *geoIPGenerator) writeGlobalFile(w io.Writer, countryMap geonft.Sets, ipType string) error {
+	return g.writeNFTFile(w, func(w io.Writer) error {
+		for _, code := range sortedCodes(countryMap) {
+			prefixes := countryMap[code]
+			if prefixes.Len() == 0 {
+				continue
+			}
+
+			if err := g.writeNFTSet(w, code, prefixes, ipType); err != nil {
+				return fmt.Errorf("writing NFT set for %s: %w", code, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (g *geoIPGenerator) writeCountryFile(w io.Writer, code string, prefixes *geonft.PrefixList, ipType string) error {
+	return g.writeNFTFile(w, func(w io.Writer) error {
+		if err := g.writeNFTSet(w, code, prefixes, ipType); err != nil {
+			return fmt.Errorf("writing NFT set: %w", err)
+		}
+		return nil
+	})
+}
+
+// writeNFTFile wraps the sets written by sets in the -table, unless
+// -no-table leaves them bare, or in a JSON ruleset with -format nft-json.
+func (g *geoIPGenerator) writeNFTFile(w io.Writer, sets func(w io.Writer) error) error {
+	if g.cfg.Format == formatNFTJSON {
+		return geonft.WriteNFTJSON(w, g.cfg.nftTable(), sets)
+	}
+	if g.cfg.NoTable {
+		return sets(w)
+	}
+	return geonft.WriteNFTTable(w, g.cfg.TableFamily, g.cfg.Table, sets)
+}
+
+func (g *geoIPGenerator) writeNFTSet(w io.Writer, code string, prefixes *geonft.PrefixList, ipType string) error {
+	if g.cfg.Format == formatNFTJSON {
+		return geonft.WriteNFTJSONSet(w, g.cfg.nftTable(), g.setName(code), ipType, g.setOptions(code), prefixes)
+	}
+	return geonft.WriteNFTSet(w, g.setName(code), ipType, g.setOptions(code), prefixes)
 }
 
-// Security functions
+// writeNFTSetWith writes the set code, its comma separated elements come
+// from elements.
+func (g *geoIPGenerator) writeNFTSetWith(w io.Writer, code, ipType string, elements func(w io.Writer) error) error {
+	if g.cfg.Format == formatNFTJSON {
+		return geonft.WriteNFTJSONSetWith(w, g.cfg.nftTable(), g.setName(code), ipType, g.setOptions(code), elements)
+	}
+	return geonft.WriteNFTSetWith(w, g.setName(code), ipType, g.setOptions(code), elements)
+}
 
-func isValidTarPath(path string) bool {
-	// Prevent path traversal attacks
-	cleanPath := filepath.Clean(path)
-	return !strings.Contains(cleanPath, "..") &&
-		!strings.HasPrefix(cleanPath, "/") &&
-		!strings.HasPrefix(cleanPath, "\\")
+func (g *geoIPGenerator) setOptions(code string) geonft.SetOptions {
+	return geonft.SetOptions{Comment: g.setComment(code), AutoMerge: g.features.autoMerge}
 }
 
-func isValidCountryCode(code string) bool {
-	// Basic validation for ISO country codes
-	return len(code) == 2 &&
-		code == strings.ToUpper(code) &&
-		isAlphaOnly(code)
+// setComment returns the country and continent names written above the
+// set code with -nft-comments.
+func (g *geoIPGenerator) setComment(code string) string {
+	if !g.cfg.NFTComments {
+		return ""
+	}
+	if info, ok := lookupCountry(code); ok {
+		return fmt.Sprintf("%s (%s)", info.Name, continentNames[info.Continent])
+	}
+	return ""
 }
 
-func isAlphaOnly(s string) bool {
-	for _, r := range s {
-		if r < 'A' || r > 'Z' {
+// isValidSetName checks that name is usable as an nft set identifier
+func isValidSetName(name string) bool {
+	for i, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '_'):
+		default:
 			return false
 		}
 	}
-	return true
+	return name != ""
 }
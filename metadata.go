@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+const (
+	// No GeoIP database predates this
+	minBuildTime = "2002-01-01T00:00:00Z"
+	// Tolerated clock skew for build epochs in the future
+	maxBuildSkew = 24 * time.Hour
+)
+
+// validateMetadata checks that the database is the edition we expect and
+// that its records can be decoded with the schema before any processing.
+func validateMetadata(db *maxminddb.Reader, schema geonft.Schema, cfg config) error {
+	md := db.Metadata
+
+	if want := cfg.ExpectDatabaseType; want != "" &&
+		!strings.Contains(strings.ToLower(md.DatabaseType), strings.ToLower(want)) {
+		return fmt.Errorf("database type %q does not match expected %q, is this the right edition?",
+			md.DatabaseType, want)
+	}
+
+	built := md.BuildTime()
+	earliest, _ := time.Parse(time.RFC3339, minBuildTime)
+	if md.BuildEpoch == 0 || built.Before(earliest) {
+		return fmt.Errorf("implausible build epoch %d", md.BuildEpoch)
+	}
+	if built.After(time.Now().Add(maxBuildSkew)) {
+		return fmt.Errorf("build time %s is in the future", built.UTC().Format(time.RFC3339))
+	}
+
+	// Probe a few records to make sure the schema actually matches
+	probed := 0
+	for result := range db.Networks() {
+		if probed >= geonft.SchemaProbeLimit {
+			break
+		}
+		probed++
+
+		code, err := schema.CountryCode(result, cfg.RepresentedCountry)
+		if err == nil && geonft.ValidCountryCode(code) {
+			slog.Info("Database metadata", "type", md.DatabaseType, "built", built.UTC().Format(time.RFC3339))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no country code found in the first %d records of %q with the %s schema",
+		probed, md.DatabaseType, schema.Name)
+}
+
+// checkDatabaseAge warns or fails when the database build is older than the
+// configured limits, which usually means the upstream mirror went stale.
+func checkDatabaseAge(md maxminddb.Metadata, cfg config) error {
+	age := time.Since(md.BuildTime())
+
+	if cfg.MaxAge > 0 && age > time.Duration(cfg.MaxAge) {
+		return withExitCode(exitStale, "database is %s old, exceeding -max-age %s",
+			formatAge(age), cfg.MaxAge)
+	}
+
+	if cfg.WarnAge > 0 && age > time.Duration(cfg.WarnAge) {
+		slog.Warn("Database exceeds -warn-age", "age", formatAge(age), "warn_age", cfg.WarnAge.String())
+	}
+
+	return nil
+}
+
+// formatAge renders an age in days and hours.
+func formatAge(age time.Duration) string {
+	days := int(age / (24 * time.Hour))
+	hours := int(age % (24 * time.Hour) / time.Hour)
+	return fmt.Sprintf("%dd%dh", days, hours)
+}
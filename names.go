@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sort"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// Names metadata formats
+const (
+	namesJSON = "json"
+	namesCSV  = "csv"
+)
+
+// countryName is a single entry of the names metadata files.
+type countryName struct {
+	Code          string `json:"-"`
+	Name          string `json:"name"`
+	Continent     string `json:"continent"`
+	ContinentName string `json:"continent_name"`
+	// Keyed by locale, only for the locales selected with -locale
+	LocalizedNames map[string]string `json:"localized_names,omitempty"`
+}
+
+// collectLocalizedNames adds the selected localized names of code to
+// localizedNames the first time a record of that country is seen.
+func (g *geoIPGenerator) collectLocalizedNames(localizedNames map[string]map[string]string, schema geonft.Schema, result maxminddb.Result, code string) {
+	if _, ok := localizedNames[code]; ok {
+		return
+	}
+
+	names, err := schema.LocalizedNames(result, code)
+	if err != nil || names == nil {
+		return
+	}
+
+	selected := make(map[string]string, len(g.cfg.Locales))
+	for _, locale := range g.cfg.Locales {
+		if name, ok := names[locale]; ok {
+			selected[locale] = name
+		}
+	}
+	localizedNames[code] = selected
+}
+
+// checkLocales warns about selected locales the database does not carry.
+func (g *geoIPGenerator) checkLocales(db *maxminddb.Reader) {
+	available := make(map[string]bool, len(db.Metadata.Languages))
+	for _, lang := range db.Metadata.Languages {
+		available[lang] = true
+	}
+
+	for _, locale := range g.cfg.Locales {
+		if !available[locale] {
+			slog.Warn("Locale is not listed in the database languages", "locale", locale, "languages", db.Metadata.Languages)
+		}
+	}
+}
+
+// countryNames returns the metadata of every generated set, sorted by code.
+// Sets that are not countries get empty names.
+func (g *geoIPGenerator) countryNames() []countryName {
+	seen := make(map[string]bool)
+	for _, sizes := range g.setSizes() {
+		for code := range sizes {
+			seen[code] = true
+		}
+	}
+
+	names := make([]countryName, 0, len(seen))
+	for code := range seen {
+		entry := countryName{Code: code}
+		if info, ok := lookupCountry(code); ok {
+			entry.Name = info.Name
+			entry.Continent = info.Continent
+			entry.ContinentName = continentNames[info.Continent]
+		}
+		if localized := g.localizedNames[code]; len(localized) > 0 {
+			entry.LocalizedNames = localized
+		}
+		names = append(names, entry)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].Code < names[j].Code })
+
+	return names
+}
+
+// namesArtifacts returns the names metadata files for the selected formats.
+func (g *geoIPGenerator) namesArtifacts() []artifact {
+	if len(g.cfg.NamesFormats) == 0 {
+		return nil
+	}
+
+	names := g.countryNames()
+
+	var list []artifact
+	for _, format := range g.cfg.NamesFormats {
+		switch format {
+		case namesJSON:
+			list = append(list, artifact{path: "names.json", render: func(w io.Writer) error {
+				return writeNamesJSON(w, names)
+			}})
+		case namesCSV:
+			list = append(list, artifact{path: "names.csv", render: func(w io.Writer) error {
+				return writeNamesCSV(w, names, g.cfg.Locales)
+			}})
+		}
+	}
+
+	return list
+}
+
+func writeNamesJSON(w io.Writer, names []countryName) error {
+	byCode := make(map[string]countryName, len(names))
+	for _, n := range names {
+		byCode[n.Code] = n
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(byCode)
+}
+
+func writeNamesCSV(w io.Writer, names []countryName, locales []string) error {
+	cw := csv.NewWriter(w)
+	header := []string{"code", "name", "continent", "continent_name"}
+	for _, locale := range locales {
+		header = append(header, "name_"+locale)
+	}
+	cw.Write(header)
+
+	for _, n := range names {
+		row := []string{n.Code, n.Name, n.Continent, n.ContinentName}
+		for _, locale := range locales {
+			row = append(row, n.LocalizedNames[locale])
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
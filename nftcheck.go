@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// checkNFTFiles runs every generated nft file through `nft -c -f` so that
+// syntax regressions are caught before the files reach a firewall.
+func (g *geoIPGenerator) checkNFTFiles() error {
+	nft, err := exec.LookPath(g.cfg.NFTBinary)
+	if err != nil {
+		return fmt.Errorf("nft binary not found: %w", err)
+	}
+
+	checked := 0
+	var failed []string
+	for _, file := range g.outputs {
+		if !g.nftFile(file) {
+			continue
+		}
+		checked++
+
+		out, err := g.checkNFTFile(nft, file)
+		if err != nil {
+			slog.Error("File failed nft check", "path", file, "output", strings.TrimSpace(string(out)))
+			failed = append(failed, file)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d files failed nft check", len(failed), checked)
+	}
+
+	slog.Info("Files passed nft check", "files", checked)
+	return nil
+}
+
+// nftFile reports whether file is one of the generated nft files. The
+// .json files of -format nft-json are told from the other JSON outputs,
+// like stats.json, by their names.
+func (g *geoIPGenerator) nftFile(file string) bool {
+	switch filepath.Ext(file) {
+	case ".nft":
+		return true
+	case ".json":
+		rel, err := filepath.Rel(g.cfg.OutputDir, file)
+		return err == nil && g.cfg.Format == formatNFTJSON &&
+			(strings.HasPrefix(rel, "geoip_") || strings.HasPrefix(rel, "by_country"+string(filepath.Separator)))
+	}
+	return false
+}
+
+// ruleSetFile returns the global file whose sets the rule file uses, which
+// is checked with that file loaded first.
+func ruleSetFile(file string) (string, bool) {
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if filepath.Base(file) == fmt.Sprintf(rateLimitFile, family) {
+			return filepath.Join(filepath.Dir(file), fmt.Sprintf("geoip_%s.nft", family)), true
+		}
+	}
+	return "", false
+}
+
+// bareNFTFile reports whether file holds sets written without their table
+// by -no-table. The rule files always have it.
+func (g *geoIPGenerator) bareNFTFile(file string) bool {
+	_, rule := ruleSetFile(file)
+	return g.cfg.NoTable && !rule && filepath.Base(file) != fwmarkFile
+}
+
+func (g *geoIPGenerator) checkNFTFile(nft, file string) ([]byte, error) {
+	if filepath.Ext(file) == ".json" {
+		return exec.CommandContext(g.ctx, nft, "-j", "-c", "-f", file).CombinedOutput()
+	}
+	files := []string{file}
+	if sets, ok := ruleSetFile(file); ok {
+		files = []string{sets, file}
+	} else if !g.bareNFTFile(file) {
+		return exec.CommandContext(g.ctx, nft, "-c", "-f", file).CombinedOutput()
+	}
+
+	wrapper, err := os.CreateTemp("", "nftcheck-*.nft")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(wrapper.Name())
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			wrapper.Close()
+			return nil, err
+		}
+		if g.bareNFTFile(f) {
+			fmt.Fprintf(wrapper, "table %s {\n    include %q\n}\n", g.cfg.table(), abs)
+			continue
+		}
+		fmt.Fprintf(wrapper, "include %q\n", abs)
+	}
+	if err := wrapper.Close(); err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(g.ctx, nft, "-c", "-f", wrapper.Name()).CombinedOutput()
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// targetNFTLocal makes -target-nft-version probe the local nft and kernel.
+const targetNFTLocal = "local"
+
+var (
+	nftVersionPattern = regexp.MustCompile(`^v?([0-9]+)\.([0-9]+)(?:\.([0-9]+))?$`)
+	// Matches the version in the output of nft --version, like
+	// "nftables v1.0.9 (Old Doc Yak #3)"
+	nftVersionOutput = regexp.MustCompile(`v([0-9]+\.[0-9]+(?:\.[0-9]+)?)`)
+	// Priority names like "priority filter" instead of a number
+	priorityName = regexp.MustCompile(`priority [a-z]`)
+)
+
+// nftFeatures are the parts of the generated syntax that depend on the
+// nft version and the kernel.
+type nftFeatures struct {
+	// auto-merge on the sets, nft 0.9.0
+	autoMerge bool
+	// Chain priorities by name like filter or mangle, nft 0.9.1
+	priorityNames bool
+	// Named limit objects of -rate-limit, nft 0.9.1 and kernel support
+	namedLimits bool
+}
+
+// defaultNFTFeatures are used without -target-nft-version. The sets are
+// written without auto-merge, so the output does not change with the
+// option unset.
+var defaultNFTFeatures = nftFeatures{priorityNames: true, namedLimits: true}
+
+// nftVersion is a version of nft like 1.0.9.
+type nftVersion [3]int
+
+func parseNFTVersion(s string) (nftVersion, error) {
+	m := nftVersionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return nftVersion{}, fmt.Errorf("invalid nft version %q, must be like 0.9.8", s)
+	}
+	var v nftVersion
+	for i, part := range m[1:] {
+		if part != "" {
+			v[i], _ = strconv.Atoi(part)
+		}
+	}
+	return v, nil
+}
+
+func (v nftVersion) atLeast(major, minor, patch int) bool {
+	switch {
+	case v[0] != major:
+		return v[0] > major
+	case v[1] != minor:
+		return v[1] > minor
+	}
+	return v[2] >= patch
+}
+
+func (v nftVersion) features() nftFeatures {
+	return nftFeatures{
+		autoMerge:     v.atLeast(0, 9, 0),
+		priorityNames: v.atLeast(0, 9, 1),
+		namedLimits:   v.atLeast(0, 9, 1),
+	}
+}
+
+// missing lists the features f uses and have lacks.
+func (f nftFeatures) missing(have nftFeatures) []string {
+	var list []string
+	if f.autoMerge && !have.autoMerge {
+		list = append(list, "auto-merge")
+	}
+	if f.priorityNames && !have.priorityNames {
+		list = append(list, "priority names")
+	}
+	if f.namedLimits && !have.namedLimits {
+		list = append(list, "named limits")
+	}
+	return list
+}
+
+// priority returns the chain priority name, or its number when the
+// target nft lacks the names.
+func (f nftFeatures) priority(name string) string {
+	if f.priorityNames {
+		return name
+	}
+	switch name {
+	case "mangle":
+		return "-150"
+	case "filter":
+		return "0"
+	}
+	return name
+}
+
+// resolveNFTFeatures sets the features of -target-nft-version before the
+// files are rendered. -rate-limit cannot be written for a target without
+// named limits.
+func (g *geoIPGenerator) resolveNFTFeatures() error {
+	switch g.cfg.TargetNFTVersion {
+	case "":
+		g.features = defaultNFTFeatures
+	case targetNFTLocal:
+		nft, err := exec.LookPath(g.cfg.NFTBinary)
+		if err != nil {
+			return fmt.Errorf("nft binary not found: %w", err)
+		}
+		if g.features, err = probeNFTFeatures(g.ctx, nft); err != nil {
+			return err
+		}
+	default:
+		// Validated with the configuration
+		v, _ := parseNFTVersion(g.cfg.TargetNFTVersion)
+		g.features = v.features()
+	}
+
+	if len(g.cfg.RateLimits) > 0 && !g.features.namedLimits {
+		return fmt.Errorf("-rate-limit needs named limits, which the target nft %s lacks", g.cfg.TargetNFTVersion)
+	}
+	return nil
+}
+
+// probeNFTFeatures derives the features from the version of nft and
+// checks those depending on the kernel with `nft -c`. Without the
+// privileges for the check, the version decides.
+func probeNFTFeatures(ctx context.Context, nft string) (nftFeatures, error) {
+	out, err := exec.CommandContext(ctx, nft, "--version").Output()
+	if err != nil {
+		return nftFeatures{}, fmt.Errorf("running nft --version: %w", err)
+	}
+	m := nftVersionOutput.FindSubmatch(out)
+	if m == nil {
+		return nftFeatures{}, fmt.Errorf("no version in the nft --version output %q", bytes.TrimSpace(out))
+	}
+	v, err := parseNFTVersion(string(m[1]))
+	if err != nil {
+		return nftFeatures{}, err
+	}
+	features := v.features()
+
+	if features.namedLimits {
+		supported, err := checkNFTSnippet(ctx, nft, "table inet maxminddb_to_nft_probe {\n    limit probe {\n        rate over 1/second\n    }\n}\n")
+		if err != nil {
+			slog.Warn("Probing the kernel failed, deciding by the nft version", "version", string(m[1]), "error", err)
+		} else {
+			features.namedLimits = supported
+		}
+	}
+
+	slog.Info("Probed nft", "version", string(m[1]), "auto_merge", features.autoMerge,
+		"priority_names", features.priorityNames, "named_limits", features.namedLimits)
+	return features, nil
+}
+
+// checkNFTSnippet reports whether `nft -c` accepts snippet. Failures that
+// do not concern the snippet, like missing privileges, are returned as
+// errors.
+func checkNFTSnippet(ctx context.Context, nft, snippet string) (bool, error) {
+	f, err := os.CreateTemp("", "nftprobe-*.nft")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(snippet); err != nil {
+		f.Close()
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+
+	out, err := exec.CommandContext(ctx, nft, "-c", "-f", f.Name()).CombinedOutput()
+	if err == nil {
+		return true, nil
+	}
+	if strings.Contains(string(out), "Operation not permitted") {
+		return false, fmt.Errorf("nft -c: %s", bytes.TrimSpace(out))
+	}
+	return false, nil
+}
+
+// checkApplyFeatures probes the local nft before apply and refuses files
+// using features it lacks, naming them instead of leaving an nft syntax
+// error. An nft whose version cannot be probed is left to the load.
+func (g *geoIPGenerator) checkApplyFeatures(nft string) error {
+	have, err := probeNFTFeatures(g.ctx, nft)
+	if err != nil {
+		slog.Warn("Probing nft failed, applying without checking its features", "error", err)
+		return nil
+	}
+	for _, name := range g.cfg.ApplyFiles {
+		data, err := os.ReadFile(filepath.Join(g.cfg.OutputDir, name))
+		if err != nil {
+			return err
+		}
+		need := nftFeatures{
+			autoMerge:     bytes.Contains(data, []byte("auto-merge")),
+			priorityNames: priorityName.Match(data),
+			namedLimits:   bytes.Contains(data, []byte("limit name")),
+		}
+		if missing := need.missing(have); len(missing) > 0 {
+			return fmt.Errorf("%s uses %s, which the local nft lacks, generate with -target-nft-version %s",
+				name, strings.Join(missing, ", "), targetNFTLocal)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// Syntaxes of -format
+const (
+	formatNFT     = "nft"
+	formatNFTJSON = "nft-json"
+)
+
+// setFileExt returns the extension of the files holding sets in the
+// -format.
+func (c config) setFileExt() string {
+	if c.Format == formatNFTJSON {
+		return ".json"
+	}
+	return ".nft"
+}
+
+func (c config) nftTable() geonft.NFTTable {
+	return geonft.NFTTable{Family: c.TableFamily, Name: c.Table}
+}
+
+// nftJSONRuleset is the part of the JSON format of `nft -j` that holds the
+// sets.
+type nftJSONRuleset struct {
+	Nftables []struct {
+		Set *struct {
+			Name string `json:"name"`
+			Elem []struct {
+				Prefix struct {
+					Addr netip.Addr `json:"addr"`
+					Len  int        `json:"len"`
+				} `json:"prefix"`
+			} `json:"elem"`
+		} `json:"set"`
+	} `json:"nftables"`
+}
+
+// parseNFTJSONSets reads the sets of a file in the format written by
+// -format nft-json and returns their elements keyed by set name.
+func parseNFTJSONSets(r io.Reader) (map[string][]netip.Prefix, error) {
+	var ruleset nftJSONRuleset
+	if err := json.NewDecoder(r).Decode(&ruleset); err != nil {
+		return nil, err
+	}
+
+	sets := make(map[string][]netip.Prefix)
+	for _, object := range ruleset.Nftables {
+		if object.Set == nil {
+			continue
+		}
+		for _, elem := range object.Set.Elem {
+			prefix := netip.PrefixFrom(elem.Prefix.Addr, elem.Prefix.Len)
+			if !prefix.IsValid() {
+				return nil, fmt.Errorf("set %s: invalid element %s/%d", object.Set.Name, elem.Prefix.Addr, elem.Prefix.Len)
+			}
+			sets[object.Set.Name] = append(sets[object.Set.Name], prefix)
+		}
+	}
+	return sets, nil
+}
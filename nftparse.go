@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseNFTSets reads the sets of a file in the format written by
+// writeNFTSet and returns their elements keyed by set name.
+func parseNFTSets(r io.Reader) (map[string][]netip.Prefix, error) {
+	sets := make(map[string][]netip.Prefix)
+
+	scanner := bufio.NewScanner(r)
+	// Element lines of large sets easily exceed the default token size
+	scanner.Buffer(make([]byte, 0, 64*1024), maxDownloadSize)
+
+	current := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if name, ok := strings.CutPrefix(line, "set "); ok {
+			current = strings.TrimSpace(strings.TrimSuffix(name, "{"))
+			continue
+		}
+
+		elements, ok := strings.CutPrefix(line, "elements = {")
+		if !ok || current == "" {
+			continue
+		}
+
+		elements = strings.TrimSuffix(elements, "}")
+		for _, item := range strings.Split(elements, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("set %s: invalid element %q", current, item)
+			}
+			sets[current] = append(sets[current], prefix)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return sets, nil
+}
+
+// readNFTSets parses the sets of the nft file at path, or of the JSON
+// ruleset of -format nft-json for a .json file.
+func readNFTSets(path string) (map[string][]netip.Prefix, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	parse := parseNFTSets
+	if filepath.Ext(path) == ".json" {
+		parse = parseNFTJSONSets
+	}
+	sets, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return sets, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Object storage schemes accepted by -publish
+var objectSchemes = []string{"s3://", "gs://", "az://"}
+
+func isObjectTarget(target string) bool {
+	for _, scheme := range objectSchemes {
+		if strings.HasPrefix(target, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// publishObjects uploads the outputs to an s3://bucket/prefix,
+// gs://bucket/prefix or az://account/container/prefix target with the
+// provider CLI (aws, gcloud, azcopy), so its usual credential chain
+// applies. Files are uploaded in one sync per extension to give each its
+// content type, and the provider stores a checksum with every object.
+func (g *geoIPGenerator) publishObjects(target string, files []string) error {
+	for _, ext := range outputExtensions(files) {
+		var cmd *exec.Cmd
+		switch {
+		case strings.HasPrefix(target, "s3://"):
+			cmd = g.s3Sync(target, ext)
+		case strings.HasPrefix(target, "gs://"):
+			cmd = g.gcsSync(target, ext)
+		default:
+			var err error
+			if cmd, err = g.azureCopy(target, ext); err != nil {
+				return err
+			}
+		}
+
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+		}
+		if g.cfg.PublishDryRun && len(out) > 0 {
+			fmt.Print(string(out))
+		}
+	}
+
+	if g.cfg.PublishDelete && strings.HasPrefix(target, "az://") {
+		// azcopy copy never deletes, a sync of the now current tree does
+		u, err := azureURL(target)
+		if err != nil {
+			return err
+		}
+		args := []string{"sync", g.cfg.OutputDir, u, "--recursive", "--delete-destination=true"}
+		if g.cfg.PublishDryRun {
+			args = append(args, "--dry-run")
+		}
+		if out, err := exec.CommandContext(g.ctx, "azcopy", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("azcopy: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+func (g *geoIPGenerator) s3Sync(target, ext string) *exec.Cmd {
+	args := []string{"s3", "sync", g.cfg.OutputDir, target,
+		"--exclude", "*", "--include", "*" + ext,
+		"--content-type", contentType(ext),
+		"--checksum-algorithm", "SHA256"}
+	if g.cfg.PublishCacheControl != "" {
+		args = append(args, "--cache-control", g.cfg.PublishCacheControl)
+	}
+	if g.cfg.PublishDelete {
+		args = append(args, "--delete")
+	}
+	if g.cfg.PublishDryRun {
+		args = append(args, "--dryrun")
+	}
+	return exec.CommandContext(g.ctx, "aws", args...)
+}
+
+func (g *geoIPGenerator) gcsSync(target, ext string) *exec.Cmd {
+	args := []string{"storage", "rsync", g.cfg.OutputDir, target, "--recursive",
+		// gcloud only has excludes, skip every object without the extension
+		"--exclude", ".*(?<!" + regexp.QuoteMeta(ext) + ")$",
+		"--content-type", contentType(ext)}
+	if g.cfg.PublishCacheControl != "" {
+		args = append(args, "--cache-control", g.cfg.PublishCacheControl)
+	}
+	if g.cfg.PublishDelete {
+		args = append(args, "--delete-unmatched-destination-objects")
+	}
+	if g.cfg.PublishDryRun {
+		args = append(args, "--dry-run")
+	}
+	return exec.CommandContext(g.ctx, "gcloud", args...)
+}
+
+func (g *geoIPGenerator) azureCopy(target, ext string) (*exec.Cmd, error) {
+	u, err := azureURL(target)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"copy", filepath.Join(g.cfg.OutputDir, "*"), u, "--recursive",
+		"--include-pattern", "*" + ext,
+		"--content-type", contentType(ext),
+		"--put-md5"}
+	if g.cfg.PublishCacheControl != "" {
+		args = append(args, "--cache-control", g.cfg.PublishCacheControl)
+	}
+	if g.cfg.PublishDryRun {
+		args = append(args, "--dry-run")
+	}
+	return exec.CommandContext(g.ctx, "azcopy", args...), nil
+}
+
+// azureURL maps az://account/container/prefix to the blob endpoint URL.
+func azureURL(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return "", fmt.Errorf("azure target must look like az://account/container/prefix")
+	}
+	return fmt.Sprintf("https://%s.blob.core.windows.net%s", u.Host, u.Path), nil
+}
+
+// outputExtensions returns the distinct file extensions of the outputs.
+func outputExtensions(files []string) []string {
+	seen := make(map[string]bool)
+	var exts []string
+	for _, file := range files {
+		ext := path.Ext(file)
+		if !seen[ext] {
+			seen[ext] = true
+			exts = append(exts, ext)
+		}
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+func contentType(ext string) string {
+	switch ext {
+	case ".nft":
+		return "text/plain; charset=utf-8"
+	case ".json":
+		return "application/json"
+	case ".csv":
+		return "text/csv; charset=utf-8"
+	case ".minisig":
+		return "text/plain; charset=utf-8"
+	case ".asc":
+		return "application/pgp-signature"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
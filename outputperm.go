@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// outputOwner is the user and group of the outputs, -1 where -owner
+// leaves them unchanged.
+type outputOwner struct {
+	uid, gid int
+}
+
+// parseOwner resolves -owner, a user, user:group or :group by name or
+// numeric id like chown.
+func parseOwner(s string) (outputOwner, error) {
+	owner := outputOwner{uid: -1, gid: -1}
+	if s == "" {
+		return owner, nil
+	}
+	name, group, _ := strings.Cut(s, ":")
+	if name != "" {
+		id, err := strconv.Atoi(name)
+		if err != nil {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return owner, fmt.Errorf("invalid -owner %q: %w", s, err)
+			}
+			id, _ = strconv.Atoi(u.Uid)
+		}
+		owner.uid = id
+	}
+	if group != "" {
+		id, err := strconv.Atoi(group)
+		if err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return owner, fmt.Errorf("invalid -owner %q: %w", s, err)
+			}
+			id, _ = strconv.Atoi(g.Gid)
+		}
+		owner.gid = id
+	}
+	return owner, nil
+}
+
+func (o outputOwner) set() bool {
+	return o.uid != -1 || o.gid != -1
+}
+
+// outputFileMode returns the mode of the generated files and whether it
+// is exact. Without -file-mode and -umask the files get filePermissions
+// reduced by the umask of the process.
+func (c config) outputFileMode() (fs.FileMode, bool) {
+	if !c.FileMode.set && !c.Umask.set {
+		return filePermissions, false
+	}
+	return c.FileMode.or(filePermissions) &^ c.Umask.mode, true
+}
+
+// outputDirMode is outputFileMode for the directories and -dir-mode.
+func (c config) outputDirMode() (fs.FileMode, bool) {
+	if !c.DirMode.set && !c.Umask.set {
+		return dirPermissions, false
+	}
+	return c.DirMode.or(dirPermissions) &^ c.Umask.mode, true
+}
+
+// writeOutput writes a generated file atomically with the output mode and
+// owner, so that it is never readable by the wrong users.
+func (g *geoIPGenerator) writeOutput(filename string, render func(w io.Writer) error) error {
+	perm, exact := g.cfg.outputFileMode()
+	return geonft.WriteFileAttrs(filename, geonft.FileAttrs{Perm: perm, Exact: exact, UID: g.owner.uid, GID: g.owner.gid}, render)
+}
+
+// writeOutputData is writeOutput for data already in memory.
+func (g *geoIPGenerator) writeOutputData(filename string, data []byte) error {
+	return g.writeOutput(filename, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// copyOutput copies src to dst like a generated file, creating the
+// directories on the way.
+func (g *geoIPGenerator) copyOutput(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := g.makeOutputDir(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	return g.writeOutput(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// makeOutputDir creates dir. With -dir-mode, -umask or -owner it is given
+// the output directory mode or owner also when it existed before, without
+// them existing directories are left alone.
+func (g *geoIPGenerator) makeOutputDir(dir string) error {
+	mode, exact := g.cfg.outputDirMode()
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	if exact {
+		// MkdirAll applies the umask of the process
+		if err := os.Chmod(dir, mode); err != nil {
+			return err
+		}
+	}
+	if g.owner.set() {
+		return os.Lchown(dir, g.owner.uid, g.owner.gid)
+	}
+	return nil
+}
+
+// adoptOutput gives a file written by another program, like a signature,
+// the exact output mode and the owner when they are set.
+func (g *geoIPGenerator) adoptOutput(path string) error {
+	if mode, exact := g.cfg.outputFileMode(); exact {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	if g.owner.set() {
+		return os.Lchown(path, g.owner.uid, g.owner.gid)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kkrow/maxminddb-to-nft/internal/mmdbfixture"
+)
+
+// TestOutputModes checks that the files besides the sets, like the
+// -incremental manifest and the metrics textfile, get the configured
+// modes as well.
+func TestOutputModes(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "fixture.mmdb")
+	writeFixture(t, input, mmdbfixture.Options{})
+	out := filepath.Join(dir, "out")
+	metrics := filepath.Join(dir, "metrics")
+	if err := os.Mkdir(metrics, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{
+		"-input", input, "-output-dir", out, "-file-mode", "0640", "-dir-mode", "0750",
+		"-incremental", "-textfile-dir", metrics, "-state-file", filepath.Join(dir, "state.json.gz"),
+		"-diff-file", filepath.Join(dir, "diff.json"), "-skip-report", filepath.Join(dir, "skipped.csv"),
+		"-summary-file", filepath.Join(dir, "summary.json"),
+	}
+	cfg, err := parseFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second run writes the diff against the state of the first
+	for range 2 {
+		g := newGeoIPGenerator(t.Context(), cfg)
+		start := time.Now()
+		err := g.run()
+		g.report(start, err)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, want := range map[string]os.FileMode{
+		filepath.Join(out, incrementalFile):    0o640,
+		filepath.Join(out, "geoip_ipv4.nft"):   0o640,
+		filepath.Join(metrics, textfileName):   0o640,
+		filepath.Join(dir, "state.json.gz"):    0o640,
+		filepath.Join(dir, "diff.json"):        0o640,
+		filepath.Join(dir, "skipped.csv"):      0o640,
+		filepath.Join(dir, "summary.json"):     0o640,
+		filepath.Join(out, "by_country"):       0o750 | os.ModeDir,
+		filepath.Join(out, "by_country", "DE"): 0o750 | os.ModeDir,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := info.Mode(); got != want {
+			t.Errorf("%s: mode = %v, want %v", filepath.Base(path), got, want)
+		}
+	}
+}
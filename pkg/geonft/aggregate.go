@@ -0,0 +1,46 @@
+package geonft
+
+import "net/netip"
+
+// Aggregator transforms the loaded sets before they are rendered.
+type Aggregator interface {
+	Aggregate(data *Dataset) error
+}
+
+// AggregatorFunc adapts a function to an Aggregator.
+type AggregatorFunc func(data *Dataset) error
+
+func (f AggregatorFunc) Aggregate(data *Dataset) error { return f(data) }
+
+// MergeOverlaps sorts every set and removes the prefixes contained in
+// another prefix of the set, which IPv4-mapped networks of IPv6 databases
+// may duplicate.
+var MergeOverlaps = AggregatorFunc(func(data *Dataset) error {
+	for _, sets := range []Sets{data.IPv4, data.IPv6} {
+		for name, prefixes := range sets {
+			sets[name] = PackPrefixes(MergePrefixes(prefixes.Unpack()))
+		}
+	}
+	return nil
+})
+
+// Exclude removes the given prefixes from every set, for example reserved
+// ranges.
+type Exclude []netip.Prefix
+
+func (e Exclude) Aggregate(data *Dataset) error {
+	holes := MergePrefixes(e)
+	data.IPv4.Subtract(holes)
+	data.IPv6.Subtract(holes)
+	return nil
+}
+
+// Within limits every set to the given prefixes.
+type Within []netip.Prefix
+
+func (w Within) Aggregate(data *Dataset) error {
+	within := MergePrefixes(w)
+	data.IPv4.Intersect(within)
+	data.IPv6.Intersect(within)
+	return nil
+}
@@ -0,0 +1,19 @@
+// Package geonft converts MaxMind format databases (GeoLite2, DB-IP,
+// ipinfo) into nftables sets of networks per country. It is the engine of
+// the maxminddb-to-nft command and lets other programs embed the
+// conversion without running the command.
+//
+// A Pipeline chains the steps:
+//
+//   - a Source opens the database, FileSource and URLSource are provided
+//   - a Loader reads its networks into a Dataset of packed PrefixList sets
+//   - Aggregators transform the sets, like MergeOverlaps, Exclude and
+//     Within
+//   - OutputFormats render the files, NFT writes nft scripts
+//   - a Publisher delivers them, Dir writes them to a directory
+//
+// Each step is an interface, so a controller can for example keep the
+// rendered files in memory or push them to a remote store. The prefix
+// helpers like MergePrefixes and SubtractPrefixes work on plain
+// netip.Prefix slices and are usable on their own.
+package geonft
@@ -0,0 +1,88 @@
+package geonft_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+
+	"github.com/kkrow/maxminddb-to-nft/internal/mmdbfixture"
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// stdout publishes the files by printing their paths and the global set
+// file.
+type stdout struct{}
+
+func (stdout) Publish(ctx context.Context, files []geonft.File) error {
+	for _, f := range files {
+		fmt.Println(f.Path)
+		if f.Path != "geoip_ipv4.nft" {
+			continue
+		}
+		if err := f.Render(os.Stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ExamplePipeline() {
+	dir, err := os.MkdirTemp("", "geonft")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.mmdb")
+	if err := writeFixture(path); err != nil {
+		log.Fatal(err)
+	}
+
+	p := geonft.Pipeline{
+		Source: geonft.FileSource{Path: path},
+		Loader: &geonft.Loader{IPv4: true},
+		Aggregators: []geonft.Aggregator{
+			geonft.MergeOverlaps,
+			geonft.Within{netip.MustParsePrefix("1.0.0.0/8"), netip.MustParsePrefix("2.0.0.0/8")},
+		},
+		Formats:   []geonft.OutputFormat{geonft.NFT{}},
+		Publisher: stdout{},
+	}
+	if _, err := p.Run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// geoip_ipv4.nft
+	// #!/usr/sbin/nft -f
+	// table inet geoip {
+	//     set AU {
+	//         type ipv4_addr
+	//         flags interval
+	//         elements = { 1.0.0.0/24 }
+	//     }
+	//     set CN {
+	//         type ipv4_addr
+	//         flags interval
+	//         elements = { 1.0.1.0/24 }
+	//     }
+	//     set FR {
+	//         type ipv4_addr
+	//         flags interval
+	//         elements = { 2.0.0.0/15 }
+	//     }
+	// }
+	// by_country/AU/AU_ipv4.nft
+	// by_country/CN/CN_ipv4.nft
+	// by_country/FR/FR_ipv4.nft
+}
+
+func writeFixture(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return mmdbfixture.Write(f, mmdbfixture.Options{BuildEpoch: 1700000000})
+}
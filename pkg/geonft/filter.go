@@ -0,0 +1,76 @@
+package geonft
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// Filter selects networks with an expr expression
+// (https://expr-lang.org) like
+//
+//	record.country.iso_code in ["RU", "CN"] || prefix.bits <= 16
+//
+// The expression sees the decoded database record as record, the network
+// as prefix with the fields addr, bits and family ("ipv4" or "ipv6"), and
+// the set the network goes to as code. Optional record fields are best
+// accessed with ?., e.g. record.represented_country?.iso_code. A Filter is
+// safe for concurrent use.
+type Filter struct {
+	program *vm.Program
+	// Decoding the whole record is skipped when the expression does not
+	// use it
+	record bool
+}
+
+type filterEnv struct {
+	Record map[string]any `expr:"record"`
+	Prefix filterPrefix   `expr:"prefix"`
+	Code   string         `expr:"code"`
+}
+
+type filterPrefix struct {
+	Addr   string `expr:"addr"`
+	Bits   int    `expr:"bits"`
+	Family string `expr:"family"`
+}
+
+// CompileFilter compiles the expression src, which must yield a bool.
+func CompileFilter(src string) (*Filter, error) {
+	program, err := expr.Compile(src, expr.Env(filterEnv{}), expr.AsBool())
+	if err != nil {
+		return nil, err
+	}
+	uses := ast.Find(program.Node(), func(n ast.Node) bool {
+		id, ok := n.(*ast.IdentifierNode)
+		return ok && id.Value == "record"
+	})
+	return &Filter{program: program, record: uses != nil}, nil
+}
+
+// Match reports whether the network prefix with the record result, going
+// to the set code, is kept.
+func (f *Filter) Match(prefix netip.Prefix, result maxminddb.Result, code string) (bool, error) {
+	env := filterEnv{
+		Prefix: filterPrefix{Addr: prefix.Addr().String(), Bits: prefix.Bits(), Family: "ipv6"},
+		Code:   code,
+	}
+	if prefix.Addr().Is4() {
+		env.Prefix.Family = "ipv4"
+	}
+	if f.record {
+		if err := result.Decode(&env.Record); err != nil {
+			return false, err
+		}
+	}
+
+	out, err := expr.Run(f.program, env)
+	if err != nil {
+		return false, fmt.Errorf("evaluating filter: %w", err)
+	}
+	return out.(bool), nil
+}
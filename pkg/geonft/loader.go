@@ -0,0 +1,278 @@
+package geonft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// Prefix lengths the address space is split at for the parallel load
+	shardBitsIPv4 = 6
+	shardBitsIPv6 = 8
+	// Networks read between two checks for a cancelled context
+	cancelCheckInterval = 1 << 12
+)
+
+var (
+	allIPv4 = netip.MustParsePrefix("0.0.0.0/0")
+	allIPv6 = netip.MustParsePrefix("::/0")
+	// IPv6 databases keep the IPv4 space in the ::/96 subtree and usually
+	// alias it at ::ffff:0:0/96, some store IPv4-mapped networks there
+	ipv4Subtree = netip.MustParsePrefix("::/96")
+	// IPv4Mapped is the scope of the IPv4-mapped networks of IPv6 databases
+	IPv4Mapped = netip.MustParsePrefix("::ffff:0:0/96")
+)
+
+// Scopes returns the parts of db holding the selected address families,
+// in address order, so that the other family is not traversed at all.
+// With within they are narrowed down to the given prefixes, which must be
+// sorted, non-overlapping and unmapped.
+func Scopes(db *maxminddb.Reader, ipv4, ipv6 bool, within []netip.Prefix) []netip.Prefix {
+	var scopes []netip.Prefix
+	if ipv4 {
+		scopes = append(scopes, allIPv4)
+		if db.Metadata.IPVersion == 6 {
+			scopes = append(scopes, IPv4Mapped)
+		}
+	}
+	if ipv6 && db.Metadata.IPVersion == 6 {
+		scopes = append(scopes, SubtractPrefixes(allIPv6, []netip.Prefix{ipv4Subtree, IPv4Mapped})...)
+	}
+
+	if within == nil {
+		return scopes
+	}
+	// The mapped IPv4 scope is matched against the mapped prefixes
+	var mapped []netip.Prefix
+	for _, w := range within {
+		if w.Addr().Is4() {
+			mapped = append(mapped, MapPrefix(w))
+		}
+	}
+	var narrowed []netip.Prefix
+	for _, scope := range scopes {
+		if scope == IPv4Mapped {
+			narrowed = append(narrowed, IntersectPrefixes([]netip.Prefix{scope}, mapped)...)
+			continue
+		}
+		narrowed = append(narrowed, IntersectPrefixes([]netip.Prefix{scope}, within)...)
+	}
+	return narrowed
+}
+
+// Shards splits scope into parts of the address space that can be loaded
+// concurrently.
+func Shards(scope netip.Prefix) []netip.Prefix {
+	bits := shardBitsIPv6
+	if scope.Addr().Is4() {
+		bits = shardBitsIPv4
+	}
+	return SplitPrefix(scope, bits)
+}
+
+// Networks iterates over the networks of db within shard, a part of scope,
+// with the prefix each one is loaded as. A network containing the whole
+// scope is cut down to the scope. Mapped prefixes are returned as they are.
+func Networks(db *maxminddb.Reader, scope, shard netip.Prefix) iter.Seq2[netip.Prefix, maxminddb.Result] {
+	return func(yield func(netip.Prefix, maxminddb.Result) bool) {
+		for result := range db.NetworksWithin(shard) {
+			prefix := result.Prefix()
+			if result.Err() == nil && prefix.Bits() < scope.Bits() && prefix.Contains(scope.Addr()) {
+				prefix = scope
+			}
+			// A network containing the whole shard is returned by every
+			// shard it covers, only the one at its start keeps it. Results
+			// of the IPv4 subtree come in the IPv4 family and belong to the
+			// IPv4 shards.
+			if result.Err() == nil && !shard.Contains(prefix.Addr()) {
+				continue
+			}
+			if !yield(prefix, result) {
+				return
+			}
+		}
+	}
+}
+
+// Reasons a network is skipped, see Visitor
+const (
+	SkipDecodeError = "decode_error"
+	SkipEmptyCode   = "empty_code"
+	SkipInvalidCode = "invalid_code"
+	SkipFiltered    = "filtered"
+)
+
+// ErrStopShard can be returned by a Visitor to end the shard early
+// without failing the load.
+var ErrStopShard = errors.New("stop shard")
+
+// Visitor receives the networks of a shard as LoadShard classifies them.
+type Visitor interface {
+	// Network receives a network of the set code, unmapped
+	Network(prefix netip.Prefix, result maxminddb.Result, code string) error
+	// Skip receives a network left out for reason. detail is the country
+	// code or the error text, err the decode or filter error.
+	Skip(prefix netip.Prefix, reason, detail string, err error) error
+}
+
+// Loader reads the networks of a database into country sets.
+type Loader struct {
+	// Schema is detected from the database when its Name is empty
+	Schema Schema
+	// Represented is the represented country precedence, RepresentedIgnore
+	// when empty
+	Represented string
+	// IPv4 and IPv6 select the address families, both when neither is set
+	IPv4, IPv6 bool
+	// Within limits the load to the given prefixes, see Scopes
+	Within []netip.Prefix
+	// UnknownSet receives the networks without country, they are skipped
+	// when empty
+	UnknownSet string
+	// Accept filters the country codes, ValidCountryCode when nil
+	Accept func(code string) bool
+	// Filter selects the networks after Accept, networks it fails on are
+	// skipped
+	Filter *Filter
+	// Workers is the number of shards loaded concurrently, one when zero
+	Workers int
+}
+
+// Load returns the sets of db, the sets of a family not selected are nil.
+// Records that fail to decode are skipped.
+func (l *Loader) Load(ctx context.Context, db *maxminddb.Reader) (*Dataset, error) {
+	loader := *l
+	if loader.Schema.Name == "" {
+		var err error
+		if loader.Schema, err = DetectSchema(db, SchemaAuto, ""); err != nil {
+			return nil, fmt.Errorf("detecting record schema: %w", err)
+		}
+	}
+
+	type shard struct {
+		scope, within netip.Prefix
+		data          datasetVisitor
+	}
+	var shards []*shard
+	ipv4, ipv6 := l.IPv4 || !l.IPv6, l.IPv6 || !l.IPv4
+	for _, scope := range Scopes(db, ipv4, ipv6, l.Within) {
+		for _, p := range Shards(scope) {
+			shards = append(shards, &shard{scope: scope, within: p, data: datasetVisitor{NewDataset()}})
+		}
+	}
+
+	var group errgroup.Group
+	group.SetLimit(max(l.Workers, 1))
+	for _, s := range shards {
+		group.Go(func() error {
+			_, err := loader.LoadShard(ctx, db, s.scope, s.within, s.data)
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Shards are merged in address order. IPv4-mapped networks follow the
+	// native IPv4 ones, MergeOverlaps sorts them in.
+	data := NewDataset()
+	if !ipv4 {
+		data.IPv4 = nil
+	}
+	if !ipv6 {
+		data.IPv6 = nil
+	}
+	for _, s := range shards {
+		data.IPv4.Merge(s.data.IPv4)
+		data.IPv6.Merge(s.data.IPv6)
+	}
+	return data, nil
+}
+
+// LoadShard reads the networks of db within shard, a part of scope, and
+// passes each one to v as accepted or skipped. The Schema must be set. It
+// stops at the first error of v and returns the number of IPv4-mapped
+// networks read.
+func (l *Loader) LoadShard(ctx context.Context, db *maxminddb.Reader, scope, shard netip.Prefix, v Visitor) (mapped int, err error) {
+	represented := l.Represented
+	if represented == "" {
+		represented = RepresentedIgnore
+	}
+	accept := l.Accept
+	if accept == nil {
+		accept = ValidCountryCode
+	}
+
+	var read int
+	for prefix, result := range Networks(db, scope, shard) {
+		if read++; read%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return mapped, err
+			}
+		}
+
+		code, err := l.Schema.CountryCode(result, represented)
+		if err != nil {
+			err = v.Skip(prefix, SkipDecodeError, err.Error(), err)
+		} else {
+			// Databases may store the IPv4 tree under ::ffff:0:0/96
+			pfx := UnmapPrefix(prefix)
+			if pfx != prefix {
+				mapped++
+			}
+			err = l.visit(v, pfx, result, code, accept)
+		}
+		if errors.Is(err, ErrStopShard) {
+			return mapped, nil
+		}
+		if err != nil {
+			return mapped, err
+		}
+	}
+	return mapped, ctx.Err()
+}
+
+func (l *Loader) visit(v Visitor, prefix netip.Prefix, result maxminddb.Result, code string, accept func(string) bool) error {
+	switch {
+	case code == "":
+		// Unattributed space is only kept when explicitly requested
+		if l.UnknownSet == "" {
+			return v.Skip(prefix, SkipEmptyCode, "", nil)
+		}
+		code = l.UnknownSet
+	case !accept(code):
+		return v.Skip(prefix, SkipInvalidCode, code, nil)
+	}
+
+	if l.Filter != nil {
+		ok, err := l.Filter.Match(prefix, result, code)
+		if err != nil {
+			return v.Skip(prefix, SkipDecodeError, err.Error(), err)
+		}
+		if !ok {
+			return v.Skip(prefix, SkipFiltered, code, nil)
+		}
+	}
+	return v.Network(prefix, result, code)
+}
+
+// datasetVisitor adds the networks to a dataset and ignores the skipped
+// ones.
+type datasetVisitor struct {
+	*Dataset
+}
+
+func (d datasetVisitor) Network(prefix netip.Prefix, _ maxminddb.Result, code string) error {
+	d.Add(code, prefix)
+	return nil
+}
+
+func (d datasetVisitor) Skip(netip.Prefix, string, string, error) error {
+	return nil
+}
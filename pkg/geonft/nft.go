@@ -0,0 +1,193 @@
+package geonft
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+)
+
+// DefaultTable is the nft table holding the sets, of the DefaultFamily.
+const (
+	DefaultTable  = "geoip"
+	DefaultFamily = "inet"
+)
+
+// File is one output file of a format.
+type File struct {
+	// Path is relative to the directory the files are published to
+	Path   string
+	Render func(w io.Writer) error
+}
+
+// OutputFormat renders a dataset into files.
+type OutputFormat interface {
+	Files(data *Dataset) []File
+}
+
+// NFT renders nftables scripts: geoip_ipv4.nft and geoip_ipv6.nft with
+// every set of the family, and by_country/<code>/<code>_<family>.nft with
+// a single set. A family whose Sets are nil is left out.
+type NFT struct {
+	// Table defaults to DefaultTable, Family to DefaultFamily
+	Table  string
+	Family string
+	// NoTable writes the bare sets without the table around them, for
+	// including them inside a table block of another file
+	NoTable bool
+	// Comment returns the comment written above a set, none when nil or
+	// empty
+	Comment func(name string) string
+	// AutoMerge lets nft merge overlapping elements added to the sets
+	// later, which needs nft 0.9.0 or later
+	AutoMerge bool
+}
+
+type familySets struct {
+	sets   Sets
+	family string
+}
+
+func (f NFT) Files(data *Dataset) []File {
+	families := []familySets{{data.IPv4, "ipv4"}, {data.IPv6, "ipv6"}}
+	families = slices.DeleteFunc(families, func(fam familySets) bool { return fam.sets == nil })
+
+	var files []File
+	for _, fam := range families {
+		files = append(files, File{
+			Path: fmt.Sprintf("geoip_%s.nft", fam.family),
+			Render: func(w io.Writer) error {
+				return f.writeTable(w, func(w io.Writer) error {
+					for _, name := range fam.sets.Names() {
+						if err := f.writeSet(w, name, fam.sets[name], fam.family); err != nil {
+							return fmt.Errorf("writing NFT set for %s: %w", name, err)
+						}
+					}
+					return nil
+				})
+			},
+		})
+	}
+	for _, fam := range families {
+		for _, name := range fam.sets.Names() {
+			prefixes := fam.sets[name]
+			if prefixes.Len() == 0 {
+				continue
+			}
+			files = append(files, File{
+				Path: filepath.Join("by_country", name, fmt.Sprintf("%s_%s.nft", name, fam.family)),
+				Render: func(w io.Writer) error {
+					return f.writeTable(w, func(w io.Writer) error {
+						return f.writeSet(w, name, prefixes, fam.family)
+					})
+				},
+			})
+		}
+	}
+	return files
+}
+
+func (f NFT) writeTable(w io.Writer, sets func(w io.Writer) error) error {
+	if f.NoTable {
+		return sets(w)
+	}
+	table, family := f.Table, f.Family
+	if table == "" {
+		table = DefaultTable
+	}
+	if family == "" {
+		family = DefaultFamily
+	}
+	return WriteNFTTable(w, family, table, sets)
+}
+
+func (f NFT) writeSet(w io.Writer, name string, prefixes *PrefixList, family string) error {
+	if prefixes.Len() == 0 {
+		return nil
+	}
+	opts := SetOptions{AutoMerge: f.AutoMerge}
+	if f.Comment != nil {
+		opts.Comment = f.Comment(name)
+	}
+	return WriteNFTSet(w, name, family, opts, prefixes)
+}
+
+// WriteNFTTable wraps the sets written by sets in the table of the
+// family, like "inet" or "ip".
+func WriteNFTTable(w io.Writer, family, table string, sets func(w io.Writer) error) error {
+	fmt.Fprintln(w, "#!/usr/sbin/nft -f")
+	fmt.Fprintf(w, "table %s %s {\n", family, table)
+
+	if err := sets(w); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "}")
+	return nil
+}
+
+// SetOptions adjusts how a set is written.
+type SetOptions struct {
+	// Comment is written above the set unless it is empty
+	Comment string
+	// AutoMerge adds the auto-merge flag, see NFT
+	AutoMerge bool
+}
+
+// WriteNFTSet writes the interval set name of the family, "ipv4" or
+// "ipv6".
+func WriteNFTSet(w io.Writer, name, family string, opts SetOptions, prefixes *PrefixList) error {
+	return WriteNFTSetWith(w, name, family, opts, func(w io.Writer) error {
+		return WriteElements(w, prefixes)
+	})
+}
+
+// WriteNFTSetWith is WriteNFTSet with the comma separated elements written
+// by elements.
+func WriteNFTSetWith(w io.Writer, name, family string, opts SetOptions, elements func(w io.Writer) error) error {
+	if opts.Comment != "" {
+		io.WriteString(w, "    # "+opts.Comment+"\n")
+	}
+	io.WriteString(w, "    set "+name+" {\n")
+	for _, statement := range SetStatements(family, opts) {
+		io.WriteString(w, "        "+statement+"\n")
+	}
+	io.WriteString(w, "        elements = { ")
+
+	if err := elements(w); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, " }\n    }\n")
+	return err
+}
+
+// SetStatements returns the statements declaring an interval set of the
+// family besides its elements, like "type ipv4_addr" and "flags interval".
+// Joined with "; " they declare the set on one line, for example in
+// "add set".
+func SetStatements(family string, opts SetOptions) []string {
+	statements := []string{"type " + family + "_addr", "flags interval"}
+	if opts.AutoMerge {
+		statements = append(statements, "auto-merge")
+	}
+	return statements
+}
+
+// WriteElements writes the prefixes separated by commas.
+func WriteElements(w io.Writer, prefixes *PrefixList) error {
+	// Render into one reused buffer instead of a string per element,
+	// large enough for the longest IPv6 prefix
+	buf := make([]byte, 0, 64)
+	for i := range prefixes.Len() {
+		buf = buf[:0]
+		if i > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = prefixes.At(i).AppendTo(buf)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
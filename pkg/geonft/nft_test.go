@@ -0,0 +1,108 @@
+package geonft
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// benchmarkSet returns a set of n adjacent prefixes of the family.
+func benchmarkSet(n int, ipv6 bool) *PrefixList {
+	l := &PrefixList{}
+	for i := range n {
+		if ipv6 {
+			addr := netip.AddrFrom16([16]byte{0x2a, 0x00, byte(i >> 16), byte(i >> 8), byte(i)})
+			l.Add(netip.PrefixFrom(addr, 40))
+			continue
+		}
+		addr := netip.AddrFrom4([4]byte{byte(i >> 16), byte(i >> 8), byte(i), 0})
+		l.Add(netip.PrefixFrom(addr, 24))
+	}
+	return l
+}
+
+func BenchmarkWriteNFTSet(b *testing.B) {
+	for _, bc := range []struct {
+		family string
+		set    *PrefixList
+	}{
+		{"ipv4", benchmarkSet(100_000, false)},
+		{"ipv6", benchmarkSet(100_000, true)},
+	} {
+		w := bufio.NewWriterSize(io.Discard, writeBufferSize)
+
+		b.Run(bc.family, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := WriteNFTSet(w, "DE", bc.family, SetOptions{}, bc.set); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		// The former rendering, a string per element joined into one
+		// string per set, for comparison
+		b.Run(bc.family+"_joined", func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				elements := make([]string, 0, bc.set.Len())
+				for p := range bc.set.All() {
+					elements = append(elements, p.String())
+				}
+				fmt.Fprintf(w, "    set DE {\n        type %s_addr\n        flags interval\n        elements = { %s }\n    }\n",
+					bc.family, strings.Join(elements, ", "))
+			}
+		})
+	}
+}
+
+func TestWriteNFTSet(t *testing.T) {
+	var l PrefixList
+	l.Add(netip.MustParsePrefix("1.0.0.0/24"))
+	l.Add(netip.MustParsePrefix("2.0.0.0/15"))
+
+	var out strings.Builder
+	if err := WriteNFTSet(&out, "AU", "ipv4", SetOptions{}, &l); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "    set AU {\n        type ipv4_addr\n        flags interval\n        elements = { 1.0.0.0/24, 2.0.0.0/15 }\n    }\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestWriteNFTJSON(t *testing.T) {
+	var l PrefixList
+	l.Add(netip.MustParsePrefix("1.0.0.0/24"))
+	l.Add(netip.MustParsePrefix("2.0.0.0/15"))
+
+	var out strings.Builder
+	table := NFTTable{Family: "inet", Name: "geoip"}
+	err := WriteNFTJSON(&out, table, func(w io.Writer) error {
+		return WriteNFTJSONSet(w, table, "AU", "ipv4", SetOptions{AutoMerge: true}, &l)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ruleset struct {
+		Nftables []map[string]json.RawMessage `json:"nftables"`
+	}
+	if err := json.Unmarshal([]byte(out.String()), &ruleset); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if len(ruleset.Nftables) != 3 {
+		t.Fatalf("got %d objects, want metainfo, table and set", len(ruleset.Nftables))
+	}
+
+	want := `{"family": "inet", "table": "geoip", "name": "AU", "type": "ipv4_addr", "flags": ["interval"], "auto-merge": true, ` +
+		`"elem": [{"prefix": {"addr": "1.0.0.0", "len": 24}}, {"prefix": {"addr": "2.0.0.0", "len": 15}}]}`
+	if got := string(ruleset.Nftables[2]["set"]); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package geonft
+
+import (
+	"encoding/json"
+	"io"
+	"net/netip"
+	"strconv"
+)
+
+// NFTTable names the table a set of the JSON format belongs to, whose
+// objects carry their table instead of being nested in it.
+type NFTTable struct {
+	// Family like "inet" or "ip"
+	Family string
+	Name   string
+}
+
+// WriteNFTJSON writes a ruleset in the JSON format of `nft -j -f`: the
+// metainfo, the table and the sets written by sets, each of which starts
+// with a comma.
+func WriteNFTJSON(w io.Writer, table NFTTable, sets func(w io.Writer) error) error {
+	io.WriteString(w, "{\"nftables\": [\n{\"metainfo\": {\"json_schema_version\": 1}},\n")
+	io.WriteString(w, "{\"table\": {\"family\": "+jsonString(table.Family)+", \"name\": "+jsonString(table.Name)+"}}")
+
+	if err := sets(w); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n]}\n")
+	return err
+}
+
+// WriteNFTJSONSet writes the interval set name of the family, "ipv4" or
+// "ipv6", as an object of the ruleset written by WriteNFTJSON. The JSON
+// format has no comments, opts.Comment is left out.
+func WriteNFTJSONSet(w io.Writer, table NFTTable, name, family string, opts SetOptions, prefixes *PrefixList) error {
+	return WriteNFTJSONSetWith(w, table, name, family, opts, func(w io.Writer) error {
+		return WriteJSONElements(w, prefixes)
+	})
+}
+
+// WriteNFTJSONSetWith is WriteNFTJSONSet with the comma separated elements
+// written by elements.
+func WriteNFTJSONSetWith(w io.Writer, table NFTTable, name, family string, opts SetOptions, elements func(w io.Writer) error) error {
+	io.WriteString(w, ",\n{\"set\": {\"family\": "+jsonString(table.Family)+", \"table\": "+jsonString(table.Name)+
+		", \"name\": "+jsonString(name)+", \"type\": \""+family+"_addr\", \"flags\": [\"interval\"]")
+	if opts.AutoMerge {
+		io.WriteString(w, ", \"auto-merge\": true")
+	}
+	io.WriteString(w, ", \"elem\": [")
+
+	if err := elements(w); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "]}}")
+	return err
+}
+
+// WriteJSONElements writes the prefixes as comma separated elements of the
+// JSON format.
+func WriteJSONElements(w io.Writer, prefixes *PrefixList) error {
+	buf := make([]byte, 0, 96)
+	for i := range prefixes.Len() {
+		buf = buf[:0]
+		if i > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = AppendJSONElement(buf, prefixes.At(i))
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppendJSONElement appends p as an element of the JSON format, like
+// {"prefix": {"addr": "192.0.2.0", "len": 24}}.
+func AppendJSONElement(b []byte, p netip.Prefix) []byte {
+	b = append(b, `{"prefix": {"addr": "`...)
+	b = p.Addr().AppendTo(b)
+	b = append(b, `", "len": `...)
+	b = strconv.AppendInt(b, int64(p.Bits()), 10)
+	return append(b, "}}"...)
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
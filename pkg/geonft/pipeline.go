@@ -0,0 +1,54 @@
+package geonft
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pipeline converts a database into nftables sets: the Source is opened,
+// the Loader reads its networks, the Aggregators run in order and the
+// files of every format go to the Publisher. Without a Publisher the
+// sets are only returned.
+type Pipeline struct {
+	Source      Source
+	Loader      *Loader
+	Aggregators []Aggregator
+	Formats     []OutputFormat
+	Publisher   Publisher
+}
+
+// Run executes the pipeline once and returns the sets it published.
+func (p *Pipeline) Run(ctx context.Context) (*Dataset, error) {
+	db, err := p.Source.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	loader := p.Loader
+	if loader == nil {
+		loader = &Loader{}
+	}
+	data, err := loader.Load(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("loading networks: %w", err)
+	}
+
+	for _, a := range p.Aggregators {
+		if err := a.Aggregate(data); err != nil {
+			return nil, fmt.Errorf("aggregating sets: %w", err)
+		}
+	}
+
+	if p.Publisher == nil {
+		return data, nil
+	}
+	var files []File
+	for _, f := range p.Formats {
+		files = append(files, f.Files(data)...)
+	}
+	if err := p.Publisher.Publish(ctx, files); err != nil {
+		return nil, fmt.Errorf("publishing: %w", err)
+	}
+	return data, nil
+}
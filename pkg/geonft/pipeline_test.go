@@ -0,0 +1,112 @@
+package geonft_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// minPrefix drops the prefixes broader than the -min-prefix-ipv4 and
+// -min-prefix-ipv6 defaults of the command.
+var minPrefix = geonft.AggregatorFunc(func(data *geonft.Dataset) error {
+	for _, family := range []struct {
+		sets geonft.Sets
+		bits int
+	}{{data.IPv4, 8}, {data.IPv6, 12}} {
+		for code, prefixes := range family.sets {
+			kept := &geonft.PrefixList{}
+			for p := range prefixes.All() {
+				if p.Bits() >= family.bits {
+					kept.Add(p)
+				}
+			}
+			family.sets[code] = kept
+		}
+	}
+	return nil
+})
+
+// TestPipelineGolden checks that the library writes the same files as the
+// command with its default options.
+func TestPipelineGolden(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.mmdb")
+	if err := writeFixture(path); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+
+	p := geonft.Pipeline{
+		Source:      geonft.FileSource{Path: path},
+		Loader:      &geonft.Loader{Workers: 4},
+		Aggregators: []geonft.Aggregator{geonft.MergeOverlaps, minPrefix},
+		Formats:     []geonft.OutputFormat{geonft.NFT{}},
+		Publisher:   geonft.Dir{Path: out},
+	}
+	if _, err := p.Run(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("..", "..", "testdata", "golden", "geolite2")
+	got, want := listFiles(t, out), listFiles(t, golden)
+	if !slices.Equal(got, want) {
+		t.Fatalf("files differ from the command\ngot:  %v\nwant: %v", got, want)
+	}
+	for _, name := range got {
+		gotData, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantData, err := os.ReadFile(filepath.Join(golden, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(gotData) != string(wantData) {
+			t.Errorf("%s differs from the command\ngot:\n%s\nwant:\n%s", name, gotData, wantData)
+		}
+	}
+}
+
+// listFiles returns the sorted paths of the files below dir, relative to
+// dir.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		names = append(names, filepath.ToSlash(name))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestPipelineWithoutPublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := writeFixture(path); err != nil {
+		t.Fatal(err)
+	}
+
+	p := geonft.Pipeline{
+		Source:  geonft.FileSource{Path: path},
+		Formats: []geonft.OutputFormat{geonft.NFT{}},
+	}
+	data, err := p.Run(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.IPv4["AU"].Len() == 0 {
+		t.Errorf("AU = %v, want the networks of the database", data.IPv4["AU"])
+	}
+}
@@ -0,0 +1,164 @@
+package geonft
+
+import (
+	"math/big"
+	"net/netip"
+	"sort"
+)
+
+// Prefix set helpers. All functions expect masked prefixes of a single
+// address family unless noted otherwise.
+
+// UnmapPrefix converts an IPv4-mapped IPv6 prefix like ::ffff:1.2.3.0/120
+// into the native IPv4 prefix 1.2.3.0/24. Other prefixes are returned as is.
+func UnmapPrefix(p netip.Prefix) netip.Prefix {
+	if !p.Addr().Is4In6() || p.Bits() < 96 {
+		return p
+	}
+	return netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+}
+
+// MapPrefix converts an IPv4 prefix into the IPv4-mapped IPv6 prefix, the
+// reverse of UnmapPrefix.
+func MapPrefix(p netip.Prefix) netip.Prefix {
+	if !p.Addr().Is4() {
+		return p
+	}
+	return netip.PrefixFrom(netip.AddrFrom16(p.Addr().As16()), p.Bits()+96)
+}
+
+// PrefixSize returns the number of addresses covered by p.
+func PrefixSize(p netip.Prefix) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(p.Addr().BitLen()-p.Bits()))
+}
+
+// PrefixLast returns the last address covered by p.
+func PrefixLast(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// prefixHalves splits p into its two subnets of length Bits()+1.
+func prefixHalves(p netip.Prefix) (netip.Prefix, netip.Prefix) {
+	bits := p.Bits() + 1
+	lo := netip.PrefixFrom(p.Addr(), bits)
+
+	b := p.Addr().AsSlice()
+	b[p.Bits()/8] |= 0x80 >> (p.Bits() % 8)
+	addr, _ := netip.AddrFromSlice(b)
+
+	return lo, netip.PrefixFrom(addr, bits)
+}
+
+// SplitPrefix returns the subprefixes of p with the given length, or p
+// itself when it is longer.
+func SplitPrefix(p netip.Prefix, bits int) []netip.Prefix {
+	if p.Bits() >= bits {
+		return []netip.Prefix{p}
+	}
+	lo, hi := prefixHalves(p)
+	return append(SplitPrefix(lo, bits), SplitPrefix(hi, bits)...)
+}
+
+// SortPrefixes orders prefixes by address, shorter prefixes first.
+func SortPrefixes(prefixes []netip.Prefix) {
+	sort.Slice(prefixes, func(i, j int) bool {
+		if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return prefixes[i].Bits() < prefixes[j].Bits()
+	})
+}
+
+// MergePrefixes returns the sorted prefixes with every prefix contained in
+// another one removed, so that the result does not overlap.
+func MergePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := append([]netip.Prefix(nil), prefixes...)
+	SortPrefixes(sorted)
+
+	merged := sorted[:0]
+	for _, p := range sorted {
+		if n := len(merged); n > 0 && merged[n-1].Contains(p.Addr()) {
+			continue
+		}
+		merged = append(merged, p)
+	}
+	return merged
+}
+
+// SubtractPrefixes returns the parts of p not covered by holes. holes must
+// be sorted and non-overlapping, as returned by MergePrefixes.
+func SubtractPrefixes(p netip.Prefix, holes []netip.Prefix) []netip.Prefix {
+	last := PrefixLast(p)
+
+	// Narrow holes down to the ones overlapping p
+	start := sort.Search(len(holes), func(i int) bool {
+		return PrefixLast(holes[i]).Compare(p.Addr()) >= 0
+	})
+	end := start
+	for end < len(holes) && holes[end].Addr().Compare(last) <= 0 {
+		end++
+	}
+	overlapping := holes[start:end]
+
+	if len(overlapping) == 0 {
+		return []netip.Prefix{p}
+	}
+	if overlapping[0].Bits() <= p.Bits() {
+		// The hole covers p entirely
+		return nil
+	}
+
+	lo, hi := prefixHalves(p)
+	return append(SubtractPrefixes(lo, overlapping), SubtractPrefixes(hi, overlapping)...)
+}
+
+// IntersectPrefixes returns the parts of the sorted prefixes covered by
+// within, which must be sorted and non-overlapping. Both may mix address
+// families.
+func IntersectPrefixes(prefixes, within []netip.Prefix) []netip.Prefix {
+	var out []netip.Prefix
+	for _, p := range prefixes {
+		for _, w := range within {
+			switch {
+			case w.Contains(p.Addr()) && w.Bits() <= p.Bits():
+				out = append(out, p)
+			case p.Contains(w.Addr()) && p.Bits() < w.Bits():
+				out = append(out, w)
+			}
+		}
+	}
+	return out
+}
+
+// RangePrefixes returns the shortest list of prefixes covering exactly the
+// addresses from first to last.
+func RangePrefixes(first, last netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for first.IsValid() && first.Compare(last) <= 0 {
+		// The shortest prefix starting at first that ends within the range
+		bits := 0
+		for ; bits < first.BitLen(); bits++ {
+			p := netip.PrefixFrom(first, bits)
+			if p.Masked().Addr() == first && PrefixLast(p).Compare(last) <= 0 {
+				break
+			}
+		}
+		p := netip.PrefixFrom(first, bits)
+		prefixes = append(prefixes, p)
+		// Next of the last address of the family is invalid and ends the loop
+		first = PrefixLast(p).Next()
+	}
+	return prefixes
+}
+
+// RangeSize returns the number of addresses from first to last.
+func RangeSize(first, last netip.Addr) *big.Int {
+	a := new(big.Int).SetBytes(first.AsSlice())
+	b := new(big.Int).SetBytes(last.AsSlice())
+	return b.Sub(b, a).Add(b, big.NewInt(1))
+}
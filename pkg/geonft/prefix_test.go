@@ -0,0 +1,87 @@
+package geonft
+
+import (
+	"bytes"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/kkrow/maxminddb-to-nft/internal/mmdbfixture"
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+func TestUnmapPrefix(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"::ffff:1.2.3.0/120", "1.2.3.0/24"},
+		{"::ffff:11.0.0.0/104", "11.0.0.0/8"},
+		{"::ffff:1.2.3.4/128", "1.2.3.4/32"},
+		{"::ffff:0.0.0.0/96", "0.0.0.0/0"},
+		// Broader than the mapped space, not a mapped prefix
+		{"::/80", "::/80"},
+		{"1.2.3.0/24", "1.2.3.0/24"},
+		{"2001:db8::/32", "2001:db8::/32"},
+		// IPv4-compatible, not mapped
+		{"::1.2.3.0/120", "::1.2.3.0/120"},
+	}
+	for _, tt := range tests {
+		if got := UnmapPrefix(netip.MustParsePrefix(tt.in)); got != netip.MustParsePrefix(tt.want) {
+			t.Errorf("UnmapPrefix(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestLoaderMappedNetworks loads a database storing networks under
+// ::ffff:0:0/96, which must land in the IPv4 sets as native prefixes.
+func TestLoaderMappedNetworks(t *testing.T) {
+	tests := []struct {
+		name       string
+		ipv4InIPv6 bool
+		code       string
+		want       []string
+	}{
+		{"aliased", false, "AU", []string{"1.0.0.0/24"}},
+		{"mapped /104", true, "JP", []string{"11.0.0.0/8"}},
+		{"mapped /112", true, "KR", []string{"12.0.0.0/16"}},
+		{"mapped duplicate", true, "AU", []string{"1.0.0.0/24"}},
+		{"mapped within native", true, "FR", []string{"2.0.0.0/15"}},
+		{"mapped before native", true, "DE", []string{"4.0.0.0/16", "5.0.0.0/16", "192.0.2.0/24"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := mmdbfixture.Write(&buf, mmdbfixture.Options{IPv4InIPv6: tt.ipv4InIPv6}); err != nil {
+				t.Fatal(err)
+			}
+			db, err := maxminddb.FromBytes(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			data, err := (&Loader{Workers: 4}).Load(t.Context(), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := MergeOverlaps.Aggregate(data); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for p := range data.IPv4[tt.code].All() {
+				got = append(got, p.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("IPv4 set %s = %v, want %v", tt.code, got, tt.want)
+			}
+			for name, set := range data.IPv6 {
+				for p := range set.All() {
+					if p.Addr().Is4In6() {
+						t.Errorf("IPv6 set %s holds the mapped prefix %s", name, p)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package geonft
+
+import (
+	"encoding/binary"
+	"iter"
+	"net/netip"
+	"sort"
+)
+
+// PrefixList holds the prefixes of one set in packed form: IPv4 addresses
+// as uint32 and IPv6 addresses as two uint64, each with its length. A
+// netip.Prefix takes 32 bytes, a packed IPv4 prefix 5 and an IPv6 prefix
+// 17, which matters for databases with millions of networks. Text is only
+// rendered when the files are written. The zero value and nil are empty
+// lists.
+type PrefixList struct {
+	v4   []uint32
+	v6   [][2]uint64
+	bits []uint8
+}
+
+// PackPrefixes returns a list of prefixes, all of one family.
+func PackPrefixes(prefixes []netip.Prefix) *PrefixList {
+	l := &PrefixList{bits: make([]uint8, 0, len(prefixes))}
+	for _, p := range prefixes {
+		l.Add(p)
+	}
+	return l
+}
+
+// Add appends p, which must be of the family of the other prefixes.
+func (l *PrefixList) Add(p netip.Prefix) {
+	if p.Addr().Is4() {
+		a := p.Addr().As4()
+		l.v4 = append(l.v4, binary.BigEndian.Uint32(a[:]))
+	} else {
+		a := p.Addr().As16()
+		l.v6 = append(l.v6, [2]uint64{binary.BigEndian.Uint64(a[:8]), binary.BigEndian.Uint64(a[8:])})
+	}
+	l.bits = append(l.bits, uint8(p.Bits()))
+}
+
+// Len returns the number of prefixes.
+func (l *PrefixList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.bits)
+}
+
+// At unpacks the i-th prefix.
+func (l *PrefixList) At(i int) netip.Prefix {
+	if len(l.v4) > 0 {
+		var a [4]byte
+		binary.BigEndian.PutUint32(a[:], l.v4[i])
+		return netip.PrefixFrom(netip.AddrFrom4(a), int(l.bits[i]))
+	}
+	var a [16]byte
+	binary.BigEndian.PutUint64(a[:8], l.v6[i][0])
+	binary.BigEndian.PutUint64(a[8:], l.v6[i][1])
+	return netip.PrefixFrom(netip.AddrFrom16(a), int(l.bits[i]))
+}
+
+// Bits returns the length of the i-th prefix without unpacking it.
+func (l *PrefixList) Bits(i int) int {
+	return int(l.bits[i])
+}
+
+// All iterates over the prefixes in stored order.
+func (l *PrefixList) All() iter.Seq[netip.Prefix] {
+	return func(yield func(netip.Prefix) bool) {
+		for i := range l.Len() {
+			if !yield(l.At(i)) {
+				return
+			}
+		}
+	}
+}
+
+// Unpack returns the prefixes as a slice, for the set operations working
+// on netip.Prefix.
+func (l *PrefixList) Unpack() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, l.Len())
+	for p := range l.All() {
+		prefixes = append(prefixes, p)
+	}
+	return prefixes
+}
+
+// AppendList appends the prefixes of o.
+func (l *PrefixList) AppendList(o *PrefixList) {
+	l.v4 = append(l.v4, o.v4...)
+	l.v6 = append(l.v6, o.v6...)
+	l.bits = append(l.bits, o.bits...)
+}
+
+// AppendBinary appends the packed prefixes to b, a compact form for
+// hashing a set.
+func (l *PrefixList) AppendBinary(b []byte) []byte {
+	if l == nil {
+		return b
+	}
+	for _, a := range l.v4 {
+		b = binary.BigEndian.AppendUint32(b, a)
+	}
+	for _, a := range l.v6 {
+		b = binary.BigEndian.AppendUint64(b, a[0])
+		b = binary.BigEndian.AppendUint64(b, a[1])
+	}
+	return append(b, l.bits...)
+}
+
+// Sets maps set names, usually country codes, to the prefixes of one
+// address family.
+type Sets map[string]*PrefixList
+
+// Add appends p to the set name.
+func (s Sets) Add(name string, p netip.Prefix) {
+	l := s[name]
+	if l == nil {
+		l = &PrefixList{}
+		s[name] = l
+	}
+	l.Add(p)
+}
+
+// Merge appends the prefixes of every set in src to the set of the same
+// name.
+func (s Sets) Merge(src Sets) {
+	for name, prefixes := range src {
+		if s[name] == nil {
+			s[name] = prefixes
+			continue
+		}
+		s[name].AppendList(prefixes)
+	}
+}
+
+// Names returns the set names in consistent order.
+func (s Sets) Names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Subtract removes the space covered by holes from every set, dropping
+// sets that end up empty. holes must be sorted and non-overlapping.
+func (s Sets) Subtract(holes []netip.Prefix) {
+	for name, prefixes := range s {
+		var kept []netip.Prefix
+		for p := range prefixes.All() {
+			kept = append(kept, SubtractPrefixes(p, holes)...)
+		}
+
+		if len(kept) == 0 {
+			delete(s, name)
+			continue
+		}
+		s[name] = PackPrefixes(kept)
+	}
+}
+
+// Intersect limits every set to the space covered by within, dropping
+// sets that end up empty. within must be sorted and non-overlapping.
+func (s Sets) Intersect(within []netip.Prefix) {
+	for name, prefixes := range s {
+		kept := IntersectPrefixes(prefixes.Unpack(), within)
+		if len(kept) == 0 {
+			delete(s, name)
+			continue
+		}
+		s[name] = PackPrefixes(kept)
+	}
+}
+
+// Dataset holds the sets of both address families. The Sets of a family
+// that is not generated are nil.
+type Dataset struct {
+	IPv4 Sets
+	IPv6 Sets
+}
+
+// NewDataset returns a dataset with empty sets.
+func NewDataset() *Dataset {
+	return &Dataset{IPv4: make(Sets), IPv6: make(Sets)}
+}
+
+// Add appends p to the set name of its family.
+func (d *Dataset) Add(name string, p netip.Prefix) {
+	if p.Addr().Is4() {
+		d.IPv4.Add(name, p)
+		return
+	}
+	d.IPv6.Add(name, p)
+}
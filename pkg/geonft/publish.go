@@ -0,0 +1,123 @@
+package geonft
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Permissions of the files and directories written by Dir
+const (
+	FilePerm fs.FileMode = 0644
+	DirPerm  fs.FileMode = 0755
+)
+
+// writeBufferSize is the write buffer of every file written by WriteFile
+const writeBufferSize = 256 << 10
+
+// Publisher delivers the rendered files.
+type Publisher interface {
+	Publish(ctx context.Context, files []File) error
+}
+
+// Dir writes the files below a local directory, replacing each one
+// atomically.
+type Dir struct {
+	Path string
+	// Workers is the number of files written concurrently, one when zero
+	Workers int
+}
+
+func (d Dir) Publish(ctx context.Context, files []File) error {
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(max(d.Workers, 1))
+	for _, f := range files {
+		group.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			filename := filepath.Join(d.Path, f.Path)
+			if err := os.MkdirAll(filepath.Dir(filename), DirPerm); err != nil {
+				return fmt.Errorf("creating directory for %s: %w", filename, err)
+			}
+			if err := WriteFile(filename, FilePerm, f.Render); err != nil {
+				return fmt.Errorf("generating %s: %w", f.Path, err)
+			}
+			return nil
+		})
+	}
+	return group.Wait()
+}
+
+// WriteFile writes the output of render to filename, whose directory must
+// exist. The file is written under a temporary name and renamed into
+// place, so that an interrupted write never leaves a truncated file
+// behind. Like with os.WriteFile, perm is reduced by the umask.
+func WriteFile(filename string, perm fs.FileMode, render func(w io.Writer) error) error {
+	return WriteFileAttrs(filename, FileAttrs{Perm: perm, UID: -1, GID: -1}, render)
+}
+
+// FileAttrs are the permissions and owner WriteFileAttrs gives a file.
+type FileAttrs struct {
+	// Perm is reduced by the umask unless Exact is set
+	Perm  fs.FileMode
+	Exact bool
+	// UID and GID own the file, -1 leaves them unchanged
+	UID, GID int
+}
+
+// WriteFileAttrs is WriteFile giving the file attrs before it is renamed
+// into place, so that it is never readable by the wrong users.
+func WriteFileAttrs(filename string, attrs FileAttrs, render func(w io.Writer) error) error {
+	f, err := createTemp(filename, attrs.Perm)
+	if err != nil {
+		return fmt.Errorf("creating file %s: %w", filename, err)
+	}
+	defer os.Remove(f.Name())
+
+	// The renderers issue many small writes, buffer them into few syscalls
+	w := bufio.NewWriterSize(f, writeBufferSize)
+	err = render(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil && attrs.Exact {
+		err = f.Chmod(attrs.Perm)
+	}
+	if err == nil && (attrs.UID != -1 || attrs.GID != -1) {
+		err = f.Chown(attrs.UID, attrs.GID)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", filename, err)
+	}
+	return nil
+}
+
+// createTemp creates a new file next to filename like os.CreateTemp, but
+// with perm reduced by the umask instead of 0600, so that the renamed
+// file gets the permissions os.WriteFile would give it.
+func createTemp(filename string, perm fs.FileMode) (*os.File, error) {
+	for range 10000 {
+		name := filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+"."+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+	return nil, fmt.Errorf("creating a temporary file for %s: %w", filename, fs.ErrExist)
+}
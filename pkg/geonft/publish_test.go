@@ -0,0 +1,34 @@
+//go:build unix
+
+package geonft
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFileUmask(t *testing.T) {
+	old := syscall.Umask(0o077)
+	defer syscall.Umask(old)
+
+	filename := filepath.Join(t.TempDir(), "geoip_ipv4.nft")
+	err := WriteFile(filename, FilePerm, func(w io.Writer) error {
+		_, err := io.WriteString(w, "table inet geoip {}\n")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Mode().Perm(), fs.FileMode(0o600); got != want {
+		t.Errorf("mode %v, want %v", got, want)
+	}
+}
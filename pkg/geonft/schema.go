@@ -0,0 +1,284 @@
+package geonft
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// Supported schema names
+const (
+	SchemaAuto     = "auto"
+	SchemaGeoLite2 = "geolite2"
+	SchemaDBIP     = "dbip"
+	SchemaIPInfo   = "ipinfo"
+	SchemaCustom   = "custom"
+)
+
+// Represented country precedence modes
+const (
+	RepresentedIgnore   = "ignore"
+	RepresentedPrefer   = "prefer"
+	RepresentedFallback = "fallback"
+)
+
+// Number of networks probed when the database type is not recognized
+const SchemaProbeLimit = 64
+
+// Schema describes where the country code lives in a database record. The
+// paths are maxminddb.Result.DecodePath arguments.
+type Schema struct {
+	Name            string
+	CountryPath     []any
+	RepresentedPath []any // nil when the schema has no represented country
+	NamesPath       []any // nil when the schema has no localized names
+	ContinentPath   []any // nil when the schema has no continent
+	ASNPath         []any // nil when the schema has no autonomous system
+}
+
+// Known schemas in detection order
+var KnownSchemas = []Schema{
+	{
+		Name:            SchemaGeoLite2,
+		CountryPath:     []any{"country", "iso_code"},
+		RepresentedPath: []any{"represented_country", "iso_code"},
+		NamesPath:       []any{"country", "names"},
+		ContinentPath:   []any{"continent", "code"},
+	},
+	{
+		Name:            SchemaDBIP,
+		CountryPath:     []any{"country", "iso_code"},
+		RepresentedPath: []any{"represented_country", "iso_code"},
+		NamesPath:       []any{"country", "names"},
+		ContinentPath:   []any{"continent", "code"},
+	},
+	{
+		// ipinfo country.mmdb stores the code as a top-level string,
+		// country_asn.mmdb adds the AS number
+		Name:          SchemaIPInfo,
+		CountryPath:   []any{"country"},
+		ContinentPath: []any{"continent"},
+		ASNPath:       []any{"asn"},
+	},
+	{
+		// ipinfo lite uses country for the name and country_code for the code
+		Name:          SchemaIPInfo,
+		CountryPath:   []any{"country_code"},
+		ContinentPath: []any{"continent_code"},
+		ASNPath:       []any{"asn"},
+	},
+}
+
+// ParseLookupPath converts a dotted path like "country.iso_code" into
+// DecodePath arguments. Numeric segments are treated as array indexes.
+func ParseLookupPath(path string) ([]any, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty lookup path")
+	}
+
+	segments := strings.Split(path, ".")
+	parts := make([]any, 0, len(segments))
+	for _, seg := range segments {
+		if seg == "" {
+			return nil, fmt.Errorf("empty segment in lookup path %q", path)
+		}
+		if idx, err := strconv.Atoi(seg); err == nil {
+			parts = append(parts, idx)
+			continue
+		}
+		parts = append(parts, seg)
+	}
+
+	return parts, nil
+}
+
+// DetectSchema resolves the record schema of db. A dotted lookupPath wins
+// over the schema name, which is looked up in KnownSchemas. With SchemaAuto
+// the schema comes from the database metadata or, as a last resort, from
+// probing actual records.
+func DetectSchema(db *maxminddb.Reader, name, lookupPath string) (Schema, error) {
+	if lookupPath != "" {
+		path, err := ParseLookupPath(lookupPath)
+		if err != nil {
+			return Schema{}, err
+		}
+		return Schema{Name: SchemaCustom, CountryPath: path}, nil
+	}
+
+	if name != SchemaAuto {
+		var candidates []Schema
+		for _, s := range KnownSchemas {
+			if s.Name == name {
+				candidates = append(candidates, s)
+			}
+		}
+
+		switch len(candidates) {
+		case 0:
+			return Schema{}, fmt.Errorf("unknown schema %q", name)
+		case 1:
+			return candidates[0], nil
+		}
+
+		// Several layouts share the name, pick the one matching the records
+		return probeSchema(db, candidates)
+	}
+
+	dbType := strings.ToLower(db.Metadata.DatabaseType)
+	switch {
+	case strings.HasPrefix(dbType, "geoip2-"), strings.HasPrefix(dbType, "geolite2-"):
+		return KnownSchemas[0], nil
+	case strings.HasPrefix(dbType, "dbip-"):
+		return KnownSchemas[1], nil
+	}
+
+	return probeSchema(db, KnownSchemas)
+}
+
+// probeSchema returns the first candidate schema that yields a valid country
+// code for a sample of networks.
+func probeSchema(db *maxminddb.Reader, candidates []Schema) (Schema, error) {
+	probed := 0
+	for result := range db.Networks() {
+		if probed >= SchemaProbeLimit {
+			break
+		}
+		probed++
+
+		for _, s := range candidates {
+			var code string
+			if err := result.DecodePath(&code, s.CountryPath...); err != nil {
+				continue
+			}
+			if ValidCountryCode(code) {
+				return s, nil
+			}
+		}
+	}
+
+	return Schema{}, fmt.Errorf("could not detect record schema of %q database, set a lookup path",
+		db.Metadata.DatabaseType)
+}
+
+// CountryCode extracts the code used for classification according to the
+// represented country precedence mode.
+func (s Schema) CountryCode(result maxminddb.Result, mode string) (string, error) {
+	var physical string
+	if err := result.DecodePath(&physical, s.CountryPath...); err != nil {
+		return "", err
+	}
+
+	if mode == RepresentedIgnore || s.RepresentedPath == nil {
+		return physical, nil
+	}
+
+	// Set for military bases and overseas territories, e.g. a US base in DE
+	var represented string
+	if err := result.DecodePath(&represented, s.RepresentedPath...); err != nil {
+		return "", err
+	}
+
+	switch mode {
+	case RepresentedPrefer:
+		if represented != "" {
+			return represented, nil
+		}
+	case RepresentedFallback:
+		if physical == "" {
+			return represented, nil
+		}
+	}
+
+	return physical, nil
+}
+
+// LocalizedNames decodes the localized country names of a record, keyed by
+// locale. It returns nil when the record's physical country is not code.
+func (s Schema) LocalizedNames(result maxminddb.Result, code string) (map[string]string, error) {
+	if s.NamesPath == nil {
+		return nil, nil
+	}
+
+	var physical string
+	if err := result.DecodePath(&physical, s.CountryPath...); err != nil {
+		return nil, err
+	}
+	if physical != code {
+		return nil, nil
+	}
+
+	var names map[string]string
+	if err := result.DecodePath(&names, s.NamesPath...); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// ContinentCode returns the two-letter continent code of a record, empty
+// when the record or the schema has none.
+func (s Schema) ContinentCode(result maxminddb.Result) (string, error) {
+	if s.ContinentPath == nil {
+		return "", nil
+	}
+	var code string
+	if err := result.DecodePath(&code, s.ContinentPath...); err != nil {
+		return "", err
+	}
+	if !ValidCountryCode(code) {
+		return "", nil
+	}
+	return code, nil
+}
+
+// ASN returns the autonomous system of a record like AS13335, empty when
+// the record or the schema has none. Both AS numbers and strings like
+// "AS13335" are accepted.
+func (s Schema) ASN(result maxminddb.Result) (string, error) {
+	if s.ASNPath == nil {
+		return "", nil
+	}
+	var value any
+	if err := result.DecodePath(&value, s.ASNPath...); err != nil {
+		return "", err
+	}
+
+	var number uint64
+	switch v := value.(type) {
+	case uint64:
+		number = v
+	case uint32:
+		number = uint64(v)
+	case uint16:
+		number = uint64(v)
+	case int:
+		number = uint64(v)
+	case string:
+		n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(v), "AS"), 10, 32)
+		if err != nil {
+			return "", nil
+		}
+		number = n
+	default:
+		return "", nil
+	}
+	if number == 0 {
+		return "", nil
+	}
+	return "AS" + strconv.FormatUint(number, 10), nil
+}
+
+// ValidCountryCode reports whether code has the syntax of an ISO 3166-1
+// alpha-2 code.
+func ValidCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
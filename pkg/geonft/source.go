@@ -0,0 +1,179 @@
+package geonft
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// MaxDatabaseSize limits databases read onto the heap, to prevent memory
+// exhaustion.
+const MaxDatabaseSize = 1024 * 1024 * 1024
+
+// Source provides the database a pipeline converts.
+type Source interface {
+	Open(ctx context.Context) (*maxminddb.Reader, error)
+}
+
+// DatabaseError is returned by the sources when the data was read but is
+// not a valid database.
+type DatabaseError struct {
+	Err error
+}
+
+func (e *DatabaseError) Error() string { return "opening MMDB: " + e.Err.Error() }
+
+func (e *DatabaseError) Unwrap() error { return e.Err }
+
+// FileSource reads a local database. A plain .mmdb file is mapped into
+// memory instead of read onto the heap, a .tar.gz or .tgz is extracted
+// first.
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Open(ctx context.Context) (*maxminddb.Reader, error) {
+	if !isArchive(s.Path) {
+		db, err := maxminddb.Open(s.Path)
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return nil, fmt.Errorf("failed to read %s: %w", s.Path, err)
+		}
+		if err != nil {
+			return nil, &DatabaseError{err}
+		}
+		return db, nil
+	}
+
+	data, err := s.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.Path, err)
+	}
+	db, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, &DatabaseError{err}
+	}
+	return db, nil
+}
+
+func (s FileSource) read() ([]byte, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(io.LimitReader(f, MaxDatabaseSize))
+	if err != nil {
+		return nil, fmt.Errorf("gzip reader: %w", err)
+	}
+	defer gz.Close()
+
+	return ExtractMMDB(gz)
+}
+
+func isArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// URLSource downloads a .tar.gz archive holding the database, like the
+// GeoLite2 redistributions.
+type URLSource struct {
+	URL string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+func (s URLSource) Open(ctx context.Context) (*maxminddb.Reader, error) {
+	data, err := s.fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download and extract MMDB: %w", err)
+	}
+	db, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, &DatabaseError{err}
+	}
+	return db, nil
+}
+
+func (s URLSource) fetch(ctx context.Context) ([]byte, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+
+	gz, err := gzip.NewReader(io.LimitReader(resp.Body, MaxDatabaseSize))
+	if err != nil {
+		return nil, fmt.Errorf("gzip reader: %w", err)
+	}
+	defer gz.Close()
+
+	return ExtractMMDB(gz)
+}
+
+// ExtractMMDB returns the first .mmdb file of the tar stream r.
+func ExtractMMDB(r io.Reader) ([]byte, error) {
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar header: %w", err)
+		}
+
+		// Security: prevent path traversal
+		if !isValidTarPath(hdr.Name) {
+			continue
+		}
+
+		if strings.HasSuffix(hdr.Name, ".mmdb") {
+			if hdr.Size > MaxDatabaseSize {
+				return nil, fmt.Errorf("MMDB file too large: %d bytes", hdr.Size)
+			}
+
+			mmdbData, err := io.ReadAll(io.LimitReader(tr, hdr.Size))
+			if err != nil {
+				return nil, fmt.Errorf("reading MMDB file: %w", err)
+			}
+			return mmdbData, nil
+		}
+	}
+
+	return nil, fmt.Errorf("MMDB file not found in archive")
+}
+
+func isValidTarPath(path string) bool {
+	// Prevent path traversal attacks
+	cleanPath := filepath.Clean(path)
+	return !strings.Contains(cleanPath, "..") &&
+		!strings.HasPrefix(cleanPath, "/") &&
+		!strings.HasPrefix(cleanPath, "\\")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/netip"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// dropBroadPrefixes removes prefixes shorter than minBits, as well as
+// prefixes covering the whole address family, and returns what it removed
+// keyed by set name.
+func dropBroadPrefixes(countryMap geonft.Sets, minBits int) map[string][]netip.Prefix {
+	broad := func(bits int) bool { return bits == 0 || bits < minBits }
+
+	dropped := make(map[string][]netip.Prefix)
+	for code, prefixes := range countryMap {
+		// Most sets have none, leave those as they are
+		hasBroad := false
+		for i := range prefixes.Len() {
+			if broad(prefixes.Bits(i)) {
+				hasBroad = true
+				break
+			}
+		}
+		if !hasBroad {
+			continue
+		}
+
+		kept := &geonft.PrefixList{}
+		for p := range prefixes.All() {
+			if broad(p.Bits()) {
+				dropped[code] = append(dropped[code], p)
+				continue
+			}
+			kept.Add(p)
+		}
+
+		if kept.Len() == 0 {
+			delete(countryMap, code)
+			continue
+		}
+		countryMap[code] = kept
+	}
+	return dropped
+}
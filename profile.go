@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	runtimepprof "runtime/pprof"
+	"runtime/trace"
+)
+
+// startProfiling starts the -pprof listener and the -cpu-profile and
+// -trace recordings. The returned function stops the recordings and must
+// run before the process exits, otherwise the files are incomplete.
+func startProfiling(cfg config) (stop func(), err error) {
+	var stops []func()
+	stop = func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	defer func() {
+		if err != nil {
+			stop()
+		}
+	}()
+
+	if cfg.Pprof != "" {
+		if err := listenPprof(cfg.Pprof); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.CPUProfile != "" {
+		f, err := os.Create(cfg.CPUProfile)
+		if err != nil {
+			return nil, fmt.Errorf("creating CPU profile: %w", err)
+		}
+		if err := runtimepprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("starting CPU profile: %w", err)
+		}
+		stops = append(stops, func() {
+			runtimepprof.StopCPUProfile()
+			closeProfile(f, "CPU profile")
+		})
+	}
+
+	if cfg.Trace != "" {
+		f, err := os.Create(cfg.Trace)
+		if err != nil {
+			return nil, fmt.Errorf("creating execution trace: %w", err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("starting execution trace: %w", err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			closeProfile(f, "execution trace")
+		})
+	}
+
+	return stop, nil
+}
+
+func closeProfile(f *os.File, kind string) {
+	if err := f.Close(); err != nil {
+		slog.Error("Failed to write "+kind, "path", f.Name(), "error", err)
+		return
+	}
+	slog.Info("Wrote "+kind, "path", f.Name())
+}
+
+// listenPprof serves the net/http/pprof handlers on their own listener, so
+// that they are never exposed on the -listen address of serve.
+func listenPprof(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("pprof listener: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	go func() {
+		if err := http.Serve(lis, mux); err != nil {
+			slog.Error("pprof server stopped", "error", err)
+		}
+	}()
+	slog.Info("Serving pprof", "listen", lis.Addr().String())
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// publishedListName is the file kept next to the files published over SFTP
+// listing them, so that the next publish knows which remote files are stale
+// without removing anything it did not upload.
+const publishedListName = ".maxminddb-to-nft-files"
+
+// publish syncs the output directory to every -publish target after a
+// successful run. sftp:// targets are uploaded with the sftp client, object
+// storage targets with the provider CLI, and every other target is handed
+// to rsync as is (host:/path, rsync://host/module).
+func (g *geoIPGenerator) publish() error {
+	files, err := g.relativeOutputs()
+	if err != nil {
+		return err
+	}
+
+	for _, target := range g.cfg.Publish {
+		switch {
+		case strings.HasPrefix(target, "sftp://"):
+			err = g.publishSFTP(target, files)
+		case isObjectTarget(target):
+			err = g.publishObjects(target, files)
+		default:
+			err = g.publishRsync(target)
+		}
+		if err != nil {
+			return fmt.Errorf("publishing to %s: %w", target, err)
+		}
+
+		if g.cfg.PublishDryRun {
+			slog.Info("Dry run, nothing published", "target", target)
+			continue
+		}
+		slog.Info("Published files", "files", len(files), "target", target)
+	}
+	return nil
+}
+
+// relativeOutputs returns the generated files relative to -output-dir.
+func (g *geoIPGenerator) relativeOutputs() ([]string, error) {
+	files := make([]string, 0, len(g.outputs))
+	for _, output := range g.outputs {
+		rel, err := filepath.Rel(g.cfg.OutputDir, output)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, filepath.ToSlash(rel))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (g *geoIPGenerator) publishRsync(target string) error {
+	args := []string{"-a"}
+	if g.cfg.PublishDelete {
+		args = append(args, "--delete")
+	}
+	if g.cfg.PublishDryRun {
+		args = append(args, "--dry-run", "--itemize-changes")
+	}
+	// The trailing slash syncs the contents rather than the directory
+	args = append(args, filepath.Clean(g.cfg.OutputDir)+"/", target)
+
+	out, err := exec.CommandContext(g.ctx, "rsync", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("rsync: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	if g.cfg.PublishDryRun && len(out) > 0 {
+		fmt.Print(string(out))
+	}
+	return nil
+}
+
+// publishSFTP uploads the files in one sftp batch. With -publish-delete,
+// files listed by the previous publish that are no longer generated are
+// removed.
+func (g *geoIPGenerator) publishSFTP(target string, files []string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" || u.Path == "" {
+		return fmt.Errorf("sftp target must look like sftp://[user@]host[:port]/path")
+	}
+
+	host := u.Hostname()
+	if u.User != nil {
+		host = u.User.Username() + "@" + host
+	}
+	var args []string
+	if port := u.Port(); port != "" {
+		args = append(args, "-P", port)
+	}
+
+	var stale []string
+	if g.cfg.PublishDelete {
+		previous, err := fetchPublishedList(g.ctx, args, host, u.Path)
+		if err != nil {
+			return fmt.Errorf("reading published file list: %w", err)
+		}
+		stale = missingFrom(files, previous)
+	}
+
+	list, err := os.CreateTemp("", "geoip-published-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(list.Name())
+	_, err = fmt.Fprintln(list, strings.Join(files, "\n"))
+	if closeErr := list.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	// A leading "-" keeps sftp going when the directory already exists
+	for _, dir := range remoteDirs(u.Path, files) {
+		fmt.Fprintf(&b, "-mkdir %s\n", sftpQuote(dir))
+	}
+	for _, file := range files {
+		fmt.Fprintf(&b, "put %s %s\n",
+			sftpQuote(filepath.Join(g.cfg.OutputDir, filepath.FromSlash(file))), sftpQuote(path.Join(u.Path, file)))
+	}
+	for _, file := range stale {
+		fmt.Fprintf(&b, "-rm %s\n", sftpQuote(path.Join(u.Path, file)))
+	}
+	fmt.Fprintf(&b, "put %s %s\n", sftpQuote(list.Name()), sftpQuote(path.Join(u.Path, publishedListName)))
+
+	if g.cfg.PublishDryRun {
+		fmt.Print(b.String())
+		return nil
+	}
+
+	return runSFTP(g.ctx, args, host, b.String())
+}
+
+// fetchPublishedList downloads the list of files uploaded by the previous
+// publish. A missing list is not an error.
+func fetchPublishedList(ctx context.Context, args []string, host, dir string) ([]string, error) {
+	tmp, err := os.MkdirTemp("", "geoip-published-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	local := filepath.Join(tmp, publishedListName)
+	batch := fmt.Sprintf("-get %s %s\n", sftpQuote(path.Join(dir, publishedListName)), sftpQuote(local))
+	if err := runSFTP(ctx, args, host, batch); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(local)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, scanner.Err()
+}
+
+// remoteDirs returns base and every directory below it holding one of the
+// files, parents first.
+func remoteDirs(base string, files []string) []string {
+	seen := map[string]bool{base: true}
+	dirs := []string{base}
+	for _, file := range files {
+		var parts []string
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			parts = append([]string{dir}, parts...)
+		}
+		for _, dir := range parts {
+			full := path.Join(base, dir)
+			if !seen[full] {
+				seen[full] = true
+				dirs = append(dirs, full)
+			}
+		}
+	}
+	return dirs
+}
+
+func runSFTP(ctx context.Context, args []string, host, batch string) error {
+	args = append(append([]string{"-b", "-"}, args...), host)
+	cmd := exec.CommandContext(ctx, "sftp", args...)
+	cmd.Stdin = strings.NewReader(batch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sftp: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// sftpQuote quotes a path for an sftp batch file.
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// rateLimitFile holds the -rate-limit rules of a family, next to the
+// global files
+const rateLimitFile = "geoip_ratelimit_%s.nft"
+
+// Hooks of the -rate-limit chain
+const (
+	rateLimitHookInput   = "input"
+	rateLimitHookForward = "forward"
+)
+
+var rateLimitRate = regexp.MustCompile(`^[1-9][0-9]*/(second|minute|hour|day)$`)
+
+// rateLimit throttles the new connections from a group of sets, like
+// RU+BY=100/minute. The sets of a group share one named limit, so the
+// rate applies to the group as a whole.
+type rateLimit struct {
+	sets []string
+	rate string
+}
+
+func parseRateLimit(s string) (rateLimit, error) {
+	sets, rate, ok := strings.Cut(s, "=")
+	if !ok {
+		return rateLimit{}, fmt.Errorf("%q is not SETS=RATE", s)
+	}
+	if !rateLimitRate.MatchString(rate) {
+		return rateLimit{}, fmt.Errorf("invalid rate %q in %q, must be like 100/minute", rate, s)
+	}
+	r := rateLimit{sets: strings.Split(sets, "+"), rate: rate}
+	for _, set := range r.sets {
+		if !isValidSetName(set) {
+			return rateLimit{}, fmt.Errorf("invalid set name %q in %q", set, s)
+		}
+	}
+	return r, nil
+}
+
+// name returns the name of the limit object of the group.
+func (r rateLimit) name() string {
+	return "ratelimit_" + strings.Join(r.sets, "_")
+}
+
+// rateLimitArtifacts render the limit objects and a chain applying them
+// per family. The IPv4 and IPv6 files declare sets of the same names, so
+// only one family is loaded into the table and each rule file only uses
+// the sets of its family. The chain is declared and flushed first, so that
+// loading the file again replaces the rules instead of adding them twice.
+func (g *geoIPGenerator) rateLimitArtifacts() []artifact {
+	var limits []rateLimit
+	for _, s := range g.cfg.RateLimits {
+		// Validated with the configuration
+		r, _ := parseRateLimit(s)
+		limits = append(limits, r)
+	}
+
+	var list []artifact
+	for _, family := range []struct{ name, match string }{{"ipv4", "ip"}, {"ipv6", "ip6"}} {
+		if !g.cfg.family(family.name) {
+			continue
+		}
+		chain := "ratelimit_" + family.name
+		list = append(list, artifact{
+			path: fmt.Sprintf(rateLimitFile, family.name),
+			render: func(w io.Writer) error {
+				fmt.Fprintln(w, "#!/usr/sbin/nft -f")
+				fmt.Fprintf(w, "table %s {\n", g.cfg.table())
+				fmt.Fprintf(w, "    chain %s {\n        type filter hook %s priority %s; policy accept;\n    }\n}\n",
+					chain, g.cfg.RateLimitHook, g.features.priority("filter"))
+				fmt.Fprintf(w, "flush chain %s %s\n", g.cfg.table(), chain)
+				fmt.Fprintf(w, "table %s {\n", g.cfg.table())
+				for _, r := range limits {
+					fmt.Fprintf(w, "    limit %s {\n        rate over %s\n    }\n", r.name(), r.rate)
+				}
+				// Sets missing from the global file would fail the whole file
+				sizes := g.setSizes()[family.name]
+				fmt.Fprintf(w, "    chain %s {\n", chain)
+				for _, r := range limits {
+					for _, set := range r.sets {
+						if sizes[set] == 0 {
+							slog.Warn("Rate limited set was not generated", "set", set, "family", family.name)
+							continue
+						}
+						fmt.Fprintf(w, "        ct state new %s saddr @%s limit name %q drop\n", family.match, g.setName(set), r.name())
+					}
+				}
+				fmt.Fprintln(w, "    }")
+				_, err := fmt.Fprintln(w, "}")
+				return err
+			},
+		})
+	}
+	return list
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"slices"
+)
+
+// restartOptions are read once at startup of the daemon, a reload logs
+// that their changes wait for a restart.
+var restartOptions = []string{
+	"health_listen", "log_level", "log_format", "log_output",
+	"pprof", "cpu_profile", "trace", "max_memory",
+}
+
+// reloadDaemon reads the configuration again on SIGHUP, the config file
+// with the flags of the command line on top. It is only used when it is
+// valid as a whole, including its schedule and watcher, so a broken edit
+// keeps the daemon running on the current configuration. A run in flight
+// finishes with the configuration it started with.
+func reloadDaemon(current config, reload func() (config, error)) (*daemonPlan, error) {
+	cfg, err := reload()
+	if err != nil {
+		return nil, err
+	}
+	changed, err := configChanges(current, cfg)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := newDaemonPlan(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Reloaded configuration", "file", cfg.ConfigFile, "changed", changed)
+	for _, option := range changed {
+		if slices.Contains(restartOptions, option) {
+			slog.Warn("Changed option takes effect after a restart", "option", option)
+		}
+	}
+	return plan, nil
+}
+
+// configChanges returns the JSON names of the options that differ between
+// a and b, in order. Only names are returned, values like webhook URLs may
+// hold secrets.
+func configChanges(a, b config) ([]string, error) {
+	fields := func(cfg config) (map[string]json.RawMessage, error) {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]json.RawMessage
+		return m, json.Unmarshal(data, &m)
+	}
+	before, err := fields(a)
+	if err != nil {
+		return nil, err
+	}
+	after, err := fields(b)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []string{}
+	for name, value := range after {
+		if !bytes.Equal(before[name], value) {
+			changed = append(changed, name)
+		}
+	}
+	slices.Sort(changed)
+	return changed, nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// schedule yields the time of the next run after a given time. It is
+// satisfied by cron.Schedule.
+type schedule interface {
+	Next(time.Time) time.Time
+}
+
+// everySchedule runs at a fixed interval.
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// newSchedule returns the -schedule cron expression or the fixed
+// -refresh-interval, or nil when neither is set.
+func newSchedule(cfg config) (schedule, error) {
+	if cfg.Schedule == "" {
+		if cfg.RefreshInterval > 0 {
+			return everySchedule(cfg.RefreshInterval), nil
+		}
+		return nil, nil
+	}
+
+	spec := cfg.Schedule
+	if cfg.Timezone != "" && !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+		spec = "CRON_TZ=" + cfg.Timezone + " " + spec
+	}
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -schedule %q: %w", cfg.Schedule, err)
+	}
+	return sched, nil
+}
+
+// jitter returns a random delay of up to -jitter, spreading the runs of a
+// fleet started by the same timer.
+func jitter(cfg config) time.Duration {
+	if cfg.Jitter <= 0 {
+		return 0
+	}
+	return rand.N(time.Duration(cfg.Jitter))
+}
+
+// runOnSchedule calls job at every time of sched, each delayed by a fresh
+// jitter, until ctx is cancelled.
+func runOnSchedule(ctx context.Context, cfg config, sched schedule, job func()) {
+	for {
+		next := sched.Next(time.Now()).Add(jitter(cfg))
+		if !sleep(ctx, time.Until(next)) {
+			return
+		}
+		job()
+	}
+}
+
+// sleep waits for d and reports whether ctx was not cancelled meanwhile.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// daemonPlan is what a daemon configuration runs on: the schedule, nil
+// without one, and the -watch watcher, nil without it.
+type daemonPlan struct {
+	cfg     config
+	sched   schedule
+	watcher *inputWatcher
+}
+
+func newDaemonPlan(cfg config) (*daemonPlan, error) {
+	sched, err := newSchedule(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if sched == nil && !cfg.Watch {
+		return nil, fmt.Errorf("daemon requires -schedule, -refresh-interval or -watch")
+	}
+	plan := &daemonPlan{cfg: cfg, sched: sched}
+	if cfg.Watch {
+		if plan.watcher, err = newInputWatcher(cfg.Input); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// daemon regenerates the outputs on the configured schedule and, with
+// -watch, whenever the -input file is replaced. With -daemon-apply it
+// loads them after every successful run. The first run starts after the
+// startup jitter. Failed runs are logged and retried at the next scheduled
+// time or change. SIGHUP reloads the configuration with reload, see
+// reloadDaemon. Under a systemd Type=notify unit the progress is reported
+// with sd_notify and WatchdogSec is honored.
+func (g *geoIPGenerator) daemon(reload func() (config, error)) error {
+	// The watcher is set up before the first run, which would miss a
+	// replacement meanwhile otherwise
+	plan, err := newDaemonPlan(g.cfg)
+	if err != nil {
+		return err
+	}
+
+	health := newHealthState(g.cfg)
+	if g.cfg.HealthListen != "" {
+		if err := health.listen(g.cfg.HealthListen); err != nil {
+			return err
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// Ready once scheduling works, a first run delayed by the jitter must not
+	// run into the unit's start timeout
+	watchdog := newSDWatchdog()
+	sdNotify("READY=1\nSTATUS=Waiting for the first run")
+
+	if delay := jitter(g.cfg); delay > 0 {
+		slog.Info("Waiting before the first run", "delay", delay.Round(time.Millisecond))
+		if !sleep(g.ctx, delay) {
+			return nil
+		}
+	}
+
+	// Runs never overlap, also not across a reload. A run still waiting
+	// when its plan is replaced is dropped.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	runner := func(ctx context.Context, plan *daemonPlan) func() {
+		return func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if ctx.Err() == nil {
+				watchdog.run(func() { g.daemonRun(plan, health) })
+			}
+		}
+	}
+	start := func(plan *daemonPlan) context.CancelFunc {
+		ctx, cancel := context.WithCancel(g.ctx)
+		run := runner(ctx, plan)
+		if plan.watcher != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				plan.watcher.run(ctx, time.Duration(plan.cfg.WatchDelay), run)
+			}()
+		}
+		if plan.sched != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runOnSchedule(ctx, plan.cfg, plan.sched, run)
+			}()
+		}
+		return cancel
+	}
+
+	runner(g.ctx, plan)()
+	stop := start(plan)
+	for {
+		select {
+		case <-g.ctx.Done():
+			stop()
+			wg.Wait()
+			sdNotify("STOPPING=1")
+			slog.Info("Daemon stopped")
+			return nil
+		case <-hup:
+		}
+
+		next, err := reloadDaemon(plan.cfg, reload)
+		if err != nil {
+			slog.Error("Reloading the configuration failed, keeping the current one", "error", err)
+			continue
+		}
+		stop()
+		plan = next
+		health.setConfig(plan.cfg)
+		stop = start(plan)
+	}
+}
+
+// daemonRun is a single run of the daemon with the configuration of plan.
+func (g *geoIPGenerator) daemonRun(plan *daemonPlan, health *healthState) {
+	sdNotify("STATUS=Generating")
+	err := newGeoIPGenerator(g.ctx, plan.cfg).runOnce(health)
+	if g.ctx.Err() != nil {
+		// Interrupted by the shutdown
+		return
+	}
+	status := "next run on a change of " + plan.cfg.Input
+	var next string
+	if plan.sched != nil {
+		next = plan.sched.Next(time.Now()).Format(time.RFC3339)
+		status = "next run at " + next
+	}
+	if err != nil {
+		slog.Error("Scheduled run failed", "error", err)
+		sdNotify(fmt.Sprintf("STATUS=Last run failed: %v; %s", err, status))
+	} else {
+		sdNotify(fmt.Sprintf("STATUS=Last run succeeded at %s; %s", time.Now().Format(time.RFC3339), status))
+	}
+	if next != "" {
+		slog.Info("Next run scheduled", "next", next)
+	}
+}
+
+// runOnce is a single scheduled generation, followed by an apply when
+// -daemon-apply is set. Both outcomes are recorded in health and reported
+// to the webhooks.
+func (g *geoIPGenerator) runOnce(health *healthState) (err error) {
+	start := time.Now()
+	defer func() { g.sendWebhooks(start, err) }()
+
+	err = g.run()
+	health.recordRun(g, err)
+	if err != nil || !g.cfg.DaemonApply {
+		return err
+	}
+
+	err = g.apply()
+	health.recordApply(err)
+	if err != nil {
+		return fmt.Errorf("apply: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// sdNotify sends a state such as "READY=1" to the systemd service manager.
+// It is a no-op when the process was not started by a Type=notify unit.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// A leading @ denotes a socket in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		slog.Warn("sd_notify failed", "error", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("sd_notify failed", "error", err)
+	}
+}
+
+// sdWatchdogInterval returns how often the unit's WatchdogSec expects a
+// keep-alive, or 0 when the watchdog is not enabled for this process.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// sdWatchdog pings the systemd watchdog at half of WatchdogSec, as
+// recommended by sd_watchdog_enabled(3). Pings stop while a job passed to
+// run takes longer than WatchdogSec, so a hung download or apply gets the
+// unit restarted instead of silently missing every later run.
+type sdWatchdog struct {
+	interval time.Duration
+	// Start of the running job in Unix nanoseconds, 0 while idle
+	busySince atomic.Int64
+}
+
+func newSDWatchdog() *sdWatchdog {
+	w := &sdWatchdog{interval: sdWatchdogInterval()}
+	if w.interval > 0 {
+		go w.ping()
+	}
+	return w
+}
+
+func (w *sdWatchdog) ping() {
+	ticker := time.NewTicker(w.interval / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		if since := w.busySince.Load(); since == 0 || time.Since(time.Unix(0, since)) < w.interval {
+			sdNotify("WATCHDOG=1")
+		}
+	}
+}
+
+// run calls job, which counts as stalled once it exceeds WatchdogSec.
+func (w *sdWatchdog) run(job func()) {
+	w.busySince.Store(time.Now().UnixNano())
+	defer w.busySince.Store(0)
+	job()
+}
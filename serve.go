@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Time the requests in flight get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// servedFile is a generated file held in memory with its precomputed
+// representations.
+type servedFile struct {
+	content     []byte
+	gzipped     []byte
+	etag        string
+	contentType string
+}
+
+// manifestFile describes one file in /manifest.json.
+type manifestFile struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type manifest struct {
+	DatabaseType string         `json:"database_type"`
+	BuildEpoch   uint           `json:"build_epoch"`
+	Generated    time.Time      `json:"generated"`
+	Files        []manifestFile `json:"files"`
+	Stats        []setStats     `json:"stats,omitempty"`
+}
+
+// fileSnapshot is the complete set of files served at one point in time,
+// replaced as a whole after every refresh so that clients never see a mix
+// of two runs.
+type fileSnapshot struct {
+	files    map[string]*servedFile
+	manifest *servedFile
+	// Detached signature of the manifest, nil without -sign
+	manifestSig *servedFile
+	info        manifest
+	modTime     time.Time
+	lookup      *lookupData
+}
+
+// fileServer serves the outputs of the latest successful run.
+type fileServer struct {
+	ctx    context.Context
+	cfg    config
+	sched  schedule
+	asn    *maxminddb.Reader
+	health *healthState
+
+	mu       sync.RWMutex
+	snapshot *fileSnapshot
+	// Serializes refreshes from the timer and TriggerRefresh
+	refreshMu sync.Mutex
+}
+
+// serve generates the outputs, serves them over HTTP and, with -schedule
+// or -refresh-interval, regenerates them periodically. A failed refresh
+// keeps serving the previous files.
+func (g *geoIPGenerator) serve() error {
+	sched, err := newSchedule(g.cfg)
+	if err != nil {
+		return err
+	}
+
+	health := newHealthState(g.cfg)
+	start := time.Now()
+	g.openASN = g.cfg.ASNInput != ""
+	err = g.run()
+	health.recordRun(g, err)
+	g.sendWebhooks(start, err)
+	if err != nil {
+		return err
+	}
+	asn := g.asn
+
+	srv := &fileServer{ctx: g.ctx, cfg: g.cfg, sched: sched, asn: asn, health: health}
+
+	snapshot, err := g.loadSnapshot(asn)
+	if err != nil {
+		return err
+	}
+	srv.snapshot = snapshot
+
+	tlsConfig, err := newServeTLS(g.cfg)
+	if err != nil {
+		return err
+	}
+	guard := newServeGuard(g.cfg)
+
+	watchdog := newSDWatchdog()
+	if sched != nil {
+		go runOnSchedule(g.ctx, g.cfg, sched, func() {
+			watchdog.run(func() {
+				if _, err := srv.refresh(); err != nil {
+					slog.Error("Refresh failed, still serving the previous files", "error", err)
+				}
+			})
+		})
+	}
+
+	if g.cfg.GRPCListen != "" {
+		lis, err := net.Listen("tcp", g.cfg.GRPCListen)
+		if err != nil {
+			return fmt.Errorf("gRPC listener: %w", err)
+		}
+		opts := []grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(guard.unaryInterceptor),
+			grpc.ChainStreamInterceptor(guard.streamInterceptor),
+		}
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcServer := newGRPCServer(srv, opts...)
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				slog.Error("gRPC server stopped", "error", err)
+			}
+		}()
+		context.AfterFunc(g.ctx, grpcServer.GracefulStop)
+		slog.Info("Serving gRPC", "listen", g.cfg.GRPCListen)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", srv)
+	mux.HandleFunc("GET /lookup/{ip}", srv.serveLookup)
+	health.register(mux)
+
+	lis, err := net.Listen("tcp", g.cfg.Listen)
+	if err != nil {
+		return err
+	}
+	slog.Info("Serving files", "dir", g.cfg.OutputDir, "listen", g.cfg.Listen, "tls", tlsConfig != nil)
+	sdNotify("READY=1\nSTATUS=Serving " + g.cfg.Listen)
+
+	// Requests in flight are finished on shutdown
+	server := &http.Server{Handler: guard.handler(mux), TLSConfig: tlsConfig}
+	stopped := make(chan error, 1)
+	context.AfterFunc(g.ctx, func() {
+		sdNotify("STOPPING=1")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		stopped <- server.Shutdown(ctx)
+	})
+	serve := server.Serve
+	if tlsConfig != nil {
+		// The certificates come from TLSConfig
+		serve = func(lis net.Listener) error { return server.ServeTLS(lis, "", "") }
+	}
+	if err := serve(lis); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	if err := <-stopped; err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	slog.Info("Server stopped")
+	return nil
+}
+
+// cacheControl lets clients cache responses until the next scheduled
+// refresh.
+func (s *fileServer) cacheControl() string {
+	if s.sched == nil {
+		return "no-cache"
+	}
+	now := time.Now()
+	return fmt.Sprintf("public, max-age=%d", int(s.sched.Next(now).Sub(now).Seconds()))
+}
+
+// refresh regenerates the files and swaps them in when the run succeeded.
+func (s *fileServer) refresh() (*fileSnapshot, error) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	g := newGeoIPGenerator(s.ctx, s.cfg)
+	start := time.Now()
+	err := g.run()
+	s.health.recordRun(g, err)
+	g.sendWebhooks(start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := g.loadSnapshot(s.asn)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.snapshot = snapshot
+	s.mu.Unlock()
+	slog.Info("Serving refreshed files", "files", len(snapshot.files))
+	return snapshot, nil
+}
+
+// current returns the snapshot being served.
+func (s *fileServer) current() *fileSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.snapshot
+}
+
+// loadSnapshot reads the files written by the last run into memory and
+// keeps its database and sets for lookups.
+func (g *geoIPGenerator) loadSnapshot(asn *maxminddb.Reader) (*fileSnapshot, error) {
+	snapshot := &fileSnapshot{
+		files:   make(map[string]*servedFile),
+		modTime: time.Now().UTC().Truncate(time.Second),
+		lookup:  g.newLookupData(asn),
+	}
+	m := manifest{
+		DatabaseType: g.metadata.DatabaseType,
+		BuildEpoch:   g.metadata.BuildEpoch,
+		Generated:    snapshot.modTime,
+	}
+
+	files, err := g.relativeOutputs()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range files {
+		content, err := os.ReadFile(filepath.Join(g.cfg.OutputDir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := newServedFile(content, contentType(path.Ext(name)))
+		if err != nil {
+			return nil, err
+		}
+		snapshot.files[name] = file
+
+		sum := sha256.Sum256(content)
+		m.Files = append(m.Files, manifestFile{Path: name, Size: len(content), SHA256: hex.EncodeToString(sum[:])})
+	}
+
+	if g.stats != nil {
+		m.Stats = g.stats.Sets
+	}
+	snapshot.info = m
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.manifest, err = newServedFile(data, "application/json"); err != nil {
+		return nil, err
+	}
+	if g.cfg.Sign != "" {
+		sig, err := g.signBytes(data, "manifest.json")
+		if err != nil {
+			return nil, fmt.Errorf("signing manifest: %w", err)
+		}
+		if snapshot.manifestSig, err = newServedFile(sig, contentType(signatureExt(g.cfg.Sign))); err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+func newServedFile(content []byte, contentType string) (*servedFile, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	return &servedFile{
+		content:     content,
+		gzipped:     buf.Bytes(),
+		etag:        hex.EncodeToString(sum[:16]),
+		contentType: contentType,
+	}, nil
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	snapshot := s.current()
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	file := snapshot.files[name]
+	switch {
+	case name == "manifest.json":
+		file = snapshot.manifest
+	case snapshot.manifestSig != nil && name == "manifest.json"+signatureExt(s.cfg.Sign):
+		file = snapshot.manifestSig
+	}
+	if file == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, etag := file.content, file.etag
+	h := w.Header()
+	h.Set("Vary", "Accept-Encoding")
+	if acceptsGzip(r) && len(file.gzipped) < len(file.content) {
+		// Each encoding is a different representation with its own tag
+		body, etag = file.gzipped, etag+"-gzip"
+		h.Set("Content-Encoding", "gzip")
+	}
+	h.Set("Content-Type", file.contentType)
+	h.Set("Cache-Control", s.cacheControl())
+	h.Set("ETag", `"`+etag+`"`)
+
+	http.ServeContent(w, r, name, snapshot.modTime, bytes.NewReader(body))
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// gzip;q=0 explicitly refuses the encoding
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// authRealm is announced to HTTP clients failing -auth-user
+const authRealm = "maxminddb-to-nft"
+
+// newServeTLS returns the TLS configuration of serve: the -tls-cert and
+// -tls-key files, or certificates obtained over ACME for -acme-domains.
+// It is nil when serve uses plain HTTP.
+func newServeTLS(cfg config) (*tls.Config, error) {
+	switch {
+	case len(cfg.ACMEDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+			Cache:      autocert.DirCache(cfg.ACMECache),
+			Email:      cfg.ACMEEmail,
+		}
+		// Answers the tls-alpn-01 challenges on the listener itself
+		return manager.TLSConfig(), nil
+	case cfg.TLSCert != "":
+		cert := &certFile{certPath: cfg.TLSCert, keyPath: cfg.TLSKey}
+		if _, err := cert.get(nil); err != nil {
+			return nil, err
+		}
+		return &tls.Config{GetCertificate: cert.get, MinVersion: tls.VersionTLS12}, nil
+	}
+	return nil, nil
+}
+
+// certFile loads a certificate and key pair again once the certificate
+// file changed, so that a renewal by certbot or similar needs no restart.
+type certFile struct {
+	certPath, keyPath string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (c *certFile) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := os.Stat(c.certPath)
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("reading TLS certificate: %w", err)
+	}
+	if c.cert != nil && info.ModTime().Equal(c.modTime) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		if c.cert != nil {
+			// Likely caught between writing the certificate and the key
+			slog.Warn("Reloading TLS certificate failed, keeping the previous one", "error", err)
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	if c.cert != nil {
+		slog.Info("Reloaded TLS certificate", "path", c.certPath)
+	}
+	c.cert, c.modTime = &cert, info.ModTime()
+	return c.cert, nil
+}
+
+// serveGuard authenticates the requests to serve and limits their rate per
+// client address. /healthz and /readyz stay open for probes.
+type serveGuard struct {
+	// SHA-256 of the accepted Authorization header values, compared in
+	// constant time
+	credentials [][sha256.Size]byte
+	basic       bool
+	limiter     *clientLimiter
+}
+
+func newServeGuard(cfg config) *serveGuard {
+	g := &serveGuard{basic: len(cfg.AuthUsers) > 0}
+	for _, token := range cfg.AuthTokens {
+		g.credentials = append(g.credentials, sha256.Sum256([]byte("Bearer "+token)))
+	}
+	for _, user := range cfg.AuthUsers {
+		g.credentials = append(g.credentials,
+			sha256.Sum256([]byte("Basic "+base64.StdEncoding.EncodeToString([]byte(user)))))
+	}
+	if cfg.ServeRateLimit != "" {
+		// Validated with the configuration
+		g.limiter, _ = newClientLimiter(cfg.ServeRateLimit)
+	}
+	return g
+}
+
+// authorized reports whether the Authorization header value carries one
+// of the -auth-token or -auth-user credentials, always true without any.
+func (g *serveGuard) authorized(header string) bool {
+	if len(g.credentials) == 0 {
+		return true
+	}
+	sum := sha256.Sum256([]byte(header))
+	ok := 0
+	for _, c := range g.credentials {
+		ok |= subtle.ConstantTimeCompare(sum[:], c[:])
+	}
+	return ok == 1
+}
+
+// handler wraps next with the rate limit and the authentication.
+func (g *serveGuard) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if wait := g.limiter.allow(clientAddr(r.RemoteAddr)); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		if !g.authorized(r.Header.Get("Authorization")) {
+			if g.basic {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", authRealm))
+			} else {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// check applies the rate limit and the authentication to a gRPC call.
+func (g *serveGuard) check(ctx context.Context) error {
+	if p, ok := peer.FromContext(ctx); ok {
+		if wait := g.limiter.allow(clientAddr(p.Addr.String())); wait > 0 {
+			return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %s", wait.Round(time.Millisecond))
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if !g.authorized(strings.Join(md.Get("authorization"), "")) {
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return nil
+}
+
+func (g *serveGuard) unaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := g.check(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (g *serveGuard) streamInterceptor(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := g.check(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// clientAddr returns the host of a remote address. Requests passed on by
+// a reverse proxy all count as the proxy.
+func clientAddr(remote string) string {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+	return host
+}
+
+// clientLimiter is a token bucket per client address for
+// -serve-rate-limit. A limit like 60/minute lets a client send up to 60
+// requests at once and then one per second.
+type clientLimiter struct {
+	burst float64
+	// Tokens added per second
+	rate float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var ratePeriods = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
+
+func newClientLimiter(limit string) (*clientLimiter, error) {
+	if !rateLimitRate.MatchString(limit) {
+		return nil, fmt.Errorf("invalid rate %q, must be like 100/minute", limit)
+	}
+	count, period, _ := strings.Cut(limit, "/")
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate %q: %w", limit, err)
+	}
+	return &clientLimiter{
+		burst:   float64(n),
+		rate:    float64(n) / ratePeriods[period].Seconds(),
+		buckets: make(map[string]*bucket),
+	}, nil
+}
+
+// allow takes a token of client and returns 0, or how long to wait for
+// the next token when there is none. A nil limiter allows everything.
+func (l *clientLimiter) allow(client string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+	b := l.buckets[client]
+	if b == nil {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// sweep drops the buckets that filled up again, at most once a minute, so
+// that the map does not grow with every client ever seen.
+func (l *clientLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// guardedServer serves 200 to every request passing the guard of args.
+func guardedServer(t *testing.T, args ...string) *httptest.Server {
+	t.Helper()
+
+	cfg, err := parseFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	srv := httptest.NewServer(newServeGuard(cfg).handler(ok))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// get requests path and returns the response with the body closed.
+func get(t *testing.T, srv *httptest.Server, path string, header http.Header) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), "GET", srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestServeGuardAuth(t *testing.T) {
+	bearer := http.Header{"Authorization": {"Bearer secret"}}
+	basic := http.Header{"Authorization": {"Basic YWxpY2U6c2VjcmV0"}} // alice:secret
+	wrong := http.Header{"Authorization": {"Bearer wrong"}}
+
+	tests := []struct {
+		name          string
+		args          []string
+		path          string
+		header        http.Header
+		wantStatus    int
+		wantChallenge string
+	}{
+		{"no credentials configured", nil, "/geoip_ipv4.nft", nil, http.StatusOK, ""},
+		{"token", []string{"-auth-token", "secret"}, "/geoip_ipv4.nft", bearer, http.StatusOK, ""},
+		{"missing token", []string{"-auth-token", "secret"}, "/geoip_ipv4.nft", nil, http.StatusUnauthorized, "Bearer"},
+		{"wrong token", []string{"-auth-token", "secret"}, "/geoip_ipv4.nft", wrong, http.StatusUnauthorized, "Bearer"},
+		{"user", []string{"-auth-user", "alice:secret"}, "/geoip_ipv4.nft", basic, http.StatusOK, ""},
+		{"token with users", []string{"-auth-user", "alice:secret", "-auth-token", "secret"}, "/lookup", bearer, http.StatusOK, ""},
+		{"missing user", []string{"-auth-user", "alice:secret"}, "/geoip_ipv4.nft", nil, http.StatusUnauthorized, `Basic realm="maxminddb-to-nft"`},
+		{"wrong user", []string{"-auth-user", "alice:secret"}, "/geoip_ipv4.nft", wrong, http.StatusUnauthorized, `Basic realm="maxminddb-to-nft"`},
+		{"healthz", []string{"-auth-token", "secret"}, "/healthz", nil, http.StatusOK, ""},
+		{"readyz", []string{"-auth-user", "alice:secret"}, "/readyz", nil, http.StatusOK, ""},
+		{"below healthz", []string{"-auth-token", "secret"}, "/healthz/x", nil, http.StatusUnauthorized, "Bearer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := get(t, guardedServer(t, tt.args...), tt.path, tt.header)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestServeGuardRateLimit(t *testing.T) {
+	srv := guardedServer(t, "-serve-rate-limit", "2/minute", "-auth-token", "secret")
+	bearer := http.Header{"Authorization": {"Bearer secret"}}
+
+	for i := range 2 {
+		if resp := get(t, srv, "/geoip_ipv4.nft", bearer); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i+1, resp.StatusCode, http.StatusOK)
+		}
+	}
+
+	// Limited before the authentication, so that guessing credentials
+	// counts as well
+	for _, header := range []http.Header{bearer, nil} {
+		resp := get(t, srv, "/geoip_ipv4.nft", header)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+		}
+		if got := resp.Header.Get("Retry-After"); got != "30" {
+			t.Errorf("Retry-After = %q, want 30", got)
+		}
+	}
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if resp := get(t, srv, path, nil); resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d", path, resp.StatusCode, http.StatusOK)
+		}
+	}
+}
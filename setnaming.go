@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// Schemes of -set-naming
+const (
+	setNamingAlpha2  = "alpha2"
+	setNamingAlpha3  = "alpha3"
+	setNamingNumeric = "numeric"
+)
+
+// setNamesFile maps the set names to the country codes, written with a
+// -set-naming other than alpha2.
+const setNamesFile = "set_names.csv"
+
+// setName returns the name of the set of code under naming. nft names
+// cannot start with a digit, so numeric names are prefixed, like
+// country_840. Sets that are not countries, like the -bogon-set, and codes
+// without a code of the scheme keep their name.
+func setName(naming, code string) string {
+	info, ok := lookupCountry(code)
+	switch {
+	case !ok:
+		return code
+	case naming == setNamingAlpha3 && info.Alpha3 != "":
+		return info.Alpha3
+	case naming == setNamingNumeric && info.Numeric != "":
+		return "country_" + info.Numeric
+	}
+	return code
+}
+
+// setName returns the name the set of code is written with.
+func (g *geoIPGenerator) setName(code string) string {
+	return setName(g.cfg.SetNaming, code)
+}
+
+// setNameCodes maps the set names of every known country under naming to
+// their alpha-2 codes.
+func setNameCodes(naming string) map[string]string {
+	codes := make(map[string]string)
+	for _, table := range []map[string]countryInfo{iso3166Countries, userAssignedCountries} {
+		for code := range table {
+			codes[setName(naming, code)] = code
+		}
+	}
+	return codes
+}
+
+// setNamesArtifacts returns set_names.csv, listing every generated country
+// set with its alpha-2, alpha-3 and numeric code.
+func (g *geoIPGenerator) setNamesArtifacts() []artifact {
+	if g.cfg.SetNaming == setNamingAlpha2 {
+		return nil
+	}
+	names := g.countryNames()
+	return []artifact{{path: setNamesFile, render: func(w io.Writer) error {
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"set", "code", "alpha3", "numeric", "name"})
+		for _, n := range names {
+			info, ok := lookupCountry(n.Code)
+			if !ok {
+				continue
+			}
+			cw.Write([]string{g.setName(n.Code), n.Code, info.Alpha3, info.Numeric, info.Name})
+		}
+		cw.Flush()
+		return cw.Error()
+	}}}
+}
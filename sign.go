@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Signers of -sign
+const (
+	signMinisign = "minisign"
+	signGPG      = "gpg"
+)
+
+// signatureExt returns the extension of the detached signatures of
+// signer.
+func signatureExt(signer string) string {
+	if signer == signGPG {
+		return ".asc"
+	}
+	return ".minisig"
+}
+
+// signOutputs writes a detached signature next to every output. The
+// signatures become outputs themselves, so they are published and served
+// along with the files.
+func (g *geoIPGenerator) signOutputs() error {
+	files := append([]string(nil), g.outputs...)
+	for _, file := range files {
+		sig, err := g.signFile(file, filepath.Base(file))
+		if err != nil {
+			return fmt.Errorf("signing %s: %w", file, err)
+		}
+		if err := g.adoptOutput(sig); err != nil {
+			return err
+		}
+		g.outputs = append(g.outputs, sig)
+	}
+	slog.Info("Signed outputs", "files", len(files), "signer", g.cfg.Sign)
+	return nil
+}
+
+// signFile signs path with -sign-key and returns the signature path. name
+// is the file name recorded in the trusted comment of minisign.
+func (g *geoIPGenerator) signFile(path, name string) (string, error) {
+	sig := path + signatureExt(g.cfg.Sign)
+
+	var cmd *exec.Cmd
+	switch g.cfg.Sign {
+	case signMinisign:
+		// Automation needs a key without password, see minisign -G -W
+		cmd = exec.CommandContext(g.ctx, "minisign", "-S", "-s", g.cfg.SignKey, "-m", path, "-x", sig,
+			"-t", fmt.Sprintf("timestamp:%d\tfile:%s", time.Now().Unix(), name))
+	case signGPG:
+		cmd = exec.CommandContext(g.ctx, "gpg", "--batch", "--yes", "--detach-sign", "--armor",
+			"--local-user", g.cfg.SignKey, "--output", sig, path)
+	default:
+		return "", fmt.Errorf("unknown signer %q", g.cfg.Sign)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return sig, nil
+}
+
+// signBytes returns the detached signature of data named name, for
+// content that only exists in memory such as the manifest of serve.
+func (g *geoIPGenerator) signBytes(data []byte, name string) ([]byte, error) {
+	f, err := os.CreateTemp("", "geoip-sign-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := g.signFile(f.Name(), name)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(sig)
+	return os.ReadFile(sig)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/netip"
+	"os"
+)
+
+// skipReport writes every skipped network with the reason to a CSV file.
+// The file is written under a temporary name until the report is closed.
+// A nil report discards everything.
+type skipReport struct {
+	f    *os.File
+	w    *csv.Writer
+	path string
+	done bool
+	// Gives the completed file the output mode and owner
+	adopt func(path string) error
+}
+
+func (g *geoIPGenerator) openSkipReport(path string) (*skipReport, error) {
+	perm, _ := g.cfg.outputFileMode()
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, fmt.Errorf("creating skip report %s: %w", path, err)
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"network", "reason", "detail"})
+
+	return &skipReport{f: f, w: w, path: path, adopt: g.adoptOutput}, nil
+}
+
+func (r *skipReport) add(prefix netip.Prefix, reason, detail string) {
+	if r == nil {
+		return
+	}
+	r.w.Write([]string{prefix.String(), reason, detail})
+}
+
+// close completes the report.
+func (r *skipReport) close() error {
+	if r == nil || r.done {
+		return nil
+	}
+	r.done = true
+
+	r.w.Flush()
+	err := r.w.Error()
+	if closeErr := r.f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = r.adopt(r.f.Name())
+	}
+	if err == nil {
+		err = os.Rename(r.f.Name(), r.path)
+	}
+	if err != nil {
+		os.Remove(r.f.Name())
+	}
+	return err
+}
+
+// abort discards the report of a failed load, unless it was completed.
+func (r *skipReport) abort() {
+	if r == nil || r.done {
+		return
+	}
+	r.done = true
+	r.f.Close()
+	os.Remove(r.f.Name())
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+	"github.com/oschwald/maxminddb-golang/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+// Policies of -source-failure
+const (
+	sourceFailureAbort = "abort"
+	sourceFailureSkip  = "skip"
+)
+
+// sources are the inputs of a run once fetched and parsed.
+type sources struct {
+	db     *maxminddb.Reader
+	schema geonft.Schema
+	// Entries of every -geofeed in configuration order, nil for a feed
+	// skipped by -source-failure skip
+	geofeeds [][]geofeedEntry
+	// The -asn-input database when the generator opens it, see openASN
+	asn *maxminddb.Reader
+}
+
+// close releases the databases of partly fetched sources.
+func (s *sources) close() {
+	if s.db != nil {
+		s.db.Close()
+	}
+	if s.asn != nil {
+		s.asn.Close()
+	}
+}
+
+// fetchSources downloads and parses the sources of the generator
+// concurrently, at most -source-concurrency at once.
+func (g *geoIPGenerator) fetchSources() (sources, error) {
+	group, ctx := errgroup.WithContext(g.ctx)
+	group.SetLimit(g.cfg.SourceConcurrency)
+	s := g.goFetchSources(ctx, group)
+	if err := group.Wait(); err != nil {
+		s.close()
+		return sources{}, err
+	}
+	return *s, nil
+}
+
+// goFetchSources starts fetching the database, the -geofeed sources and,
+// with openASN, the -asn-input database in group and returns the sources
+// filled in once the group is done. With -source-failure abort the first
+// failure cancels the other fetches and fails the run, with skip a failed
+// geofeed is logged and left out. The databases are always required.
+func (g *geoIPGenerator) goFetchSources(ctx context.Context, group *errgroup.Group) *sources {
+	s := &sources{geofeeds: make([][]geofeedEntry, len(g.cfg.Geofeeds))}
+
+	group.Go(func() (err error) {
+		s.db, s.schema, err = g.openDatabase(ctx)
+		return err
+	})
+	if g.openASN {
+		group.Go(func() (err error) {
+			s.asn, err = g.openASNDatabase()
+			return err
+		})
+	}
+	for i, source := range g.cfg.Geofeeds {
+		group.Go(func() error {
+			entries, err := g.loadGeofeed(ctx, source)
+			if err != nil {
+				// A feed cancelled by the failure of another source is
+				// not skipped, it did not fail
+				if g.cfg.SourceFailure == sourceFailureSkip && ctx.Err() == nil {
+					slog.Warn("Skipping failed geofeed", "source", source, "error", err)
+					return nil
+				}
+				return fmt.Errorf("loading geofeed %s: %w", source, err)
+			}
+			slog.Info("Loaded geofeed", "entries", len(entries), "source", source)
+			s.geofeeds[i] = entries
+			return nil
+		})
+	}
+	return s
+}
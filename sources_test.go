@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kkrow/maxminddb-to-nft/internal/mmdbfixture"
+)
+
+// captureLog collects the log records of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestFetchSourcesSkip(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	// Answers once the request is cancelled
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "fixture.mmdb")
+	writeFixture(t, input, mmdbfixture.Options{})
+
+	tests := []struct {
+		name    string
+		input   string
+		feed    string
+		wantErr bool
+		wantLog bool
+	}{
+		{"failed geofeed", input, failing.URL, false, true},
+		{"cancelled geofeed", filepath.Join(dir, "missing.mmdb"), hanging.URL, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := captureLog(t)
+			cfg, err := parseFlags([]string{"-input", tt.input, "-geofeed", tt.feed, "-source-failure", "skip"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			src, err := newGeoIPGenerator(t.Context(), cfg).fetchSources()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchSources() error = %v, want error %t", err, tt.wantErr)
+			}
+			src.close()
+			if got := strings.Contains(log.String(), "Skipping failed geofeed"); got != tt.wantLog {
+				t.Errorf("skip logged = %t, want %t\n%s", got, tt.wantLog, log)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"slices"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// prefixSpool keeps the elements of every set in a temporary file while
+// the database is read with -stream, so that memory does not grow with
+// the database. Each file holds the comma separated elements of one set
+// of one family in the syntax of -format, ready to be copied into the
+// files.
+type prefixSpool struct {
+	dir   string
+	files map[string]map[string]*spoolFile // by family and set
+	buf   []byte
+	json  bool
+	// IPv4-mapped networks by set, sorted, waiting for the native IPv4
+	// networks to reach their address
+	mapped map[string][]netip.Prefix
+}
+
+type spoolFile struct {
+	f     *os.File
+	w     *bufio.Writer
+	count int
+	// Last prefix written, the ones it contains are left out
+	last netip.Prefix
+}
+
+func newPrefixSpool(format string) (*prefixSpool, error) {
+	dir, err := os.MkdirTemp("", "geoip-spool-*")
+	if err != nil {
+		return nil, err
+	}
+	return &prefixSpool{
+		dir:    dir,
+		files:  map[string]map[string]*spoolFile{"ipv4": {}, "ipv6": {}},
+		json:   format == formatNFTJSON,
+		mapped: make(map[string][]netip.Prefix),
+	}, nil
+}
+
+func (s *prefixSpool) path(family, code string) string {
+	return filepath.Join(s.dir, family+"_"+code)
+}
+
+// add appends p to the set code. The networks must come in address order.
+// IPv4 ones are interleaved with the mapped networks of the set.
+func (s *prefixSpool) add(code string, p netip.Prefix) error {
+	if !p.Addr().Is4() {
+		return s.write("ipv6", code, p)
+	}
+
+	pending := s.mapped[code]
+	for len(pending) > 0 && comparePrefixes(pending[0], p) <= 0 {
+		if err := s.write("ipv4", code, pending[0]); err != nil {
+			return err
+		}
+		pending = pending[1:]
+	}
+	s.mapped[code] = pending
+	return s.write("ipv4", code, p)
+}
+
+// addMapped merges the IPv4-mapped networks of the set code into the
+// native IPv4 ones spooled afterwards. Duplicates and prefixes contained in
+// another one of the set are dropped, like MergeOverlaps does in memory.
+func (s *prefixSpool) addMapped(code string, prefixes []netip.Prefix) {
+	s.mapped[code] = geonft.MergePrefixes(append(s.mapped[code], prefixes...))
+}
+
+// comparePrefixes orders prefixes like geonft.SortPrefixes.
+func comparePrefixes(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Bits(), b.Bits())
+}
+
+func (s *prefixSpool) write(family, code string, p netip.Prefix) error {
+	file := s.files[family][code]
+	if file == nil {
+		f, err := os.Create(s.path(family, code))
+		if err != nil {
+			return err
+		}
+		file = &spoolFile{f: f, w: bufio.NewWriter(f)}
+		s.files[family][code] = file
+	}
+	if file.last.IsValid() && file.last.Bits() <= p.Bits() && file.last.Contains(p.Addr()) {
+		return nil
+	}
+	file.last = p
+
+	s.buf = s.buf[:0]
+	if file.count > 0 {
+		s.buf = append(s.buf, ", "...)
+	}
+	file.count++
+	if s.json {
+		s.buf = geonft.AppendJSONElement(s.buf, p)
+	} else {
+		s.buf = p.AppendTo(s.buf)
+	}
+	_, err := file.w.Write(s.buf)
+	return err
+}
+
+// finish writes the remaining mapped networks, then flushes and closes
+// the files. The spool is read only afterwards.
+func (s *prefixSpool) finish() error {
+	for _, code := range slices.Sorted(maps.Keys(s.mapped)) {
+		for _, p := range s.mapped[code] {
+			if err := s.write("ipv4", code, p); err != nil {
+				return fmt.Errorf("writing spool: %w", err)
+			}
+		}
+	}
+	clear(s.mapped)
+
+	for _, family := range s.files {
+		for _, file := range family {
+			err := file.w.Flush()
+			if closeErr := file.f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("writing spool: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// codes returns the sets of family in consistent order.
+func (s *prefixSpool) codes(family string) []string {
+	return slices.Sorted(maps.Keys(s.files[family]))
+}
+
+// copyTo writes the elements of the set code of family to w.
+func (s *prefixSpool) copyTo(w io.Writer, family, code string) error {
+	f, err := os.Open(s.path(family, code))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// remove deletes the spool. It accepts a nil spool.
+func (s *prefixSpool) remove() {
+	if s != nil {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// spooledArtifacts lists the files of a -stream run, rendered from the
+// spool instead of the sets in memory.
+func (g *geoIPGenerator) spooledArtifacts() []artifact {
+	var list []artifact
+	for _, family := range g.cfg.Families {
+		list = append(list, artifact{
+			path: fmt.Sprintf("geoip_%s%s", family, g.cfg.setFileExt()),
+			render: func(w io.Writer) error {
+				return g.writeNFTFile(w, func(w io.Writer) error {
+					for _, code := range g.spool.codes(family) {
+						if err := g.writeSpooledSet(w, family, code); err != nil {
+							return fmt.Errorf("writing NFT set for %s: %w", code, err)
+						}
+					}
+					return nil
+				})
+			},
+		})
+	}
+
+	for _, family := range []string{"ipv4", "ipv6"} {
+		for _, code := range g.spool.codes(family) {
+			list = append(list, artifact{
+				path: g.countryFile(code, family),
+				render: func(w io.Writer) error {
+					return g.writeNFTFile(w, func(w io.Writer) error {
+						return g.writeSpooledSet(w, family, code)
+					})
+				},
+			})
+		}
+	}
+
+	list = append(list, g.setNamesArtifacts()...)
+	return append(list, g.namesArtifacts()...)
+}
+
+func (g *geoIPGenerator) writeSpooledSet(w io.Writer, family, code string) error {
+	return g.writeNFTSetWith(w, code, family, func(w io.Writer) error {
+		return g.spool.copyTo(w, family, code)
+	})
+}
+
+// setSizes returns the number of prefixes of every set by family, from the
+// sets in memory or, with -stream, from the spool.
+func (g *geoIPGenerator) setSizes() map[string]map[string]int {
+	sizes := map[string]map[string]int{"ipv4": {}, "ipv6": {}}
+	if g.spool != nil {
+		for family, files := range g.spool.files {
+			for code, file := range files {
+				sizes[family][code] = file.count
+			}
+		}
+		return sizes
+	}
+
+	for family, countryMap := range map[string]geonft.Sets{"ipv4": g.ipv4, "ipv6": g.ipv6} {
+		for code, prefixes := range countryMap {
+			sizes[family][code] = prefixes.Len()
+		}
+	}
+	return sizes
+}
+
+// spoolNetwork adds a loaded network to the spool. Overly broad prefixes
+// are excluded here, as guardBroadPrefixes only sees the sets in memory.
+func (g *geoIPGenerator) spoolNetwork(code string, p netip.Prefix) error {
+	if g.tooBroad(code, p) {
+		return nil
+	}
+	if err := g.spool.add(code, p); err != nil {
+		return fmt.Errorf("spooling %s: %w", p, err)
+	}
+	return nil
+}
+
+// spoolMapped hands the IPv4-mapped networks loaded so far to the spool,
+// which merges them into the native IPv4 networks as those are spooled.
+func (g *geoIPGenerator) spoolMapped() {
+	for code, prefixes := range g.mapped {
+		var kept []netip.Prefix
+		for p := range prefixes.All() {
+			if !g.tooBroad(code, p) {
+				kept = append(kept, p)
+			}
+		}
+		g.spool.addMapped(code, kept)
+	}
+	clear(g.mapped)
+}
+
+// tooBroad reports whether p is below the prefix floor of its family.
+func (g *geoIPGenerator) tooBroad(code string, p netip.Prefix) bool {
+	minBits := g.cfg.MinPrefixIPv6
+	if p.Addr().Is4() {
+		minBits = g.cfg.MinPrefixIPv4
+	}
+	if p.Bits() == 0 || p.Bits() < minBits {
+		slog.Warn("Excluding overly broad prefix", "prefix", p, "set", code, "floor", minBits)
+		return true
+	}
+	return false
+}
+
+// Networks loaded between two checks of the heap against -max-memory
+const spillCheckInterval = 1 << 14
+
+// spillOverLimit moves the sets to a new spool once the heap reaches half
+// of -max-memory, leaving the rest for garbage collection and writing. The
+// sets of the merged shards are spooled before the ones of s, the shard
+// being loaded, to keep the address order. The IPv4-mapped networks are
+// handed to the spool first and stay in memory while s holds them.
+func (g *geoIPGenerator) spillOverLimit(s *loadShard) error {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	heap := sample[0].Value.Uint64()
+	if heap < uint64(g.cfg.MaxMemory)/2 {
+		return nil
+	}
+
+	slog.Warn("Memory limit reached, spilling the sets to temporary files",
+		"heap_bytes", heap, "max_memory", g.cfg.MaxMemory.String())
+	spool, err := newPrefixSpool(g.cfg.Format)
+	if err != nil {
+		return fmt.Errorf("creating spool: %w", err)
+	}
+	g.spool = spool
+	g.spoolMapped()
+
+	spilled := []geonft.Sets{g.ipv4, g.ipv6, s.ipv4, s.ipv6}
+	if s.ipv4Mapped() {
+		spilled = spilled[:2]
+	}
+	for _, countryMap := range spilled {
+		for _, code := range sortedCodes(countryMap) {
+			for p := range countryMap[code].All() {
+				if err := g.spoolNetwork(code, p); err != nil {
+					return err
+				}
+			}
+			delete(countryMap, code)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// runState is the compact snapshot of a run kept to diff against the next one.
+type runState struct {
+	BuildEpoch uint                `json:"build_epoch"`
+	Generated  time.Time           `json:"generated"`
+	IPv4       map[string][]string `json:"ipv4"`
+	IPv6       map[string][]string `json:"ipv6"`
+}
+
+func (g *geoIPGenerator) snapshot() *runState {
+	return &runState{
+		BuildEpoch: g.metadata.BuildEpoch,
+		Generated:  time.Now().UTC(),
+		IPv4:       prefixStrings(g.ipv4),
+		IPv6:       prefixStrings(g.ipv6),
+	}
+}
+
+func prefixStrings(countryMap geonft.Sets) map[string][]string {
+	out := make(map[string][]string, len(countryMap))
+	for code, prefixes := range countryMap {
+		list := make([]string, 0, prefixes.Len())
+		for p := range prefixes.All() {
+			list = append(list, p.String())
+		}
+		out[code] = list
+	}
+	return out
+}
+
+// loadState reads a gzipped state snapshot. A missing file yields nil.
+func loadState(path string) (*runState, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("gzip reader: %w", err)
+	}
+	defer gz.Close()
+
+	var state runState
+	if err := json.NewDecoder(gz).Decode(&state); err != nil {
+		return nil, fmt.Errorf("decoding state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// saveState writes the snapshot atomically so that an interrupted run
+// never leaves a truncated state behind.
+func (g *geoIPGenerator) saveState(path string, state *runState) error {
+	return g.writeOutput(path, func(w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		if err := json.NewEncoder(gz).Encode(state); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"path/filepath"
+	"sort"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// statsFile is written to the output directory with -stats.
+const statsFile = "stats.json"
+
+// setStats describes one set of one family. Address counts are decimal
+// strings, IPv6 counts exceed 64 bits.
+type setStats struct {
+	Family    string `json:"family"`
+	Code      string `json:"code"`
+	Prefixes  int    `json:"prefixes"`
+	Addresses string `json:"addresses"`
+	// Percentage of all addresses of the family assigned to a set
+	Share float64 `json:"share"`
+	// Changes against the previous run, only with -state-file
+	PrefixDelta  *int   `json:"prefix_delta,omitempty"`
+	AddressDelta string `json:"address_delta,omitempty"`
+}
+
+type runStats struct {
+	BuildEpoch         uint       `json:"build_epoch"`
+	PreviousBuildEpoch uint       `json:"previous_build_epoch,omitempty"`
+	Sets               []setStats `json:"sets"`
+}
+
+// computeStats summarizes the current sets, with deltas against prev when
+// a previous state exists. The -bogon-set is listed but does not count as
+// routed space.
+func (g *geoIPGenerator) computeStats(prev *runState) *runStats {
+	stats := &runStats{BuildEpoch: g.metadata.BuildEpoch}
+	var prevIPv4, prevIPv6 map[string][]string
+	if prev != nil {
+		stats.PreviousBuildEpoch = prev.BuildEpoch
+		prevIPv4, prevIPv6 = prev.IPv4, prev.IPv6
+	}
+
+	for _, family := range []struct {
+		name       string
+		countryMap geonft.Sets
+		previous   map[string][]string
+	}{{"ipv4", g.ipv4, prevIPv4}, {"ipv6", g.ipv6, prevIPv6}} {
+		counts := make(map[string]*big.Int)
+		routed := new(big.Int)
+		for code, prefixes := range family.countryMap {
+			counts[code] = new(big.Int)
+			for p := range prefixes.All() {
+				counts[code].Add(counts[code], geonft.PrefixSize(p))
+			}
+			if code != g.cfg.BogonSet {
+				routed.Add(routed, counts[code])
+			}
+		}
+
+		codes := sortedCodes(family.countryMap)
+		// Sets that disappeared since the previous run
+		for code := range family.previous {
+			if _, ok := family.countryMap[code]; !ok {
+				codes = append(codes, code)
+				counts[code] = new(big.Int)
+			}
+		}
+		sort.Strings(codes)
+
+		for _, code := range codes {
+			s := setStats{
+				Family:    family.name,
+				Code:      code,
+				Prefixes:  family.countryMap[code].Len(),
+				Addresses: counts[code].String(),
+			}
+			if routed.Sign() > 0 && code != g.cfg.BogonSet {
+				share, _ := new(big.Float).Quo(new(big.Float).SetInt(counts[code]), new(big.Float).SetInt(routed)).Float64()
+				s.Share = share * 100
+			}
+			if prev != nil {
+				delta := s.Prefixes - len(family.previous[code])
+				s.PrefixDelta = &delta
+				s.AddressDelta = new(big.Int).Sub(counts[code], addressCountOf(family.previous[code])).String()
+			}
+			stats.Sets = append(stats.Sets, s)
+		}
+	}
+
+	return stats
+}
+
+// writeStats writes stats.json next to the other outputs.
+func (g *geoIPGenerator) writeStats(prev *runState) error {
+	g.stats = g.computeStats(prev)
+	data, err := json.MarshalIndent(g.stats, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(g.cfg.OutputDir, statsFile)
+	if err := g.writeOutput(filename, func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return err
+	}); err != nil {
+		return err
+	}
+	g.outputs = append(g.outputs, filename)
+	slog.Info("Generated file", "path", filename)
+	return nil
+}
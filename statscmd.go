@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// Orders of -sort
+const (
+	statsSortAddresses = "addresses"
+	statsSortPrefixes  = "prefixes"
+)
+
+// printStats prints a table of the sets of one family, sorted by -sort
+// and cut to -top rows. -fewer-than keeps only sets with fewer prefixes.
+// The sets come from the database, or from a stats.json or manifest.json
+// with -stats-input.
+func (g *geoIPGenerator) printStats() error {
+	sets, err := g.loadStats()
+	if err != nil {
+		return err
+	}
+
+	var rows []setStats
+	addresses := make(map[string]*big.Int)
+	for _, s := range sets {
+		if s.Family != g.cfg.StatsFamily || s.Prefixes == 0 {
+			continue
+		}
+		if g.cfg.FewerThan > 0 && s.Prefixes >= g.cfg.FewerThan {
+			continue
+		}
+		n, ok := new(big.Int).SetString(s.Addresses, 10)
+		if !ok {
+			return fmt.Errorf("invalid address count %q of %s", s.Addresses, s.Code)
+		}
+		addresses[s.Code] = n
+		rows = append(rows, s)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if g.cfg.StatsSort == statsSortPrefixes && a.Prefixes != b.Prefixes {
+			return a.Prefixes > b.Prefixes
+		}
+		if c := addresses[a.Code].Cmp(addresses[b.Code]); c != 0 {
+			return c > 0
+		}
+		return a.Code < b.Code
+	})
+	if g.cfg.Top > 0 && len(rows) > g.cfg.Top {
+		rows = rows[:g.cfg.Top]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tSET\tNAME\tPREFIXES\tADDRESSES\tSHARE %")
+	for i, s := range rows {
+		name := ""
+		if info, ok := lookupCountry(s.Code); ok {
+			name = info.Name
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%.2f\n", i+1, s.Code, name, s.Prefixes, s.Addresses, s.Share)
+	}
+	return w.Flush()
+}
+
+func (g *geoIPGenerator) loadStats() ([]setStats, error) {
+	if g.cfg.StatsInput == "" {
+		if err := g.prepare(); err != nil {
+			return nil, err
+		}
+		return g.computeStats(nil).Sets, nil
+	}
+
+	data, err := os.ReadFile(g.cfg.StatsInput)
+	if err != nil {
+		return nil, err
+	}
+	// stats.json lists the sets under "sets", manifest.json under "stats"
+	var doc struct {
+		Sets  []setStats `json:"sets"`
+		Stats []setStats `json:"stats"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", g.cfg.StatsInput, err)
+	}
+	if len(doc.Sets) == 0 {
+		doc.Sets = doc.Stats
+	}
+	if len(doc.Sets) == 0 {
+		return nil, fmt.Errorf("%s has no statistics, generate it with -stats", g.cfg.StatsInput)
+	}
+	return doc.Sets, nil
+}
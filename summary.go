@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// runSummary is the machine-readable result of a generate run, printed
+// with -json and written to -summary-file.
+type runSummary struct {
+	Status          string                    `json:"status"`
+	Error           string                    `json:"error,omitempty"`
+	Source          string                    `json:"source"`
+	DatabaseType    string                    `json:"database_type,omitempty"`
+	BuildEpoch      uint                      `json:"build_epoch,omitempty"`
+	Started         time.Time                 `json:"started"`
+	DurationSeconds float64                   `json:"duration_seconds"`
+	Phases          []phaseTiming             `json:"phases"`
+	Networks        summaryNetworks           `json:"networks"`
+	Sets            map[string]map[string]int `json:"sets"`
+	Files           []summaryFile             `json:"files"`
+	FilesWritten    int                       `json:"files_written"`
+	FilesSkipped    int                       `json:"files_skipped"`
+	Bytes           int64                     `json:"bytes"`
+	Warnings        []string                  `json:"warnings"`
+}
+
+type summaryNetworks struct {
+	Loaded       int `json:"loaded"`
+	Skipped      int `json:"skipped"`
+	DecodeErrors int `json:"decode_errors"`
+	NoCountry    int `json:"no_country"`
+	Rejected     int `json:"rejected"`
+	Filtered     int `json:"filtered"`
+}
+
+type summaryFile struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// report publishes the outcome of a generate run started at start to the
+// metrics textfile, the webhooks and the run summary, as configured.
+func (g *geoIPGenerator) report(start time.Time, runErr error) {
+	if g.cfg.TextfileDir != "" {
+		if err := g.writeTextfile(start, runErr); err != nil {
+			slog.Error("Failed to write metrics textfile", "error", err)
+		}
+	}
+	g.sendWebhooks(start, runErr)
+
+	if !g.cfg.JSON && g.cfg.SummaryFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(g.summary(start, runErr), "", "  ")
+	if err != nil {
+		slog.Error("Failed to encode run summary", "error", err)
+		return
+	}
+	data = append(data, '\n')
+
+	if g.cfg.JSON {
+		os.Stdout.Write(data)
+	}
+	if g.cfg.SummaryFile != "" {
+		if err := g.writeOutputData(g.cfg.SummaryFile, data); err != nil {
+			slog.Error("Failed to write run summary", "error", err)
+		}
+	}
+}
+
+func (g *geoIPGenerator) summary(start time.Time, runErr error) runSummary {
+	c := g.counters
+	s := runSummary{
+		Status:          "success",
+		Source:          g.cfg.Input,
+		DatabaseType:    g.metadata.DatabaseType,
+		BuildEpoch:      g.metadata.BuildEpoch,
+		Started:         start.UTC(),
+		DurationSeconds: time.Since(start).Seconds(),
+		Phases:          g.phases,
+		Networks: summaryNetworks{
+			Loaded:       c.loaded,
+			Skipped:      c.skipped(),
+			DecodeErrors: c.decodeErrors,
+			NoCountry:    c.noCountry,
+			Rejected:     c.rejected,
+			Filtered:     c.filtered,
+		},
+		Sets:     map[string]map[string]int{"ipv4": {}, "ipv6": {}},
+		Files:    []summaryFile{},
+		Warnings: runWarnings.list(),
+	}
+	if s.Source == "" {
+		s.Source = databaseURL
+	}
+	if runErr != nil {
+		s.Status, s.Error = "failure", runErr.Error()
+	}
+
+	for family, sizes := range g.setSizes() {
+		for code, size := range sizes {
+			// Emptied sets get no per-country file
+			if size == 0 {
+				s.FilesSkipped++
+				continue
+			}
+			s.Sets[family][code] = size
+		}
+	}
+
+	for _, name := range g.outputs {
+		file := summaryFile{Path: name}
+		if info, err := os.Stat(name); err == nil {
+			file.Bytes = info.Size()
+		}
+		s.Files = append(s.Files, file)
+		s.Bytes += file.Bytes
+	}
+	s.FilesWritten = len(s.Files)
+	return s
+}
@@ -0,0 +1,19 @@
+#!/bin/sh
+# Routes the marks of geoip_fwmark.nft, run after loading it
+set -e
+
+# US+CA
+ip rule del fwmark 0x1 table 101 2>/dev/null || true
+ip rule add fwmark 0x1 table 101
+ip route replace default dev wg0 table 101
+ip -6 rule del fwmark 0x1 table 101 2>/dev/null || true
+ip -6 rule add fwmark 0x1 table 101
+ip -6 route replace default dev wg0 table 101
+
+# DE
+ip rule del fwmark 0x2 table 102 2>/dev/null || true
+ip rule add fwmark 0x2 table 102
+ip route replace default via 192.0.2.1 table 102
+ip -6 rule del fwmark 0x2 table 102 2>/dev/null || true
+ip -6 rule add fwmark 0x2 table 102
+ip -6 route replace default via 2001:db8::1 table 102
@@ -0,0 +1,11 @@
+#!/bin/sh
+# Routes the marks of geoip_fwmark.nft, run after loading it
+set -e
+
+# DE
+ip rule del fwmark 0x1 table 101 2>/dev/null || true
+ip rule add fwmark 0x1 table 101
+ip route replace default dev wg0 table 101
+ip -6 rule del fwmark 0x1 table 101 2>/dev/null || true
+ip -6 rule add fwmark 0x1 table 101
+ip -6 route replace default dev wg0 table 101
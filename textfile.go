@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// textfileName is picked up by the node_exporter textfile collector, which
+// ignores files without the .prom extension such as the temporary file.
+const textfileName = "maxminddb_to_nft.prom"
+
+const lastSuccessMetric = "maxminddb_to_nft_last_success_timestamp_seconds"
+
+// writeTextfile writes the metrics of a run started at start into
+// -textfile-dir. The last success time of a failed run is carried over
+// from the previous file.
+func (g *geoIPGenerator) writeTextfile(start time.Time, runErr error) error {
+	path := filepath.Join(g.cfg.TextfileDir, textfileName)
+	now := time.Now()
+
+	lastSuccess := previousMetric(path, lastSuccessMetric)
+	success := 0
+	if runErr == nil {
+		lastSuccess = float64(now.Unix())
+		success = 1
+	}
+
+	var b strings.Builder
+	metric := func(name, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name,
+			strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	metric("maxminddb_to_nft_last_run_success", "Whether the last run succeeded.", float64(success))
+	metric("maxminddb_to_nft_last_run_timestamp_seconds", "Unix time the last run finished.", float64(now.Unix()))
+	metric("maxminddb_to_nft_last_run_duration_seconds", "Duration of the last run.", now.Sub(start).Seconds())
+	if lastSuccess > 0 {
+		metric(lastSuccessMetric, "Unix time of the last successful run.", lastSuccess)
+	}
+
+	// The sets of a failed run may be incomplete
+	if runErr == nil {
+		metric("maxminddb_to_nft_database_build_timestamp_seconds", "Build time of the database.", float64(g.metadata.BuildEpoch))
+		metric("maxminddb_to_nft_output_files", "Files written by the last successful run.", float64(len(g.outputs)))
+
+		fmt.Fprintf(&b, "# HELP maxminddb_to_nft_set_prefixes Prefixes per generated set.\n# TYPE maxminddb_to_nft_set_prefixes gauge\n")
+		sizes := g.setSizes()
+		for _, family := range []string{"ipv4", "ipv6"} {
+			for _, code := range slices.Sorted(maps.Keys(sizes[family])) {
+				fmt.Fprintf(&b, "maxminddb_to_nft_set_prefixes{set=%q,family=%q} %d\n",
+					code, family, sizes[family][code])
+			}
+		}
+	}
+
+	return g.writeOutputData(path, []byte(b.String()))
+}
+
+// previousMetric returns the value of an unlabeled metric in an existing
+// textfile, or 0.
+func previousMetric(path, name string) float64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), name+" "); ok {
+			v, _ := strconv.ParseFloat(value, 64)
+			return v
+		}
+	}
+	return 0
+}
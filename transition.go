@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log/slog"
+	"net/netip"
+
+	"github.com/kkrow/maxminddb-to-nft/pkg/geonft"
+)
+
+// Transition range handling modes
+const (
+	transitionKeep   = "keep"
+	transitionDrop   = "drop"
+	transitionDerive = "derive"
+)
+
+var (
+	prefix6to4   = netip.MustParsePrefix("2002::/16") // RFC 3056
+	prefixTeredo = netip.MustParsePrefix("2001::/32") // RFC 4380
+)
+
+// handleTransitionRanges removes whatever the database attributes inside
+// the 6to4 and Teredo ranges and, in derive mode, maps each country's IPv4
+// space into 2002::/16. Teredo client addresses embed the obfuscated IPv4
+// address in the lowest bits, so they cannot be expressed as prefixes and
+// are always dropped.
+func (g *geoIPGenerator) handleTransitionRanges() {
+	g.ipv6.Subtract(geonft.MergePrefixes([]netip.Prefix{prefixTeredo, prefix6to4}))
+
+	if g.cfg.TransitionRanges != transitionDerive {
+		slog.Info("Dropped 6to4 and Teredo ranges")
+		return
+	}
+
+	derived := 0
+	for code, prefixes := range g.ipv4 {
+		v6 := g.ipv6[code].Unpack()
+		for p := range prefixes.All() {
+			v6 = append(v6, sixToFourPrefix(p))
+		}
+		geonft.SortPrefixes(v6)
+		g.ipv6[code] = geonft.PackPrefixes(v6)
+		derived += prefixes.Len()
+	}
+	slog.Info("Derived 6to4 prefixes from IPv4 sets", "prefixes", derived)
+}
+
+// sixToFourPrefix maps an IPv4 prefix a.b.c.d/n to 2002:a.b.c.d::/(16+n).
+func sixToFourPrefix(p netip.Prefix) netip.Prefix {
+	v4 := p.Addr().As4()
+
+	var b [16]byte
+	b[0], b[1] = 0x20, 0x02
+	copy(b[2:6], v4[:])
+
+	return netip.PrefixFrom(netip.AddrFrom16(b), 16+p.Bits())
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/netip"
+	"path/filepath"
+)
+
+// verify samples random addresses from the generated sets, looks each one
+// up in the source database and reports addresses attributed to another
+// country. Sets that are not countries (unknown, bogons) are skipped.
+// Geofeed overrides show up as mismatches by design.
+func (g *geoIPGenerator) verify() error {
+	db, schema, err := g.openDatabase(g.ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rng := rand.New(rand.NewPCG(g.cfg.Seed, g.cfg.Seed))
+	if g.cfg.Seed == 0 {
+		rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+
+	// Sets that are not countries, like the -bogon-set, are not sampled
+	codes := setNameCodes(g.cfg.SetNaming)
+	sampled, mismatches := 0, 0
+	for _, family := range g.cfg.Families {
+		name := fmt.Sprintf("geoip_%s%s", family, g.cfg.setFileExt())
+		sets, err := readNFTSets(filepath.Join(g.cfg.OutputDir, name))
+		if err != nil {
+			return err
+		}
+
+		for _, set := range sortedCodes(sets) {
+			code, ok := codes[set]
+			if !ok {
+				continue
+			}
+
+			prefixes := sets[set]
+			for range g.cfg.Samples {
+				prefix := prefixes[rng.IntN(len(prefixes))]
+				addr := randomAddr(rng, prefix)
+				sampled++
+
+				got, err := schema.CountryCode(db.Lookup(addr), g.cfg.RepresentedCountry)
+				if err != nil {
+					return fmt.Errorf("looking up %s: %w", addr, err)
+				}
+
+				if got != code {
+					mismatches++
+					slog.Error("Sampled address differs from the database", "set", set, "address", addr, "prefix", prefix, "database", got)
+				}
+			}
+		}
+	}
+
+	if mismatches > 0 {
+		return withExitCode(exitVerification, "%d of %d sampled addresses do not match the database", mismatches, sampled)
+	}
+
+	slog.Info("All sampled addresses match the database", "sampled", sampled)
+	return nil
+}
+
+// randomAddr returns a random address inside prefix.
+func randomAddr(rng *rand.Rand, prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		if rng.IntN(2) == 1 {
+			b[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// inputWatcher reports changes of the -input file for -watch. It watches
+// the directory, as updaters like geoipupdate write a temporary file and
+// rename it over the database, which a watch on the file itself loses.
+type inputWatcher struct {
+	watcher *fsnotify.Watcher
+	path    string
+}
+
+func newInputWatcher(path string) (*inputWatcher, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(abs)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("watching %s: %w", filepath.Dir(abs), err)
+	}
+	return &inputWatcher{watcher: watcher, path: abs}, nil
+}
+
+// run calls job once the file was created or written and then left alone
+// for delay, so that a database copied in several writes is read once it
+// is complete. Changes during a job start another one after it. run
+// returns when ctx is cancelled.
+func (w *inputWatcher) run(ctx context.Context, delay time.Duration, job func()) {
+	defer w.watcher.Close()
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Name != w.path || !event.Op.Has(fsnotify.Create) && !event.Op.Has(fsnotify.Write) {
+				continue
+			}
+			slog.Debug("Input changed", "path", w.path, "op", event.Op.String())
+			settled = time.After(delay)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("Watching input failed", "path", w.path, "error", err)
+		case <-settled:
+			settled = nil
+			slog.Info("Input replaced, regenerating", "path", w.path)
+			job()
+		}
+	}
+}
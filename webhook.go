@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Payload formats of -webhook-format
+const (
+	webhookFormatAuto    = "auto"
+	webhookFormatJSON    = "json"
+	webhookFormatSlack   = "slack"
+	webhookFormatDiscord = "discord"
+)
+
+// webhookPayload is the body posted in the json format.
+type webhookPayload struct {
+	Status          string          `json:"status"`
+	Error           string          `json:"error,omitempty"`
+	Host            string          `json:"host"`
+	Started         time.Time       `json:"started"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	DatabaseType    string          `json:"database_type,omitempty"`
+	BuildEpoch      uint            `json:"build_epoch,omitempty"`
+	Files           int             `json:"files"`
+	ManifestSHA256  string          `json:"manifest_sha256,omitempty"`
+	Changes         *webhookChanges `json:"changes,omitempty"`
+}
+
+// webhookChanges summarizes the diff against the previous run, only known
+// with -state-file.
+type webhookChanges struct {
+	SetsChanged     int `json:"sets_changed"`
+	PrefixesAdded   int `json:"prefixes_added"`
+	PrefixesRemoved int `json:"prefixes_removed"`
+}
+
+// sendWebhooks posts the outcome of a run started at start to every
+// -webhook URL. Failed deliveries are logged, they never fail the run.
+func (g *geoIPGenerator) sendWebhooks(start time.Time, runErr error) {
+	if len(g.cfg.Webhooks) == 0 {
+		return
+	}
+
+	payload := g.webhookPayload(start, runErr)
+	for _, target := range g.cfg.Webhooks {
+		body, err := webhookBody(webhookFormat(g.cfg.WebhookFormat, target), payload)
+		if err == nil {
+			err = g.postWebhook(target, body)
+		}
+		if err != nil {
+			slog.Error("Webhook failed", "url", redactURL(target), "error", err)
+		}
+	}
+}
+
+func (g *geoIPGenerator) webhookPayload(start time.Time, runErr error) webhookPayload {
+	host, _ := os.Hostname()
+	payload := webhookPayload{
+		Status:          "success",
+		Host:            host,
+		Started:         start.UTC(),
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	if runErr != nil {
+		payload.Status, payload.Error = "failure", runErr.Error()
+		return payload
+	}
+
+	payload.DatabaseType = g.metadata.DatabaseType
+	payload.BuildEpoch = g.metadata.BuildEpoch
+	payload.Files = len(g.outputs)
+	if hash, err := g.manifestHash(); err == nil {
+		payload.ManifestSHA256 = hash
+	}
+	if g.diff != nil {
+		info := g.gitCommitInfo(0)
+		payload.Changes = &webhookChanges{
+			SetsChanged:     info.SetsChanged,
+			PrefixesAdded:   info.PrefixesAdded,
+			PrefixesRemoved: info.PrefixesRemoved,
+		}
+	}
+	return payload
+}
+
+// manifestHash is the SHA-256 of the sha256sum style listing of all
+// outputs, so two runs share it exactly when they wrote identical files.
+func (g *geoIPGenerator) manifestHash() (string, error) {
+	files, err := g.relativeOutputs()
+	if err != nil {
+		return "", err
+	}
+
+	manifest := sha256.New()
+	for _, name := range files {
+		content, err := os.ReadFile(filepath.Join(g.cfg.OutputDir, filepath.FromSlash(name)))
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(content)
+		fmt.Fprintf(manifest, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+	return hex.EncodeToString(manifest.Sum(nil)), nil
+}
+
+// webhookFormat resolves the auto format from the well-known webhook
+// hosts of Slack and Discord.
+func webhookFormat(format, target string) string {
+	if format != webhookFormatAuto {
+		return format
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return webhookFormatJSON
+	}
+	switch {
+	case u.Host == "hooks.slack.com":
+		return webhookFormatSlack
+	case (u.Host == "discord.com" || u.Host == "discordapp.com") && strings.HasPrefix(u.Path, "/api/webhooks/"):
+		return webhookFormatDiscord
+	}
+	return webhookFormatJSON
+}
+
+func webhookBody(format string, payload webhookPayload) ([]byte, error) {
+	switch format {
+	case webhookFormatSlack:
+		return json.Marshal(map[string]string{"text": webhookText(payload)})
+	case webhookFormatDiscord:
+		return json.Marshal(map[string]string{"content": webhookText(payload)})
+	}
+	return json.Marshal(payload)
+}
+
+// webhookText is the human readable message of the chat presets.
+func webhookText(p webhookPayload) string {
+	duration := time.Duration(p.DurationSeconds * float64(time.Second)).Round(100 * time.Millisecond)
+	if p.Status != "success" {
+		return fmt.Sprintf("❌ maxminddb-to-nft on %s failed after %s: %s", p.Host, duration, p.Error)
+	}
+
+	text := fmt.Sprintf("✅ maxminddb-to-nft on %s generated %d files from %s build %s in %s",
+		p.Host, p.Files, p.DatabaseType, time.Unix(int64(p.BuildEpoch), 0).UTC().Format(time.RFC3339), duration)
+	if p.Changes != nil {
+		text += fmt.Sprintf(", %d sets changed (+%d -%d prefixes)",
+			p.Changes.SetsChanged, p.Changes.PrefixesAdded, p.Changes.PrefixesRemoved)
+	}
+	return text
+}
+
+func (g *geoIPGenerator) postWebhook(target string, body []byte) error {
+	resp, err := g.client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// Keep the URL, which carries the secret, out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// redactURL hides the path and query of a webhook URL in logs, they are
+// the secret of Slack and Discord webhooks.
+func redactURL(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host + "/…"
+}